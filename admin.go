@@ -0,0 +1,23 @@
+package main
+
+import (
+	"crypto/subtle"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// adminAuth guards the /admin group and the public routes that change recordings, it lets requests
+// through that carry ADMIN_TOKEN as a bearer token. Without ADMIN_TOKEN the admin endpoints do not exist.
+func adminAuth(cfg Config) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if cfg.AdminToken == "" {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "admin endpoints are disabled, set ADMIN_TOKEN"})
+		}
+		token, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(cfg.AdminToken)) != 1 {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid admin token"})
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const testAdminToken = "s3cret"
+
+// newTestApp runs the test in a temporary directory and sets up the routes with ADMIN_TOKEN set to adminToken
+func newTestApp(t *testing.T, adminToken string) (*fiber.App, string) {
+	t.Helper()
+	id := newTestSessionDir(t)
+	t.Setenv("ADMIN_TOKEN", adminToken)
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newApp(cfg), id
+}
+
+// testRequest sends method path to app, with token as the bearer token unless it is empty, and returns the status
+func testRequest(t *testing.T, app *fiber.App, method, path, token string) int {
+	t.Helper()
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+// adminRoutes are the endpoints of the /admin group, with the session id for :uuid
+func adminRoutes(id string) [][2]string {
+	return [][2]string{
+		{fiber.MethodPost, "/simulate/offer"},
+		{fiber.MethodPost, "/debug/gc"},
+		{fiber.MethodPost, "/sessions/" + id + "/inject"},
+		{fiber.MethodPost, "/benchmark/signaling"},
+		{fiber.MethodPost, "/sessions/" + id + "/forward"},
+		{fiber.MethodGet, "/test/webrtc"},
+	}
+}
+
+func TestAdminRoutesRequireToken(t *testing.T) {
+	app, id := newTestApp(t, testAdminToken)
+	for _, route := range adminRoutes(id) {
+		method, path := route[0], "/admin"+route[1]
+		if status := testRequest(t, app, method, path, ""); status != fiber.StatusUnauthorized {
+			t.Errorf("%s %s without a token: status %d, want 401", method, path, status)
+		}
+		if status := testRequest(t, app, method, path, "wrong"); status != fiber.StatusUnauthorized {
+			t.Errorf("%s %s with a wrong token: status %d, want 401", method, path, status)
+		}
+	}
+}
+
+func TestAdminRoutesDisabledWithoutToken(t *testing.T) {
+	app, id := newTestApp(t, "")
+	for _, route := range adminRoutes(id) {
+		method, path := route[0], "/admin"+route[1]
+		if status := testRequest(t, app, method, path, testAdminToken); status != fiber.StatusNotFound {
+			t.Errorf("%s %s without ADMIN_TOKEN: status %d, want 404", method, path, status)
+		}
+	}
+}
+
+func TestPublicRoutesIgnoreAdminToken(t *testing.T) {
+	app, id := newTestApp(t, testAdminToken)
+
+	// The admin endpoints do not exist outside /admin, whatever token comes along
+	for _, route := range adminRoutes(id) {
+		method, path := route[0], route[1]
+		if status := testRequest(t, app, method, path, testAdminToken); status != fiber.StatusNotFound {
+			t.Errorf("%s %s with the admin token: status %d, want 404", method, path, status)
+		}
+	}
+
+	// Public endpoints answer the same with and without it
+	public := [][2]string{
+		{fiber.MethodGet, "/"},
+		{fiber.MethodGet, "/files/" + id + "/video"},
+		{fiber.MethodGet, "/files/" + id + "/status"},
+		{fiber.MethodPost, "/sessions/" + id + "/keyframe"},
+	}
+	for _, route := range public {
+		method, path := route[0], route[1]
+		without := testRequest(t, app, method, path, "")
+		if without == fiber.StatusUnauthorized {
+			t.Errorf("%s %s without a token: status 401", method, path)
+		}
+		if with := testRequest(t, app, method, path, testAdminToken); with != without {
+			t.Errorf("%s %s: status %d with the admin token, %d without", method, path, with, without)
+		}
+	}
+}
+
+func TestReplaceVideoRequiresAdminToken(t *testing.T) {
+	app, id := newTestApp(t, testAdminToken)
+	if status := testRequest(t, app, fiber.MethodPut, "/files/"+id+"/video", ""); status != fiber.StatusUnauthorized {
+		t.Errorf("PUT /files/:uuid/video without a token: status %d, want 401", status)
+	}
+	// With the token the request reaches the handler, which finds no upload in it
+	if status := testRequest(t, app, fiber.MethodPut, "/files/"+id+"/video", testAdminToken); status == fiber.StatusUnauthorized {
+		t.Error("PUT /files/:uuid/video with the admin token: status 401")
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	annotationsFileName = "annotations.jsonl"
+	maxAnnotationLength = 1024
+)
+
+// annotation is a text note at a point of a recording, stored one per line in annotations.jsonl
+type annotation struct {
+	TimeMs int64  `json:"timeMs"`
+	Text   string `json:"text"`
+}
+
+// appendAnnotation adds a to the annotations of the session
+func (s *recordingSession) appendAnnotation(a annotation) error {
+	line, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := os.OpenFile(recordingPath(s.id, annotationsFileName), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// annotations returns the annotations of the session in the order they were added
+func (s *recordingSession) annotations() ([]annotation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	annotations := []annotation{}
+	file, err := os.Open(recordingPath(s.id, annotationsFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return annotations, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		var a annotation
+		if err := json.Unmarshal(scanner.Bytes(), &a); err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", annotationsFileName, line, err)
+		}
+		annotations = append(annotations, a)
+	}
+	return annotations, scanner.Err()
+}
+
+// annotatedSession looks up the session in the :uuid route parameter
+func annotatedSession(c *fiber.Ctx) (*recordingSession, error) {
+	id := c.Params("uuid")
+	if !isUUID(id) {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "invalid session id")
+	}
+	session, ok := sessions.get(id)
+	if !ok {
+		return nil, fiber.NewError(fiber.StatusNotFound, "session not found")
+	}
+	return session, nil
+}
+
+// handleAddAnnotation stores a timestamped text note for a recording
+func handleAddAnnotation(c *fiber.Ctx) error {
+	session, err := annotatedSession(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	var body annotation
+	if err := c.BodyParser(&body); err != nil || body.Text == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "text is required"})
+	}
+	if body.TimeMs < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "timeMs must not be negative"})
+	}
+	if utf8.RuneCountInString(body.Text) > maxAnnotationLength {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("text must be at most %d characters", maxAnnotationLength)})
+	}
+
+	if err := session.appendAnnotation(body); err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusCreated).JSON(body)
+}
+
+func handleListAnnotations(c *fiber.Ctx) error {
+	session, err := annotatedSession(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	annotations, err := session.annotations()
+	if err != nil {
+		return err
+	}
+	return c.JSON(annotations)
+}
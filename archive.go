@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// archiveSession moves the directory of a completed session to archivePath/<YYYY-MM-DD>/<uuid>/,
+// dated by the day the session ended, and removes the session from the registry
+func archiveSession(sessionID string, archivePath string) error {
+	day := time.Now().UTC()
+	if session, ok := sessions.get(sessionID); ok {
+		session.mu.Lock()
+		if session.meta.EndedAt != nil {
+			day = *session.meta.EndedAt
+		}
+		session.mu.Unlock()
+	}
+
+	src := filepath.Join(filesDir, sessionID)
+	dst := filepath.Join(archivePath, day.Format("2006-01-02"), sessionID)
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	if _, err := os.Stat(dst); err == nil {
+		return fmt.Errorf("%s is already archived", dst)
+	}
+
+	err := os.Rename(src, dst)
+	if errors.Is(err, syscall.EXDEV) {
+		// The archive is on another filesystem, which a rename cannot cross
+		if err = copyDir(src, dst); err != nil {
+			os.RemoveAll(dst)
+			return err
+		}
+		err = os.RemoveAll(src)
+	}
+	if err != nil {
+		return err
+	}
+
+	sessions.remove(sessionID)
+	return nil
+}
+
+// copyDir copies the directory tree at src to dst, which must not exist yet
+func copyDir(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.Mkdir(target, 0o755)
+		}
+		return copyFile(path, target)
+	})
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// scheduleArchive archives the session after the configured delay, if an archive path is set
+func scheduleArchive(cfg Config, sessionID string) {
+	if cfg.ArchivePath == "" {
+		return
+	}
+	time.AfterFunc(cfg.ArchiveDelay, func() {
+		if err := archiveSession(sessionID, cfg.ArchivePath); err != nil {
+			fmt.Printf("Cannot archive session %s: %v\n", sessionID, err)
+			return
+		}
+		fmt.Printf("Session %s archived to %s\n", sessionID, cfg.ArchivePath)
+	})
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pion/webrtc/v3"
+)
+
+const (
+	maxBenchmarkPeerConnections = 100
+	// benchmarkGatherTimeout bounds the wait for one peer connection to finish ICE gathering
+	benchmarkGatherTimeout = 30 * time.Second
+)
+
+// gatherICE creates a peer connection with the server's ICE configuration and returns how long
+// it took from creating the offer until ICE gathering completed, which includes the TURN allocations
+func gatherICE(cfg Config) (time.Duration, error) {
+	pc, err := webrtc.NewPeerConnection(peerConnectionConfig(cfg))
+	if err != nil {
+		return 0, err
+	}
+	defer pc.Close()
+
+	// An offer needs at least one media section to gather candidates for
+	if _, err := pc.CreateDataChannel("benchmark", nil); err != nil {
+		return 0, err
+	}
+
+	start := time.Now()
+	offer, err := pc.CreateOffer(nil)
+	if err != nil {
+		return 0, err
+	}
+	gatherComplete := webrtc.GatheringCompletePromise(pc)
+	if err := pc.SetLocalDescription(offer); err != nil {
+		return 0, err
+	}
+
+	select {
+	case <-gatherComplete:
+		return time.Since(start), nil
+	case <-time.After(benchmarkGatherTimeout):
+		return 0, errors.New("ICE gathering timed out")
+	}
+}
+
+// percentileMs returns the p-th percentile of sorted durations in milliseconds, using the nearest rank method
+func percentileMs(sorted []time.Duration, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return float64(sorted[rank-1].Microseconds()) / 1000
+}
+
+// handleSignalingBenchmark gathers ICE candidates for ?n= peer connections in parallel and reports how
+// long gathering took, a way to load test the configured STUN and TURN servers. It is served under
+// /admin, every request sets up as many as maxBenchmarkPeerConnections peer connections.
+func handleSignalingBenchmark(cfg Config) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		n := c.QueryInt("n", 10)
+		if n < 1 || n > maxBenchmarkPeerConnections {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "n must be between 1 and 100"})
+		}
+
+		var (
+			wg        sync.WaitGroup
+			mu        sync.Mutex
+			durations []time.Duration
+			failures  int
+		)
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				d, err := gatherICE(cfg)
+
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					fmt.Printf("Benchmark peer connection failed: %v\n", err)
+					failures++
+					return
+				}
+				durations = append(durations, d)
+			}()
+		}
+		wg.Wait()
+
+		if len(durations) == 0 {
+			return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"error": "ICE gathering failed for every peer connection", "n": n, "failures": failures})
+		}
+		sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+		return c.JSON(fiber.Map{
+			"n":        n,
+			"failures": failures,
+			"medianMs": percentileMs(durations, 50),
+			"p99Ms":    percentileMs(durations, 99),
+		})
+	}
+}
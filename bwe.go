@@ -0,0 +1,56 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// bweInitialBitrate is where the estimate starts before the first receiver report, in bits per second
+	bweInitialBitrate = 1_000_000
+	bweMinBitrate     = 100_000
+	bweMaxBitrate     = 10_000_000
+	// bweLogInterval is how often the playback logs the estimate
+	bweLogInterval = 5 * time.Second
+)
+
+// BandwidthEstimator estimates the bitrate a receiver can take from the fraction of packets it
+// reports lost, like the loss based part of Google Congestion Control: more than 10% loss
+// lowers the estimate by half the loss, less than 2% raises it by 8%, anything in between keeps it.
+// pion v3 has no bandwidth estimation of its own for the sending side.
+type BandwidthEstimator struct {
+	mu      sync.Mutex
+	bitrate float64
+}
+
+func NewBandwidthEstimator() *BandwidthEstimator {
+	return &BandwidthEstimator{bitrate: bweInitialBitrate}
+}
+
+// OnReport updates the estimate from the fraction lost of a reception report, in 1/256ths
+func (e *BandwidthEstimator) OnReport(fractionLost uint8) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	loss := float64(fractionLost) / 256
+	switch {
+	case loss > 0.1:
+		e.bitrate *= 1 - loss/2
+	case loss < 0.02:
+		e.bitrate *= 1.08
+	}
+	e.bitrate = min(max(e.bitrate, bweMinBitrate), bweMaxBitrate)
+}
+
+// Bitrate returns the estimate in bits per second
+func (e *BandwidthEstimator) Bitrate() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return int(e.bitrate)
+}
+
+// SendTime is how long sending size bytes takes at the estimated bitrate
+func (e *BandwidthEstimator) SendTime(size int) time.Duration {
+	return time.Duration(float64(size*8) / float64(e.Bitrate()) * float64(time.Second))
+}
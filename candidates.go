@@ -0,0 +1,66 @@
+package main
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// iceCandidateTypes are the values ICE_CANDIDATE_TYPES may list
+var iceCandidateTypes = []string{"host", "srflx", "prflx", "relay"}
+
+// candidateType returns the type of a candidate attribute such as
+// "candidate:1 1 udp 2130706431 10.0.0.1 5000 typ host", empty if it has none
+func candidateType(candidate string) string {
+	fields := strings.Fields(candidate)
+	for i := 0; i+1 < len(fields); i++ {
+		if fields[i] == "typ" {
+			return fields[i+1]
+		}
+	}
+	return ""
+}
+
+// candidateAllowed tells if the type of candidate is one of allowed, an empty list allows every type
+func candidateAllowed(candidate string, allowed []string) bool {
+	return len(allowed) == 0 || slices.Contains(allowed, candidateType(candidate))
+}
+
+// filterCandidates returns the candidates whose type is one of allowed, an empty list keeps them all
+func filterCandidates(candidates []webrtc.ICECandidateInit, allowed []string) []webrtc.ICECandidateInit {
+	var kept []webrtc.ICECandidateInit
+	for _, candidate := range candidates {
+		if candidateAllowed(candidate.Candidate, allowed) {
+			kept = append(kept, candidate)
+		}
+	}
+	return kept
+}
+
+// filterSDPCandidates removes the a=candidate lines whose type is not one of allowed
+func filterSDPCandidates(sdp string, allowed []string) string {
+	if len(allowed) == 0 {
+		return sdp
+	}
+	lines := strings.SplitAfter(sdp, "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if candidate, ok := strings.CutPrefix(strings.TrimSpace(line), "a="); ok && strings.HasPrefix(candidate, "candidate:") && !candidateAllowed(candidate, allowed) {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	return strings.Join(kept, "")
+}
+
+// localDescription returns the local description of pc without the candidates ICE_CANDIDATE_TYPES leaves out
+func localDescription(cfg Config, pc PeerConnectionInterface) *webrtc.SessionDescription {
+	desc := pc.LocalDescription()
+	if desc == nil || len(cfg.ICECandidateTypes) == 0 {
+		return desc
+	}
+	filtered := *desc
+	filtered.SDP = filterSDPCandidates(desc.SDP, cfg.ICECandidateTypes)
+	return &filtered
+}
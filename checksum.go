@@ -0,0 +1,105 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// checksumSuffix names the checksum file of a recording, output.ivf.sha256 for output.ivf
+const checksumSuffix = ".sha256"
+
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeChecksum stores the SHA-256 of the recording file name in name.sha256, in the format of
+// sha256sum so that `sha256sum -c` verifies it too, and in the checksums of session.json
+func (s *recordingSession) writeChecksum(name string) error {
+	sum, err := fileSHA256(recordingPath(s.id, name))
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(recordingPath(s.id, name+checksumSuffix), []byte(sum+"  "+name+"\n"), 0o644); err != nil {
+		return err
+	}
+	return s.update(func(meta *sessionMetadata) {
+		if meta.Checksums == nil {
+			meta.Checksums = map[string]string{}
+		}
+		meta.Checksums[name] = sum
+	})
+}
+
+// writeChecksums writes the checksums of the video and audio recordings once the session ended, a dry run has none
+func (s *recordingSession) writeChecksums() error {
+	var errs []error
+	for _, name := range []string{videoFileName, audioFileName} {
+		if !fileExists(recordingPath(s.id, name)) {
+			continue
+		}
+		if err := s.writeChecksum(name); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// verifyChecksum compares the recording name with its .sha256 file, ok is false when there is no checksum to compare with
+func verifyChecksum(id, name string) (intact, ok bool, err error) {
+	b, err := os.ReadFile(recordingPath(id, name+checksumSuffix))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, false, nil
+	} else if err != nil {
+		return false, false, err
+	}
+	stored, _, _ := strings.Cut(strings.TrimSpace(string(b)), " ")
+
+	sum, err := fileSHA256(recordingPath(id, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, true, nil
+	} else if err != nil {
+		return false, false, err
+	}
+	return sum == stored, true, nil
+}
+
+// handleVerify recomputes the checksums of the recordings and reports whether they still match
+// the ones stored when the session ended. A recording without a stored checksum is left out.
+func handleVerify(c *fiber.Ctx) error {
+	id := c.Params("uuid")
+	if !isUUID(id) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid session id"})
+	}
+
+	result := fiber.Map{}
+	for _, file := range []struct{ name, field string }{{videoFileName, "videoIntact"}, {audioFileName, "audioIntact"}} {
+		intact, ok, err := verifyChecksum(id, file.name)
+		if err != nil {
+			return err
+		}
+		if ok {
+			result[file.field] = intact
+		}
+	}
+	if len(result) == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "recording has no checksums"})
+	}
+	return c.JSON(result)
+}
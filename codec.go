@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// The IVF FourCCs of the video codecs we record and play
+const (
+	fourCCVP8 = "VP80"
+	fourCCVP9 = "VP90"
+	fourCCAV1 = "AV01"
+)
+
+// ivfMimeTypes pairs the IVF FourCCs of the video codecs we record and play with their WebRTC MIME types
+var ivfMimeTypes = []struct{ fourCC, mimeType string }{
+	{fourCCVP8, webrtc.MimeTypeVP8},
+	{fourCCVP9, webrtc.MimeTypeVP9},
+	{fourCCAV1, webrtc.MimeTypeAV1},
+}
+
+// FourCCToMimeType returns the WebRTC MIME type of the codec an IVF file names by fourCC, e.g. video/VP8 for VP80
+func FourCCToMimeType(fourCC string) (string, error) {
+	for _, codec := range ivfMimeTypes {
+		if codec.fourCC == fourCC {
+			return codec.mimeType, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported IVF FourCC %q", fourCC)
+}
+
+// MimeTypeToFourCC returns the IVF FourCC of a video MIME type, which is compared like WebRTC does, ignoring case
+func MimeTypeToFourCC(mimeType string) (string, error) {
+	for _, codec := range ivfMimeTypes {
+		if strings.EqualFold(codec.mimeType, mimeType) {
+			return codec.fourCC, nil
+		}
+	}
+	return "", fmt.Errorf("no IVF FourCC for %q", mimeType)
+}
+
+// ivfCodecName is the codec name the probe endpoints return for fourCC, the subtype of its MIME
+// type such as VP8 for VP80, or fourCC itself for codecs we do not know
+func ivfCodecName(fourCC string) string {
+	mimeType, err := FourCCToMimeType(fourCC)
+	if err != nil {
+		return fourCC
+	}
+	return strings.TrimPrefix(mimeType, "video/")
+}
+
+// vp9FmtpLine is the fmtp of the VP9 codec with the given profile-id, as in pion's default codecs
+func vp9FmtpLine(profile int) string {
+	return fmt.Sprintf("profile-id=%d", profile)
+}
+
+// preferVP9Profile limits the codecs the transceiver of sender answers with to VP9 of fmtp and its
+// RTX, so the answer names the one profile the track is sent with. Only a real peer connection has
+// transceivers, anything else is left as is.
+func preferVP9Profile(pc PeerConnectionInterface, sender *webrtc.RTPSender, fmtp string) error {
+	real, ok := pc.(*webrtc.PeerConnection)
+	if !ok || sender == nil {
+		return nil
+	}
+
+	var codecs []webrtc.RTPCodecParameters
+	for _, codec := range sender.GetParameters().Codecs {
+		if strings.EqualFold(codec.MimeType, webrtc.MimeTypeVP9) && codec.SDPFmtpLine == fmtp {
+			codecs = append(codecs, codec)
+		}
+	}
+	for _, codec := range sender.GetParameters().Codecs {
+		for _, vp9 := range codecs {
+			if strings.EqualFold(codec.MimeType, mimeTypeRTX) && codec.SDPFmtpLine == fmt.Sprintf("apt=%d", vp9.PayloadType) {
+				codecs = append(codecs, codec)
+			}
+		}
+	}
+	for _, transceiver := range real.GetTransceivers() {
+		if transceiver.Sender() == sender {
+			return transceiver.SetCodecPreferences(codecs)
+		}
+	}
+	return nil
+}
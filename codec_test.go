@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v3"
+)
+
+func TestIVFCodecName(t *testing.T) {
+	tests := []struct{ fourCC, want string }{
+		{fourCCVP8, "VP8"},
+		{fourCCVP9, "VP9"},
+		{fourCCAV1, "AV1"},
+		{"H264", "H264"},
+	}
+	for _, tt := range tests {
+		if got := ivfCodecName(tt.fourCC); got != tt.want {
+			t.Errorf("ivfCodecName(%q) = %q, want %q", tt.fourCC, got, tt.want)
+		}
+	}
+}
+
+func TestIsIVFKeyFrame(t *testing.T) {
+	tests := []struct {
+		fourCC string
+		frame  []byte
+		want   bool
+	}{
+		{fourCCVP8, []byte{0x10}, true},
+		{fourCCVP8, []byte{0x11}, false},
+		{fourCCVP9, []byte{0x82}, true},
+		{fourCCVP9, []byte{0x86}, false},
+		{fourCCAV1, []byte{0x12}, true},
+		{fourCCVP8, nil, false},
+	}
+	for _, tt := range tests {
+		if got := isIVFKeyFrame(tt.fourCC, tt.frame); got != tt.want {
+			t.Errorf("isIVFKeyFrame(%q, %x) = %v, want %v", tt.fourCC, tt.frame, got, tt.want)
+		}
+	}
+}
+
+// answeredVP9Fmtps returns the fmtp of every VP9 codec the video section of answer lists
+func answeredVP9Fmtps(t *testing.T, answer webrtc.SessionDescription) []string {
+	t.Helper()
+	parsed := sdp.SessionDescription{}
+	if err := parsed.Unmarshal([]byte(answer.SDP)); err != nil {
+		t.Fatal(err)
+	}
+
+	var fmtps []string
+	for _, media := range parsed.MediaDescriptions {
+		if media.MediaName.Media != "video" {
+			continue
+		}
+		for _, format := range media.MediaName.Formats {
+			payloadType, err := strconv.ParseUint(format, 10, 8)
+			if err != nil {
+				t.Fatal(err)
+			}
+			codec, err := parsed.GetCodecForPayloadType(uint8(payloadType))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if codec.Name == "VP9" {
+				fmtps = append(fmtps, codec.Fmtp)
+			}
+		}
+	}
+	return fmtps
+}
+
+func TestPlaybackAnswerVP9Profile(t *testing.T) {
+	for _, profile := range []int{0, 2} {
+		t.Run("profile-id="+strconv.Itoa(profile), func(t *testing.T) {
+			dir := t.TempDir()
+			videoPath := filepath.Join(dir, videoFileName)
+			writeTestIVF(t, videoPath, fourCCVP9)
+
+			// A browser offers pion's default codecs, VP9 with both profiles among them
+			client, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { client.Close() })
+			if _, err := client.AddTransceiverFromKind(webrtc.RTPCodecTypeVideo, webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionRecvonly}); err != nil {
+				t.Fatal(err)
+			}
+			offer, err := client.CreateOffer(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cfg := Config{VP9Profile: profile}
+			session, answer, err := NewPlaybackSession(context.Background(), cfg, func() (PeerConnectionInterface, error) {
+				return newPlaybackPeerConnection(cfg)
+			}, videoPath, filepath.Join(dir, audioFileName), defaultTrackLabels, offer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { session.peerConnection.Close() })
+
+			fmtps := answeredVP9Fmtps(t, answer)
+			if want := vp9FmtpLine(profile); len(fmtps) != 1 || fmtps[0] != want {
+				t.Errorf("answer lists VP9 with %q, want only %q", fmtps, want)
+			}
+		})
+	}
+}
+
+func TestPlaybackTrackVP9Profile(t *testing.T) {
+	dir := t.TempDir()
+	videoPath := filepath.Join(dir, videoFileName)
+	writeTestIVF(t, videoPath, fourCCVP9)
+
+	conn := &TestConnection{}
+	_, _, err := NewPlaybackSession(context.Background(), Config{VP9Profile: 2}, func() (PeerConnectionInterface, error) {
+		return conn, nil
+	}, videoPath, filepath.Join(dir, audioFileName), defaultTrackLabels, webrtc.SessionDescription{Type: webrtc.SDPTypeOffer})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.SetICEConnectionState(webrtc.ICEConnectionStateClosed) })
+
+	tracks := conn.Tracks()
+	if len(tracks) != 1 {
+		t.Fatalf("got %d tracks, want the video", len(tracks))
+	}
+	track, ok := tracks[0].(*webrtc.TrackLocalStaticSample)
+	if !ok {
+		t.Fatalf("video track is a %T", tracks[0])
+	}
+	if codec := track.Codec(); codec.MimeType != webrtc.MimeTypeVP9 || codec.SDPFmtpLine != vp9FmtpLine(2) {
+		t.Errorf("video track sends %s with %q, want VP9 with %q", codec.MimeType, codec.SDPFmtpLine, vp9FmtpLine(2))
+	}
+}
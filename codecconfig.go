@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pion/rtcp"
+	"github.com/pion/webrtc/v3"
+)
+
+const (
+	// Opus encodes at 6 to 510 kbit/s
+	minOpusBitrate = 6000
+	maxOpusBitrate = 510000
+	// maxKeyframeInterval bounds the keyframe interval, in frames
+	maxKeyframeInterval = 1000
+	// defaultKeyframeFPS converts the keyframe interval to time before a frame rate was observed
+	defaultKeyframeFPS = 30
+)
+
+var errNoAudioTrack = errors.New("session has no live audio track")
+
+// codecConfig is what PATCH /sessions/:uuid/codecConfig asks the client's encoders for. The client
+// follows the audio bitrate from REMB and gets a FIR every videoKeyframeInterval frames, zero
+// leaves the encoder's own choice. The intervalpli interceptor still asks for a keyframe every 3s.
+type codecConfig struct {
+	AudioBitrate          int `json:"audioBitrate,omitempty"`
+	VideoKeyframeInterval int `json:"videoKeyframeInterval,omitempty"`
+}
+
+// setAudioSSRC records the SSRC of the audio track being recorded, 0 once it ended
+func (s *recordingSession) setAudioSSRC(ssrc uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.audioSSRC = ssrc
+}
+
+// sendAudioBitrate caps the audio bitrate of the client with a REMB for the audio track
+func (s *recordingSession) sendAudioBitrate(bitrate int) error {
+	s.mu.Lock()
+	ssrc := s.audioSSRC
+	s.mu.Unlock()
+
+	if ssrc == 0 || s.peerConnection == nil {
+		return errNoAudioTrack
+	}
+	return s.peerConnection.WriteRTCP([]rtcp.Packet{&rtcp.ReceiverEstimatedMaximumBitrate{Bitrate: float32(bitrate), SSRCs: []uint32{ssrc}}})
+}
+
+// startKeyframeInterval sends a FIR for the video track every interval frames, replacing the
+// previous interval. The frames are converted to time with the observed frame rate. It stops once
+// the connection is closed.
+func (s *recordingSession) startKeyframeInterval(interval int) {
+	s.mu.Lock()
+	if s.stopKeyframes != nil {
+		close(s.stopKeyframes)
+		s.stopKeyframes = nil
+	}
+	if interval == 0 {
+		s.mu.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	s.stopKeyframes = stop
+	fps := s.meta.ObservedVideoFPS
+	s.mu.Unlock()
+
+	if fps <= 0 {
+		fps = defaultKeyframeFPS
+	}
+	period := time.Duration(float64(interval) / fps * float64(time.Second))
+	go func() {
+		ticker := time.NewTicker(period)
+		defer ticker.Stop()
+		var sequence uint8
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+
+			s.mu.Lock()
+			ssrc := s.videoSSRC
+			s.mu.Unlock()
+			if ssrc == 0 {
+				continue
+			}
+			sequence++
+			fir := &rtcp.FullIntraRequest{MediaSSRC: ssrc, FIR: []rtcp.FIREntry{{SSRC: ssrc, SequenceNumber: sequence}}}
+			if err := s.peerConnection.WriteRTCP([]rtcp.Packet{fir}); err != nil {
+				return
+			}
+		}
+	}()
+}
+
+// handleCodecConfig changes the audio bitrate and the keyframe interval of a live session,
+// fields left out of the body keep their current value
+func handleCodecConfig(c *fiber.Ctx) error {
+	id := c.Params("uuid")
+	if !isUUID(id) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid session id"})
+	}
+
+	var body struct {
+		AudioBitrate          *int `json:"audioBitrate"`
+		VideoKeyframeInterval *int `json:"videoKeyframeInterval"`
+	}
+	if err := c.BodyParser(&body); err != nil || (body.AudioBitrate == nil && body.VideoKeyframeInterval == nil) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "audioBitrate or videoKeyframeInterval is required"})
+	}
+	if body.AudioBitrate != nil && (*body.AudioBitrate < minOpusBitrate || *body.AudioBitrate > maxOpusBitrate) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("audioBitrate must be between %d and %d for Opus", minOpusBitrate, maxOpusBitrate)})
+	}
+	if body.VideoKeyframeInterval != nil && (*body.VideoKeyframeInterval < 0 || *body.VideoKeyframeInterval > maxKeyframeInterval) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("videoKeyframeInterval must be between 0 and %d frames", maxKeyframeInterval)})
+	}
+
+	session, ok := sessions.get(id)
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "session not found"})
+	}
+	if session.peerConnection == nil || session.peerConnection.ConnectionState() == webrtc.PeerConnectionStateClosed {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "session is not live"})
+	}
+
+	if body.AudioBitrate != nil {
+		if err := session.sendAudioBitrate(*body.AudioBitrate); err != nil {
+			if errors.Is(err, errNoAudioTrack) {
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+			}
+			return err
+		}
+	}
+	if body.VideoKeyframeInterval != nil {
+		session.startKeyframeInterval(*body.VideoKeyframeInterval)
+	}
+
+	session.mu.Lock()
+	if body.AudioBitrate != nil {
+		session.codecConfig.AudioBitrate = *body.AudioBitrate
+	}
+	if body.VideoKeyframeInterval != nil {
+		session.codecConfig.VideoKeyframeInterval = *body.VideoKeyframeInterval
+	}
+	current := session.codecConfig
+	session.mu.Unlock()
+
+	return c.JSON(current)
+}
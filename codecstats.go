@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3/pkg/media"
+)
+
+const codecStatsFileName = "codec_stats.json"
+
+// codecCounters counts what arrived for the first track of one kind. The packets are counted as
+// they are read and the frames as they reach the recording, keyframes for video, Ogg pages for audio.
+type codecCounters struct {
+	codec   atomic.Value
+	packets atomic.Uint64
+	bytes   atomic.Uint64
+	frames  atomic.Uint64
+	// dropped counts the video frames left out for MAX_VIDEO_FPS
+	dropped atomic.Uint64
+}
+
+// setCodec stores the codec name from the MIME type of the track, e.g. VP8 for video/VP8
+func (c *codecCounters) setCodec(mimeType string) {
+	_, name, _ := strings.Cut(mimeType, "/")
+	c.codec.Store(name)
+}
+
+// observePacket counts an RTP packet and its payload bytes
+func (c *codecCounters) observePacket(packet *rtp.Packet) {
+	c.packets.Add(1)
+	c.bytes.Add(uint64(len(packet.Payload)))
+}
+
+func (c *codecCounters) codecName() string {
+	name, _ := c.codec.Load().(string)
+	return name
+}
+
+// codecFrameCounter is a MediaPipeline stage counting the samples accepted by isFrame into counters
+type codecFrameCounter struct {
+	counters *codecCounters
+	isFrame  func(media.Sample) bool
+}
+
+func (f codecFrameCounter) ProcessSample(sample media.Sample, _ string) error {
+	if f.isFrame(sample) {
+		f.counters.frames.Add(1)
+	}
+	return nil
+}
+
+func (f codecFrameCounter) Close() error { return nil }
+
+// writeCodecStats writes the counters of the session to codec_stats.json, a kind without a track is left out
+func (s *recordingSession) writeCodecStats() error {
+	type videoStats struct {
+		Codec     string `json:"codec"`
+		Packets   uint64 `json:"packets"`
+		Bytes     uint64 `json:"bytes"`
+		Keyframes uint64 `json:"keyframes"`
+		Dropped   uint64 `json:"droppedFrames,omitempty"`
+	}
+	type audioStats struct {
+		Codec   string `json:"codec"`
+		Packets uint64 `json:"packets"`
+		Bytes   uint64 `json:"bytes"`
+		Pages   uint64 `json:"pages"`
+	}
+	var stats struct {
+		Video *videoStats `json:"video,omitempty"`
+		Audio *audioStats `json:"audio,omitempty"`
+	}
+	if c := &s.videoStats; c.codecName() != "" {
+		stats.Video = &videoStats{Codec: c.codecName(), Packets: c.packets.Load(), Bytes: c.bytes.Load(), Keyframes: c.frames.Load(), Dropped: c.dropped.Load()}
+	}
+	if c := &s.audioStats; c.codecName() != "" {
+		stats.Audio = &audioStats{Codec: c.codecName(), Packets: c.packets.Load(), Bytes: c.bytes.Load(), Pages: c.frames.Load()}
+	}
+
+	b, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(recordingPath(s.id, codecStatsFileName), b, 0o644)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/compress"
+)
+
+// uncompressedFileRoutes are the last path segments of the /files/:uuid routes serving media,
+// which is compressed already
+var uncompressedFileRoutes = []string{"/video", "/audio", "/bundle", "/webm"}
+
+// compressLevel maps COMPRESS_LEVEL, 1 for the fastest to 9 for the best compression, onto the
+// three levels Fiber offers. 0 leaves Fiber's default.
+func compressLevel(level int) compress.Level {
+	switch {
+	case level == 0:
+		return compress.LevelDefault
+	case level <= 3:
+		return compress.LevelBestSpeed
+	case level <= 6:
+		return compress.LevelDefault
+	default:
+		return compress.LevelBestCompression
+	}
+}
+
+// compressionMiddleware compresses API responses but not the recordings served under /files/:uuid
+func compressionMiddleware(cfg Config) fiber.Handler {
+	return compress.New(compress.Config{
+		Level: compressLevel(cfg.CompressLevel),
+		Next: func(c *fiber.Ctx) bool {
+			path := c.Path()
+			// Event streams have to reach the client one event at a time
+			if path == "/events" || strings.HasPrefix(path, "/sessions/") && strings.HasSuffix(path, "/signaling") {
+				return true
+			}
+			if !strings.HasPrefix(path, "/files/") {
+				return false
+			}
+			for _, suffix := range uncompressedFileRoutes {
+				if strings.HasSuffix(path, suffix) {
+					return true
+				}
+			}
+			return false
+		},
+	})
+}
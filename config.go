@@ -0,0 +1,328 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// Config holds the settings read from the environment at startup
+type Config struct {
+	// STUNURLs and TURNURLs are the ICE servers of every peer connection, from the comma separated
+	// STUN_URLS and TURN_URLS. TURN is only used when TURN_URLS is set.
+	STUNURLs []string
+	TURNURLs []string
+	// TURNUsername and TURNPassword are static TURN credentials, used when TURNSecret is not set
+	TURNUsername string
+	TURNPassword string
+	// ICETransportPolicy is "all" by default, ICE_TRANSPORT_POLICY=relay only uses TURN candidates
+	ICETransportPolicy webrtc.ICETransportPolicy
+	// ICEMTU is the largest packet the peer connections read, 0 keeps pion's 1460 bytes
+	ICEMTU int
+	// ICEInterfaces are the network interfaces ICE gathers host candidates on, from the comma separated
+	// ICE_INTERFACE_FILTER, empty uses all of them
+	ICEInterfaces []string
+	// ICEDisconnectedTimeout is how many seconds without traffic ICE waits before it reports a
+	// connection as disconnected, from ICE_DISCONNECTED_TIMEOUT
+	ICEDisconnectedTimeout int
+	// TURNSecret enables time-limited TURN credentials when set, see GenerateTURNCredentials
+	TURNSecret string
+	// TURNCredentialTTL is how long generated TURN credentials stay valid, in seconds
+	TURNCredentialTTL int
+	// MaxDataChannelMessageSize is the largest data channel message accepted, in bytes
+	MaxDataChannelMessageSize int
+	// CompressLevel is the COMPRESS_LEVEL of API responses from 1, fastest, to 9, best, 0 uses Fiber's default
+	CompressLevel int
+	// MaxBatchUpload is the most files POST /files/batch-upload accepts in one request
+	MaxBatchUpload int
+	// CORSMaxAge is how long browsers may cache the answer to a CORS preflight, in seconds
+	CORSMaxAge int
+	// ServerReadTimeout, ServerWriteTimeout and ServerIdleTimeout bound how long a client may take to
+	// send a request, to read the response and to keep an idle connection, from SERVER_READ_TIMEOUT,
+	// SERVER_WRITE_TIMEOUT and SERVER_IDLE_TIMEOUT. They keep slow clients from holding connections open.
+	// The write timeout is a deadline for the whole response, so it is 0, unlimited, unless set: GET
+	// /events, GET /sessions/:uuid/signaling, the bundle and the downloads of long recordings stream for longer.
+	ServerReadTimeout  time.Duration
+	ServerWriteTimeout time.Duration
+	ServerIdleTimeout  time.Duration
+	// ServerBodyLimit is the largest request body in bytes, from SERVER_BODY_LIMIT. It defaults to
+	// Fiber's 4MB, which takes the uploads of PUT /files/:uuid/video and POST /files/batch-upload.
+	ServerBodyLimit int
+	// AudioSampleRate is the AUDIO_SAMPLE_RATE audio is recorded at, 8000, 16000 or 48000 Hz. Opus
+	// keeps its 48 kHz RTP clock whatever the rate, the answer asks the client to encode no wider
+	// than the rate and the Ogg files name it as their input sample rate.
+	AudioSampleRate uint32
+	// SilenceThresholdDB is the level in dBFS below which GET /files/:uuid/silence counts audio as silent
+	SilenceThresholdDB float64
+	// VideoSegmentDuration splits the video recording into files of about this length, 0 keeps a single file
+	VideoSegmentDuration time.Duration
+	// AudioSegmentDuration does the same for audio, it defaults to VideoSegmentDuration
+	AudioSegmentDuration time.Duration
+	// AdminToken is the bearer token of the endpoints under /admin, they are disabled without it
+	AdminToken string
+	// ListingRequiresAuth makes GET /getFiles take ADMIN_TOKEN as well, from LISTING_REQUIRES_AUTH
+	ListingRequiresAuth bool
+	// ForwardAllowedNetworks are the networks POST /admin/sessions/:uuid/forward may send RTP to, from
+	// the comma separated addresses and CIDR prefixes of FORWARD_ALLOWED_NETWORKS. Empty allows any
+	// public unicast address, see forwardTarget.
+	ForwardAllowedNetworks []netip.Prefix
+	// DryRun negotiates sessions and keeps their metadata but discards the received media
+	DryRun bool
+	// MaxVideoFPS is the most video frames per second recorded, from MAX_VIDEO_FPS, 0 records every frame
+	MaxVideoFPS int
+	// SaveKeyframes stores every received video keyframe next to the recording, see keyframeSaver
+	SaveKeyframes bool
+	// PlaybackKeyframeCache answers a PLI of a viewer of /video with the last VP8 keyframe played, see keyframeCache
+	PlaybackKeyframeCache bool
+	// VP9Profile is the VP9_PROFILE, 0 or 2, that the VP9 track of /video is offered with. Profile 2
+	// carries the 10-bit HDR video of recordings made with it, profile 0 is 8-bit.
+	VP9Profile int
+	// WhisperURL is the transcription endpoint of a local Whisper server, such as the /inference of whisper.cpp
+	WhisperURL string
+	// OpenAIAPIKey transcribes with the OpenAI API when WhisperURL is not set
+	OpenAIAPIKey string
+	// ArchivePath is where recordings are moved once their session ended, empty keeps them in files/
+	ArchivePath string
+	// ArchiveDelay is how long a recording stays in files/ after its session ended before it is archived
+	ArchiveDelay time.Duration
+	// ICECandidateTypes limits the ICE candidates exchanged with clients to these types, empty allows all
+	ICECandidateTypes []string
+	// ICECandidateLog logs every ICE candidate the server gathers, at debug level
+	ICECandidateLog bool
+	// RecordingQuality is the RECORDING_QUALITY preset of sessions that do not choose one, empty registers no preset
+	RecordingQuality recordingQuality
+
+	// EnableWebTransport starts the WebTransport signaling server next to the HTTP API
+	EnableWebTransport bool
+	// QUICPort is the UDP port of the WebTransport server
+	QUICPort int
+	// QUICCert and QUICKey are the PEM files of the TLS certificate used by the WebTransport server
+	QUICCert string
+	QUICKey  string
+}
+
+const (
+	minICEMTU = 1200
+	maxICEMTU = 65535
+)
+
+func loadConfig() (Config, error) {
+	cfg := Config{
+		STUNURLs:                  []string{"stun:stun.l.google.com:19302"},
+		TURNURLs:                  listEnv("TURN_URLS"),
+		TURNUsername:              os.Getenv("TURN_USERNAME"),
+		TURNPassword:              os.Getenv("TURN_PASSWORD"),
+		ICETransportPolicy:        webrtc.ICETransportPolicyAll,
+		TURNSecret:                os.Getenv("TURN_SECRET"),
+		TURNCredentialTTL:         86400,
+		MaxDataChannelMessageSize: 64 * 1024,
+		MaxBatchUpload:            10,
+		CORSMaxAge:                86400,
+		ServerReadTimeout:         30 * time.Second,
+		ServerIdleTimeout:         120 * time.Second,
+		ServerBodyLimit:           4 * 1024 * 1024,
+		ICEDisconnectedTimeout:    8,
+		SilenceThresholdDB:        -40,
+		AudioSampleRate:           opusClockRate,
+		AdminToken:                os.Getenv("ADMIN_TOKEN"),
+		ListingRequiresAuth:       os.Getenv("LISTING_REQUIRES_AUTH") == "true",
+		DryRun:                    os.Getenv("DRY_RUN") == "true",
+		SaveKeyframes:             os.Getenv("SAVE_KEYFRAMES") == "true",
+		PlaybackKeyframeCache:     os.Getenv("PLAYBACK_KEYFRAME_CACHE") == "true",
+		ICECandidateTypes:         listEnv("ICE_CANDIDATE_TYPES"),
+		ICEInterfaces:             listEnv("ICE_INTERFACE_FILTER"),
+		ICECandidateLog:           os.Getenv("ICE_CANDIDATE_LOG") == "true",
+		WhisperURL:                os.Getenv("WHISPER_URL"),
+		OpenAIAPIKey:              os.Getenv("OPENAI_API_KEY"),
+		ArchivePath:               os.Getenv("ARCHIVE_PATH"),
+		ArchiveDelay:              time.Hour,
+		EnableWebTransport:        os.Getenv("ENABLE_WEBTRANSPORT") == "true",
+		QUICPort:                  4433,
+		QUICCert:                  os.Getenv("QUIC_CERT"),
+		QUICKey:                   os.Getenv("QUIC_KEY"),
+	}
+
+	if _, ok := os.LookupEnv("STUN_URLS"); ok {
+		cfg.STUNURLs = listEnv("STUN_URLS")
+	}
+	switch policy := os.Getenv("ICE_TRANSPORT_POLICY"); policy {
+	case "", "all":
+	case "relay":
+		cfg.ICETransportPolicy = webrtc.ICETransportPolicyRelay
+		if len(cfg.TURNURLs) == 0 {
+			return cfg, fmt.Errorf("ICE_TRANSPORT_POLICY=relay requires TURN_URLS")
+		}
+	default:
+		return cfg, fmt.Errorf("ICE_TRANSPORT_POLICY must be all or relay, got %q", policy)
+	}
+	for _, typ := range cfg.ICECandidateTypes {
+		if !slices.Contains(iceCandidateTypes, typ) {
+			return cfg, fmt.Errorf("ICE_CANDIDATE_TYPES must list types out of %s, got %q", strings.Join(iceCandidateTypes, ","), typ)
+		}
+	}
+	if v := os.Getenv("SILENCE_THRESHOLD_DB"); v != "" {
+		threshold, err := strconv.ParseFloat(v, 64)
+		if err != nil || threshold >= 0 || math.IsInf(threshold, 0) {
+			return cfg, fmt.Errorf("SILENCE_THRESHOLD_DB must be a negative number of dB, got %q", v)
+		}
+		cfg.SilenceThresholdDB = threshold
+	}
+	switch v := os.Getenv("AUDIO_SAMPLE_RATE"); v {
+	case "":
+	case "8000", "16000", "48000":
+		rate, _ := strconv.Atoi(v)
+		cfg.AudioSampleRate = uint32(rate)
+	default:
+		return cfg, fmt.Errorf("AUDIO_SAMPLE_RATE must be 8000, 16000 or 48000, got %q", v)
+	}
+	switch v := os.Getenv("VP9_PROFILE"); v {
+	case "", "0":
+	case "2":
+		cfg.VP9Profile = 2
+	default:
+		return cfg, fmt.Errorf("VP9_PROFILE must be 0 or 2, got %q", v)
+	}
+	for _, network := range listEnv("FORWARD_ALLOWED_NETWORKS") {
+		prefix, err := netip.ParsePrefix(network)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(network)
+			if addrErr != nil {
+				return cfg, fmt.Errorf("FORWARD_ALLOWED_NETWORKS must list addresses or CIDR prefixes, got %q", network)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		cfg.ForwardAllowedNetworks = append(cfg.ForwardAllowedNetworks, prefix.Masked())
+	}
+	quality, err := parseRecordingQuality(os.Getenv("RECORDING_QUALITY"))
+	if err != nil {
+		return cfg, fmt.Errorf("RECORDING_QUALITY: %w", err)
+	}
+	cfg.RecordingQuality = quality
+	if err := positiveIntEnv("ICE_MTU", &cfg.ICEMTU); err != nil {
+		return cfg, err
+	}
+	// Browsers send RTP packets of up to 1200 bytes, a smaller buffer would truncate them
+	if cfg.ICEMTU != 0 && (cfg.ICEMTU < minICEMTU || cfg.ICEMTU > maxICEMTU) {
+		return cfg, fmt.Errorf("ICE_MTU must be between %d and %d, got %d", minICEMTU, maxICEMTU, cfg.ICEMTU)
+	}
+	if err := positiveDurationEnv("VIDEO_SEGMENT_DURATION", &cfg.VideoSegmentDuration); err != nil {
+		return cfg, err
+	}
+	cfg.AudioSegmentDuration = cfg.VideoSegmentDuration
+	if err := positiveDurationEnv("AUDIO_SEGMENT_DURATION", &cfg.AudioSegmentDuration); err != nil {
+		return cfg, err
+	}
+	if err := positiveIntEnv("TURN_CREDENTIAL_TTL", &cfg.TURNCredentialTTL); err != nil {
+		return cfg, err
+	}
+	if err := positiveIntEnv("MAX_DATA_CHANNEL_MESSAGE_SIZE", &cfg.MaxDataChannelMessageSize); err != nil {
+		return cfg, err
+	}
+	if err := positiveDurationEnv("ARCHIVE_DELAY", &cfg.ArchiveDelay); err != nil {
+		return cfg, err
+	}
+	if err := positiveIntEnv("COMPRESS_LEVEL", &cfg.CompressLevel); err != nil {
+		return cfg, err
+	}
+	if cfg.CompressLevel > 9 {
+		return cfg, fmt.Errorf("COMPRESS_LEVEL must be between 1 and 9, got %d", cfg.CompressLevel)
+	}
+	if err := positiveIntEnv("MAX_BATCH_UPLOAD", &cfg.MaxBatchUpload); err != nil {
+		return cfg, err
+	}
+	if err := positiveIntEnv("MAX_VIDEO_FPS", &cfg.MaxVideoFPS); err != nil {
+		return cfg, err
+	}
+	if err := positiveIntEnv("CORS_MAX_AGE", &cfg.CORSMaxAge); err != nil {
+		return cfg, err
+	}
+	if err := positiveIntEnv("ICE_DISCONNECTED_TIMEOUT", &cfg.ICEDisconnectedTimeout); err != nil {
+		return cfg, err
+	}
+	if err := positiveDurationEnv("SERVER_READ_TIMEOUT", &cfg.ServerReadTimeout); err != nil {
+		return cfg, err
+	}
+	if err := nonNegativeDurationEnv("SERVER_WRITE_TIMEOUT", &cfg.ServerWriteTimeout); err != nil {
+		return cfg, err
+	}
+	if err := positiveDurationEnv("SERVER_IDLE_TIMEOUT", &cfg.ServerIdleTimeout); err != nil {
+		return cfg, err
+	}
+	if err := positiveIntEnv("SERVER_BODY_LIMIT", &cfg.ServerBodyLimit); err != nil {
+		return cfg, err
+	}
+	if err := positiveIntEnv("QUIC_PORT", &cfg.QUICPort); err != nil {
+		return cfg, err
+	}
+	if cfg.ListingRequiresAuth && cfg.AdminToken == "" {
+		return cfg, fmt.Errorf("LISTING_REQUIRES_AUTH requires ADMIN_TOKEN")
+	}
+	if cfg.EnableWebTransport && (cfg.QUICCert == "" || cfg.QUICKey == "") {
+		return cfg, fmt.Errorf("ENABLE_WEBTRANSPORT requires QUIC_CERT and QUIC_KEY")
+	}
+
+	return cfg, nil
+}
+
+// positiveIntEnv overwrites dst with the variable name when it is set, which must then be a positive integer
+func positiveIntEnv(name string, dst *int) error {
+	v := os.Getenv(name)
+	if v == "" {
+		return nil
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return fmt.Errorf("%s must be a positive integer, got %q", name, v)
+	}
+	*dst = n
+	return nil
+}
+
+// positiveDurationEnv overwrites dst with the variable name when it is set, which must then be a positive duration such as "5m"
+func positiveDurationEnv(name string, dst *time.Duration) error {
+	v := os.Getenv(name)
+	if v == "" {
+		return nil
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return fmt.Errorf("%s must be a positive duration, got %q", name, v)
+	}
+	*dst = d
+	return nil
+}
+
+// nonNegativeDurationEnv is positiveDurationEnv for durations where 0 turns the limit off
+func nonNegativeDurationEnv(name string, dst *time.Duration) error {
+	v := os.Getenv(name)
+	if v == "" {
+		return nil
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return fmt.Errorf("%s must be a duration of 0 or more, got %q", name, v)
+	}
+	*dst = d
+	return nil
+}
+
+// listEnv splits the comma separated variable name, leaving out empty entries
+func listEnv(name string) []string {
+	var list []string
+	for _, v := range strings.Split(os.Getenv(name), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
@@ -0,0 +1,30 @@
+package main
+
+import "github.com/pion/webrtc/v3"
+
+// PeerConnectionInterface holds the methods of *webrtc.PeerConnection the playback handler uses,
+// so tests can drive the handlers with a TestConnection instead of a real WebRTC stack.
+// LocalDescription is needed on top of the offer/answer methods to send the answer back.
+type PeerConnectionInterface interface {
+	AddTrack(track webrtc.TrackLocal) (*webrtc.RTPSender, error)
+	OnTrack(f func(*webrtc.TrackRemote, *webrtc.RTPReceiver))
+	SetRemoteDescription(desc webrtc.SessionDescription) error
+	CreateAnswer(options *webrtc.AnswerOptions) (webrtc.SessionDescription, error)
+	SetLocalDescription(desc webrtc.SessionDescription) error
+	LocalDescription() *webrtc.SessionDescription
+	OnICEConnectionStateChange(f func(webrtc.ICEConnectionState))
+	Close() error
+}
+
+var _ PeerConnectionInterface = (*webrtc.PeerConnection)(nil)
+
+// gatheringComplete returns a channel closed once pc gathered all its ICE candidates. Only a real
+// peer connection gathers candidates, for anything else the channel is closed right away.
+func gatheringComplete(pc PeerConnectionInterface) <-chan struct{} {
+	if real, ok := pc.(*webrtc.PeerConnection); ok {
+		return webrtc.GatheringCompletePromise(real)
+	}
+	done := make(chan struct{})
+	close(done)
+	return done
+}
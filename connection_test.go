@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media/oggwriter"
+)
+
+// TestConnection is a PeerConnectionInterface without a network. It records the tracks and
+// descriptions it is given and answers every offer with Answer, which defaults to an empty SDP.
+// AddTrack returns a nil RTPSender as there is no transport to read RTCP from.
+type TestConnection struct {
+	Answer webrtc.SessionDescription
+
+	mu                         sync.Mutex
+	tracks                     []webrtc.TrackLocal
+	remote, local              *webrtc.SessionDescription
+	onTrack                    func(*webrtc.TrackRemote, *webrtc.RTPReceiver)
+	onICEConnectionStateChange func(webrtc.ICEConnectionState)
+	closed                     bool
+}
+
+var _ PeerConnectionInterface = (*TestConnection)(nil)
+
+func (t *TestConnection) AddTrack(track webrtc.TrackLocal) (*webrtc.RTPSender, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return nil, webrtc.ErrConnectionClosed
+	}
+	t.tracks = append(t.tracks, track)
+	return nil, nil
+}
+
+func (t *TestConnection) OnTrack(f func(*webrtc.TrackRemote, *webrtc.RTPReceiver)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.onTrack = f
+}
+
+func (t *TestConnection) SetRemoteDescription(desc webrtc.SessionDescription) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return webrtc.ErrConnectionClosed
+	}
+	t.remote = &desc
+	return nil
+}
+
+func (t *TestConnection) CreateAnswer(*webrtc.AnswerOptions) (webrtc.SessionDescription, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.remote == nil {
+		return webrtc.SessionDescription{}, errors.New("no remote description to answer")
+	}
+	answer := t.Answer
+	answer.Type = webrtc.SDPTypeAnswer
+	return answer, nil
+}
+
+func (t *TestConnection) SetLocalDescription(desc webrtc.SessionDescription) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return webrtc.ErrConnectionClosed
+	}
+	t.local = &desc
+	return nil
+}
+
+func (t *TestConnection) LocalDescription() *webrtc.SessionDescription {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.local
+}
+
+func (t *TestConnection) OnICEConnectionStateChange(f func(webrtc.ICEConnectionState)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.onICEConnectionStateChange = f
+}
+
+func (t *TestConnection) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.closed = true
+	return nil
+}
+
+// SetICEConnectionState calls the OnICEConnectionStateChange handler as if ICE reached state
+func (t *TestConnection) SetICEConnectionState(state webrtc.ICEConnectionState) {
+	t.mu.Lock()
+	f := t.onICEConnectionStateChange
+	t.mu.Unlock()
+
+	if f != nil {
+		f(state)
+	}
+}
+
+// Tracks returns the tracks added so far
+func (t *TestConnection) Tracks() []webrtc.TrackLocal {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]webrtc.TrackLocal(nil), t.tracks...)
+}
+
+// RemoteDescription returns the offer the connection was given, nil before SetRemoteDescription
+func (t *TestConnection) RemoteDescription() *webrtc.SessionDescription {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.remote
+}
+
+// Closed reports whether Close was called
+func (t *TestConnection) Closed() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.closed
+}
+
+// writeTestIVF writes an IVF file of fourCC at 30 frames per second that holds no frames
+func writeTestIVF(t *testing.T, path, fourCC string) {
+	t.Helper()
+
+	header := make([]byte, ivfHeaderSize)
+	copy(header, "DKIF")
+	binary.LittleEndian.PutUint16(header[6:], ivfHeaderSize)
+	copy(header[8:], fourCC)
+	binary.LittleEndian.PutUint16(header[12:], 640)
+	binary.LittleEndian.PutUint16(header[14:], 480)
+	binary.LittleEndian.PutUint32(header[16:], 30)
+	binary.LittleEndian.PutUint32(header[20:], 1)
+	if err := os.WriteFile(path, header, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeTestOGG writes an Ogg Opus file that holds no packets
+func writeTestOGG(t *testing.T, path string) {
+	t.Helper()
+
+	w, err := oggwriter.New(path, opusClockRate, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// connectLoopback negotiates a connection between two peer connections of the test process, with
+// offerer sending the offer. Both are closed when the test ends.
+func connectLoopback(t *testing.T, offerer, answerer *webrtc.PeerConnection) {
+	t.Helper()
+	t.Cleanup(func() {
+		offerer.Close()
+		answerer.Close()
+	})
+
+	offer, err := offerer.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	offerGathered := webrtc.GatheringCompletePromise(offerer)
+	if err := offerer.SetLocalDescription(offer); err != nil {
+		t.Fatal(err)
+	}
+	<-offerGathered
+
+	if err := answerer.SetRemoteDescription(*offerer.LocalDescription()); err != nil {
+		t.Fatal(err)
+	}
+	answer, err := answerer.CreateAnswer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	answerGathered := webrtc.GatheringCompletePromise(answerer)
+	if err := answerer.SetLocalDescription(answer); err != nil {
+		t.Fatal(err)
+	}
+	<-answerGathered
+
+	if err := offerer.SetRemoteDescription(*answerer.LocalDescription()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewPlaybackSession(t *testing.T) {
+	dir := t.TempDir()
+	videoPath, audioPath := filepath.Join(dir, videoFileName), filepath.Join(dir, audioFileName)
+	writeTestIVF(t, videoPath, fourCCVP8)
+	writeTestOGG(t, audioPath)
+
+	conn := &TestConnection{Answer: webrtc.SessionDescription{SDP: "v=0\r\n"}}
+	offer := webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: "v=0\r\n"}
+	labels := trackLabels{StreamID: "stream", VideoTrackID: "camera", AudioTrackID: "mic"}
+	session, answer, err := NewPlaybackSession(context.Background(), Config{}, func() (PeerConnectionInterface, error) {
+		return conn, nil
+	}, videoPath, audioPath, labels, offer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Ends the playback, the tracks then play the files, which hold no media
+	t.Cleanup(func() { conn.SetICEConnectionState(webrtc.ICEConnectionStateClosed) })
+
+	if answer.Type != webrtc.SDPTypeAnswer || answer.SDP != conn.Answer.SDP {
+		t.Errorf("answer %+v, want the answer of the connection", answer)
+	}
+	if remote := conn.RemoteDescription(); remote == nil || *remote != offer {
+		t.Errorf("connection was given %+v, want the offer", remote)
+	}
+
+	tracks := conn.Tracks()
+	if len(tracks) != 2 {
+		t.Fatalf("got %d tracks, want video and audio", len(tracks))
+	}
+	for i, want := range []struct {
+		kind webrtc.RTPCodecType
+		id   string
+	}{{webrtc.RTPCodecTypeVideo, "camera"}, {webrtc.RTPCodecTypeAudio, "mic"}} {
+		if tracks[i].Kind() != want.kind || tracks[i].ID() != want.id || tracks[i].StreamID() != "stream" {
+			t.Errorf("track %d is %s %q of %q, want %s %q of \"stream\"", i, tracks[i].Kind(), tracks[i].ID(), tracks[i].StreamID(), want.kind, want.id)
+		}
+	}
+
+	if track, ok := playbacks.get(session.id); !ok || track != session.audioTrack {
+		t.Error("the audio track is not registered for POST /sessions/:uuid/dtmf")
+	}
+	conn.SetICEConnectionState(webrtc.ICEConnectionStateFailed)
+	if !conn.Closed() {
+		t.Error("the connection stayed open after ICE failed")
+	}
+	if _, ok := playbacks.get(session.id); ok {
+		t.Error("the playback stayed registered after ICE failed")
+	}
+}
+
+func TestNewPlaybackSessionWithoutFiles(t *testing.T) {
+	dir := t.TempDir()
+	conn := &TestConnection{}
+	_, _, err := NewPlaybackSession(context.Background(), Config{}, func() (PeerConnectionInterface, error) {
+		return conn, nil
+	}, filepath.Join(dir, videoFileName), filepath.Join(dir, audioFileName), defaultTrackLabels, webrtc.SessionDescription{Type: webrtc.SDPTypeOffer})
+	if err == nil {
+		t.Fatal("a playback of no files was answered")
+	}
+	if !conn.Closed() {
+		t.Error("the connection stayed open after the playback failed")
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pion/webrtc/v3"
+)
+
+// closeCodeMessageTooBig mirrors the WebSocket 1009 close code. Data channels have no close
+// codes on the wire, so this only shows up in our logs next to the rejected message size.
+const closeCodeMessageTooBig = 1009
+
+// limitMessageSize wraps a data channel message handler and closes the channel on
+// messages larger than maxSize instead of passing them on
+func limitMessageSize(dc *webrtc.DataChannel, sessionID string, maxSize int, next func(webrtc.DataChannelMessage)) func(webrtc.DataChannelMessage) {
+	return func(msg webrtc.DataChannelMessage) {
+		if len(msg.Data) > maxSize {
+			fmt.Printf("Session %s: closing data channel %q with code %d, message of %d bytes exceeds limit of %d\n", sessionID, dc.Label(), closeCodeMessageTooBig, len(msg.Data), maxSize)
+			if err := dc.Close(); err != nil {
+				fmt.Println(err)
+			}
+			return
+		}
+		next(msg)
+	}
+}
+
+// setupEchoDataChannel echoes back every message received on data channels opened by the remote
+func setupEchoDataChannel(peerConnection *webrtc.PeerConnection, sessionID string, maxMessageSize int) {
+	peerConnection.OnDataChannel(func(dc *webrtc.DataChannel) {
+		// Reliable ordered is the default mode: ordered, with no retransmit or lifetime limit
+		reliable := dc.Ordered() && dc.MaxRetransmits() == nil && dc.MaxPacketLifeTime() == nil
+		fmt.Printf("Session %s: data channel %q opened (reliable ordered: %t)\n", sessionID, dc.Label(), reliable)
+
+		echoMessages(dc, sessionID, maxMessageSize)
+	})
+}
+
+func echoMessages(dc *webrtc.DataChannel, sessionID string, maxMessageSize int) {
+	dc.OnMessage(limitMessageSize(dc, sessionID, maxMessageSize, func(msg webrtc.DataChannelMessage) {
+		var err error
+		if msg.IsString {
+			err = dc.SendText(string(msg.Data))
+		} else {
+			err = dc.Send(msg.Data)
+		}
+		if err != nil {
+			fmt.Println(err)
+		}
+	}))
+}
+
+// handleOpenChannel opens a data channel from the server side of a live session.
+//
+// The body holds the label and the optional RTCDataChannelInit fields ordered (default true),
+// maxRetransmits and maxPacketLifeTime (milliseconds), of which at most one may be set:
+//
+//	{"label":"chat","maxRetransmits":3,"ordered":false}
+//
+// The session must have negotiated a data channel in its offer, the new channel reuses that SCTP
+// association and needs no renegotiation. Like the channels opened by the client it echoes every
+// message and is closed on messages larger than MAX_DATA_CHANNEL_MESSAGE_SIZE. The response
+// describes the channel, including the maxMessageSize the remote advertised with a=max-message-size.
+func handleOpenChannel(cfg Config) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := c.Params("uuid")
+		if !isUUID(id) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid session id"})
+		}
+
+		var body struct {
+			Label             string  `json:"label"`
+			Ordered           *bool   `json:"ordered"`
+			MaxRetransmits    *uint16 `json:"maxRetransmits"`
+			MaxPacketLifeTime *uint16 `json:"maxPacketLifeTime"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid body"})
+		}
+		if body.Label == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "label is required"})
+		}
+		if body.MaxRetransmits != nil && body.MaxPacketLifeTime != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "maxRetransmits and maxPacketLifeTime cannot both be set"})
+		}
+
+		session, ok := sessions.get(id)
+		if !ok {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "session not found"})
+		}
+		pc := session.peerConnection
+		if pc == nil || pc.ConnectionState() == webrtc.PeerConnectionStateClosed {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "session is not live"})
+		}
+		if sctp := pc.SCTP(); sctp == nil || sctp.State() != webrtc.SCTPTransportStateConnected {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "session has no data channel transport, the offer must include a data channel"})
+		}
+
+		dc, err := pc.CreateDataChannel(body.Label, &webrtc.DataChannelInit{
+			Ordered:           body.Ordered,
+			MaxRetransmits:    body.MaxRetransmits,
+			MaxPacketLifeTime: body.MaxPacketLifeTime,
+		})
+		if err != nil {
+			return err
+		}
+		echoMessages(dc, session.id, cfg.MaxDataChannelMessageSize)
+		fmt.Printf("Session %s: opened data channel %q from the server\n", session.id, dc.Label())
+
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+			"label":             dc.Label(),
+			"id":                dc.ID(),
+			"ordered":           dc.Ordered(),
+			"maxRetransmits":    dc.MaxRetransmits(),
+			"maxPacketLifeTime": dc.MaxPacketLifeTime(),
+			"maxMessageSize":    pc.SCTP().GetCapabilities().MaxMessageSize,
+		})
+	}
+}
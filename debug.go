@@ -0,0 +1,32 @@
+package main
+
+import (
+	"os"
+	"runtime"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// openFDs counts the open file descriptors of the process from /proc/self/fd, -1 where there is no
+// such directory. The descriptor opened to read the directory is not counted.
+func openFDs() int {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return -1
+	}
+	return len(entries) - 1
+}
+
+// handleDebugGC runs a garbage collection and reports what is left, so a load test can check that
+// closed sessions leave no goroutines or files behind
+func handleDebugGC(c *fiber.Ctx) error {
+	runtime.GC()
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	return c.JSON(fiber.Map{
+		"heapAlloc":  mem.HeapAlloc,
+		"goroutines": runtime.NumGoroutine(),
+		"openFDs":    openFDs(),
+	})
+}
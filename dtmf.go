@@ -0,0 +1,264 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media"
+)
+
+const (
+	mimeTypeTelephoneEvent = "audio/telephone-event"
+	// telephoneEventPayloadType is the payload type telephone-event/48000 is registered with for
+	// playback, the answer uses the one of the offer
+	telephoneEventPayloadType = 110
+	// dtmfPacketInterval is how often a tone is reported, once per Opus page of the playback
+	dtmfPacketInterval = oggPageDuration
+	// dtmfVolume is the power level of the tones, -10 dBm0
+	dtmfVolume = 10
+	// dtmfEndPackets is how often the packet ending a tone is sent, RFC 4733 asks for three
+	dtmfEndPackets  = 3
+	minDTMFDuration = 40
+	// maxDTMFDuration keeps a tone within the 16 bit duration field at 48 kHz
+	maxDTMFDuration = 1000
+)
+
+var errNoTelephoneEvent = errors.New("client did not negotiate telephone-event/48000")
+
+// dtmfEvent returns the RFC 4733 event code of a DTMF digit: 0-9, * and #, A-D
+func dtmfEvent(digit byte) (uint8, bool) {
+	switch {
+	case digit >= '0' && digit <= '9':
+		return digit - '0', true
+	case digit == '*':
+		return 10, true
+	case digit == '#':
+		return 11, true
+	case digit >= 'A' && digit <= 'D':
+		return 12 + digit - 'A', true
+	}
+	return 0, false
+}
+
+// GenerateDTMFPackets creates the RFC 4733 (formerly RFC 2833) telephone-event packets of a tone
+// of digit lasting durationMs, one per dtmfPacketInterval with the duration so far, the last one
+// marking the end sent dtmfEndPackets times. Sequence numbers count from 0 and the timestamp, the
+// start of the tone, is 0, the sender offsets both. It returns nil for anything but a DTMF digit.
+func GenerateDTMFPackets(digit byte, durationMs int, sampleRate int) []rtp.Packet {
+	event, ok := dtmfEvent(digit)
+	if !ok || durationMs <= 0 {
+		return nil
+	}
+	total := min(durationMs*sampleRate/1000, 0xffff)
+	step := sampleRate * int(dtmfPacketInterval/time.Millisecond) / 1000
+
+	var packets []rtp.Packet
+	add := func(duration int, end bool) {
+		flags := byte(dtmfVolume)
+		if end {
+			flags |= 0x80
+		}
+		packets = append(packets, rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				Marker:         len(packets) == 0,
+				SequenceNumber: uint16(len(packets)),
+			},
+			Payload: []byte{event, flags, byte(duration >> 8), byte(duration)},
+		})
+	}
+	for duration := step; duration < total; duration += step {
+		add(duration, false)
+	}
+	for i := 0; i < dtmfEndPackets; i++ {
+		add(total, true)
+	}
+	return packets
+}
+
+// dtmfTrackBinding is where an opusDTMFTrack sends to once negotiated
+type dtmfTrackBinding struct {
+	id          string
+	ssrc        webrtc.SSRC
+	opusType    webrtc.PayloadType
+	eventType   webrtc.PayloadType
+	hasEvents   bool
+	writeStream webrtc.TrackLocalWriter
+}
+
+// opusDTMFTrack sends Opus samples like a TrackLocalStaticSample and telephone-events in between,
+// on the same SSRC and sequence numbers. The static tracks of pion rewrite the payload type of
+// every packet to the one of their codec, which leaves no way to send telephone-events with them.
+type opusDTMFTrack struct {
+	id, streamID string
+
+	mu        sync.Mutex
+	binding   *dtmfTrackBinding
+	sequence  uint16
+	timestamp uint32
+	// dtmf are the telephone-event packets waiting for the next sample
+	dtmf []rtp.Packet
+}
+
+func newOpusDTMFTrack(id, streamID string) *opusDTMFTrack {
+	return &opusDTMFTrack{id: id, streamID: streamID, sequence: uint16(rand.Uint32()), timestamp: rand.Uint32()}
+}
+
+func (t *opusDTMFTrack) Bind(ctx webrtc.TrackLocalContext) (webrtc.RTPCodecParameters, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var (
+		opus    webrtc.RTPCodecParameters
+		hasOpus bool
+		binding = &dtmfTrackBinding{id: ctx.ID(), ssrc: ctx.SSRC(), writeStream: ctx.WriteStream()}
+	)
+	for _, codec := range ctx.CodecParameters() {
+		switch {
+		case !hasOpus && strings.EqualFold(codec.MimeType, webrtc.MimeTypeOpus):
+			opus, hasOpus = codec, true
+		case !binding.hasEvents && strings.EqualFold(codec.MimeType, mimeTypeTelephoneEvent) && codec.ClockRate == opusClockRate:
+			binding.eventType, binding.hasEvents = codec.PayloadType, true
+		}
+	}
+	if !hasOpus {
+		return webrtc.RTPCodecParameters{}, webrtc.ErrUnsupportedCodec
+	}
+	binding.opusType = opus.PayloadType
+	t.binding = binding
+	return opus, nil
+}
+
+func (t *opusDTMFTrack) Unbind(ctx webrtc.TrackLocalContext) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.binding != nil && t.binding.id == ctx.ID() {
+		t.binding = nil
+	}
+	return nil
+}
+
+func (t *opusDTMFTrack) ID() string                { return t.id }
+func (t *opusDTMFTrack) RID() string               { return "" }
+func (t *opusDTMFTrack) StreamID() string          { return t.streamID }
+func (t *opusDTMFTrack) Kind() webrtc.RTPCodecType { return webrtc.RTPCodecTypeAudio }
+
+// WriteSample sends an Opus frame as one packet followed by the next waiting telephone-event.
+// Samples written before the track is negotiated are dropped.
+func (t *opusDTMFTrack) WriteSample(sample media.Sample) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.binding == nil {
+		return nil
+	}
+	header := &rtp.Header{Version: 2, PayloadType: uint8(t.binding.opusType), SequenceNumber: t.sequence, Timestamp: t.timestamp, SSRC: uint32(t.binding.ssrc)}
+	t.sequence++
+	t.timestamp += uint32(sample.Duration * opusClockRate / time.Second)
+	if _, err := t.binding.writeStream.WriteRTP(header, sample.Data); err != nil {
+		return err
+	}
+
+	if len(t.dtmf) == 0 {
+		return nil
+	}
+	event := t.dtmf[0]
+	t.dtmf = t.dtmf[1:]
+	event.PayloadType = uint8(t.binding.eventType)
+	event.SSRC = uint32(t.binding.ssrc)
+	event.SequenceNumber = t.sequence
+	t.sequence++
+	_, err := t.binding.writeStream.WriteRTP(&event.Header, event.Payload)
+	return err
+}
+
+// SendDTMF queues a tone of digit, it starts with the next sample and follows any queued tone
+func (t *opusDTMFTrack) SendDTMF(digit byte, durationMs int) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.binding == nil || !t.binding.hasEvents {
+		return errNoTelephoneEvent
+	}
+	// A tone keeps the timestamp of its start, a queued one starts once those before it are sent
+	start := t.timestamp + uint32(len(t.dtmf))*uint32(dtmfPacketInterval*opusClockRate/time.Second)
+	for _, packet := range GenerateDTMFPackets(digit, durationMs, opusClockRate) {
+		packet.Timestamp = start
+		t.dtmf = append(t.dtmf, packet)
+	}
+	return nil
+}
+
+// playbackRegistry holds the audio tracks of the running /video playbacks by playback id
+type playbackRegistry struct {
+	mu     sync.Mutex
+	tracks map[string]*opusDTMFTrack
+}
+
+var playbacks = &playbackRegistry{tracks: map[string]*opusDTMFTrack{}}
+
+func (r *playbackRegistry) add(id string, track *opusDTMFTrack) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.tracks[id] = track
+}
+
+func (r *playbackRegistry) remove(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.tracks, id)
+}
+
+func (r *playbackRegistry) get(id string) (*opusDTMFTrack, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	track, ok := r.tracks[id]
+	return track, ok
+}
+
+// handleDTMF plays a DTMF tone on the audio of a /video playback, the id is the X-Session-Id
+// header of its answer. The body holds the digit and the optional durationMs, 160 by default:
+//
+//	{"digit":"5","durationMs":160}
+func handleDTMF(c *fiber.Ctx) error {
+	id := c.Params("uuid")
+	if !isUUID(id) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid session id"})
+	}
+
+	body := struct {
+		Digit      string `json:"digit"`
+		DurationMs int    `json:"durationMs"`
+	}{DurationMs: 160}
+	if err := c.BodyParser(&body); err != nil || len(body.Digit) != 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "digit must be one of 0-9, *, #, A-D"})
+	}
+	if _, ok := dtmfEvent(body.Digit[0]); !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "digit must be one of 0-9, *, #, A-D"})
+	}
+	if body.DurationMs < minDTMFDuration || body.DurationMs > maxDTMFDuration {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "durationMs must be between 40 and 1000"})
+	}
+
+	track, ok := playbacks.get(id)
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "playback not found"})
+	}
+	if err := track.SendDTMF(body.Digit[0], body.DurationMs); err != nil {
+		if errors.Is(err, errNoTelephoneEvent) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+		}
+		return err
+	}
+	return c.SendStatus(fiber.StatusAccepted)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pion/webrtc/v3/pkg/media"
+)
+
+const eventLogFileName = "events.jsonl"
+
+// eventLogMu keeps lines of concurrent appends from interleaving
+var eventLogMu sync.Mutex
+
+// sessionLogEntry is one line of events.jsonl
+type sessionLogEntry struct {
+	TS       time.Time `json:"ts"`
+	Event    string    `json:"event"`
+	Metadata any       `json:"metadata,omitempty"`
+}
+
+// AppendSessionEvent appends an event with its metadata to events.jsonl in the session directory
+// dir. Unlike session.json, which holds the current state, the log keeps every event as it happened.
+func AppendSessionEvent(dir, event string, meta any) error {
+	b, err := json.Marshal(sessionLogEntry{TS: time.Now().UTC(), Event: event, Metadata: meta})
+	if err != nil {
+		return err
+	}
+
+	eventLogMu.Lock()
+	defer eventLogMu.Unlock()
+	file, err := os.OpenFile(filepath.Join(dir, eventLogFileName), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(b, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// logEvent appends an event to the log of the session, failures are only logged
+func (s *recordingSession) logEvent(event string, meta any) {
+	if err := AppendSessionEvent(s.dir, event, meta); err != nil {
+		fmt.Printf("Session %s: cannot log %s: %v\n", s.id, event, err)
+	}
+}
+
+// firstSampleLogger is a MediaPipeline stage logging event once the first sample of a track went through
+type firstSampleLogger struct {
+	session *recordingSession
+	event   string
+	once    sync.Once
+}
+
+func (f *firstSampleLogger) ProcessSample(sample media.Sample, codec string) error {
+	f.once.Do(func() {
+		f.session.logEvent(f.event, fiber.Map{"codec": codec, "sizeBytes": len(sample.Data)})
+	})
+	return nil
+}
+
+func (f *firstSampleLogger) Close() error { return nil }
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// eventBufferSize is how many events a subscriber may fall behind before further events are dropped for it
+const eventBufferSize = 64
+
+// serverEvent is one event of GET /events, data is sent as JSON and always holds the session id
+type serverEvent struct {
+	typ  string
+	data fiber.Map
+}
+
+// eventBroker hands the events of all sessions to every GET /events stream
+type eventBroker struct {
+	mu          sync.Mutex
+	subscribers map[chan serverEvent]struct{}
+}
+
+var events = &eventBroker{subscribers: map[chan serverEvent]struct{}{}}
+
+func (b *eventBroker) subscribe() chan serverEvent {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan serverEvent, eventBufferSize)
+	b.subscribers[ch] = struct{}{}
+	return ch
+}
+
+func (b *eventBroker) unsubscribe(ch chan serverEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.subscribers, ch)
+}
+
+// publish sends an event about session id to every subscriber, a subscriber that is too far behind misses it
+// rather than holding up the session
+func (b *eventBroker) publish(typ, id string, data fiber.Map) {
+	payload := fiber.Map{"id": id}
+	for k, v := range data {
+		payload[k] = v
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- serverEvent{typ: typ, data: payload}:
+		default:
+		}
+	}
+}
+
+// handleEvents streams the events of all sessions as server-sent events, for dashboards that follow
+// sessions without polling:
+//
+//	event: session.created     a session was created by POST / or POST /sessions
+//	event: session.connected   ICE connected
+//	event: session.recording   a track started recording, with its kind and codec
+//	event: session.closed      the session ended, with the teardown reason
+//	event: session.error       recording a track failed, with its kind and the error
+//	event: session.reconnected a client resumed the session with reconnect
+//
+// Each event carries a JSON object with the session id in id. SERVER_WRITE_TIMEOUT ends the stream,
+// EventSource connects again on its own.
+func handleEvents(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		ch := events.subscribe()
+		defer events.unsubscribe(ch)
+		// fasthttp sends the headers with the first data, a comment tells the client it is subscribed
+		fmt.Fprint(w, ": subscribed\n\n")
+		if err := w.Flush(); err != nil {
+			return
+		}
+
+		ticker := time.NewTicker(signalingKeepalive)
+		defer ticker.Stop()
+		for {
+			select {
+			case event := <-ch:
+				b, err := json.Marshal(event.data)
+				if err != nil {
+					fmt.Println("Cannot encode event:", err)
+					continue
+				}
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.typ, b)
+			case <-ticker.C:
+				fmt.Fprint(w, ": keepalive\n\n")
+			}
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	})
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/pion/rtp"
+)
+
+// fanOutBuffer is how many packets a subscriber may fall behind before the track is read slower
+const fanOutBuffer = 256
+
+// PacketFanOut hands every RTP packet of a track to each of its subscribers, such as the disk
+// writer, the forwarder and the stats. Subscribers share the packets and must not modify them.
+type PacketFanOut struct {
+	mu          sync.Mutex
+	subscribers []chan *rtp.Packet
+}
+
+func NewPacketFanOut() *PacketFanOut {
+	return &PacketFanOut{}
+}
+
+// Subscribe returns a channel receiving every packet published from now on, closed by Close.
+// A subscriber that falls behind by more than fanOutBuffer packets holds up Publish, so none
+// loses packets.
+func (f *PacketFanOut) Subscribe() <-chan *rtp.Packet {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ch := make(chan *rtp.Packet, fanOutBuffer)
+	f.subscribers = append(f.subscribers, ch)
+	return ch
+}
+
+// Publish sends packet to every subscriber
+func (f *PacketFanOut) Publish(packet *rtp.Packet) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, ch := range f.subscribers {
+		ch <- packet
+	}
+}
+
+// Close ends every subscription once the track ended
+func (f *PacketFanOut) Close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, ch := range f.subscribers {
+		close(ch)
+	}
+	f.subscribers = nil
+}
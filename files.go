@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"os"
+	"path/filepath"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	filesDir      = "files"
+	ivfHeaderSize = 32
+)
+
+var (
+	errCorruptRecording = errors.New("corrupt recording")
+	// errIncompatibleRecordings means two recordings cannot be combined, e.g. because their codecs differ
+	errIncompatibleRecordings = errors.New("incompatible recordings")
+)
+
+// recordingPath returns the path of a file inside the session directory for id
+func recordingPath(id, name string) string {
+	return filepath.Join(filesDir, id, name)
+}
+
+// validateMediaFile checks that the file at path starts with the magic signature of its container
+func validateMediaFile(path, magic string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	signature := make([]byte, len(magic))
+	if _, err := io.ReadFull(file, signature); err != nil {
+		return fmt.Errorf("%w: file too short for %q signature: %v", errCorruptRecording, magic, err)
+	}
+	if string(signature) != magic {
+		return fmt.Errorf("%w: bad signature %q, expected %q", errCorruptRecording, signature, magic)
+	}
+	return nil
+}
+
+// validateIVFFile checks the IVF file header: the DKIF signature followed by a version of 0
+func validateIVFFile(path string) error {
+	if err := validateMediaFile(path, "DKIF"); err != nil {
+		return err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	header := make([]byte, ivfHeaderSize)
+	if _, err := io.ReadFull(file, header); err != nil {
+		return fmt.Errorf("%w: short IVF header: %v", errCorruptRecording, err)
+	}
+	if version := binary.LittleEndian.Uint16(header[4:6]); version != 0 {
+		return fmt.Errorf("%w: unsupported IVF version %d", errCorruptRecording, version)
+	}
+	return nil
+}
+
+// validateOGGFile checks that the file starts with the Ogg capture pattern
+func validateOGGFile(path string) error {
+	return validateMediaFile(path, "OggS")
+}
+
+// sendError responds with a JSON body for *fiber.Error values and passes any other error on to Fiber
+func sendError(c *fiber.Ctx, err error) error {
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return c.Status(fiberErr.Code).JSON(fiber.Map{"error": fiberErr.Message})
+	}
+	return err
+}
+
+// recordingFile resolves the path of a file stored for session id.
+// When validate is set the file is checked first and a 422 is returned if it is corrupt.
+func recordingFile(id, name string, validate func(string) error) (string, error) {
+	if !isUUID(id) {
+		return "", fiber.NewError(fiber.StatusBadRequest, "invalid session id")
+	}
+
+	path := recordingPath(id, name)
+	if !fileExists(path) {
+		return "", fiber.NewError(fiber.StatusNotFound, "recording not found")
+	}
+
+	if validate != nil {
+		if err := validate(path); err != nil {
+			if !errors.Is(err, errCorruptRecording) {
+				return "", err
+			}
+			fmt.Printf("Refusing to serve %s: %v\n", path, err)
+			return "", fiber.NewError(fiber.StatusUnprocessableEntity, errCorruptRecording.Error())
+		}
+	}
+	return path, nil
+}
+
+// serveRecordingFile sends one of the files stored for the session in the :uuid route parameter.
+// SendFile answers with Accept-Ranges: bytes and serves a Range request as 206 Partial Content,
+// so players can seek without downloading the recording from the start. Streamed responses such
+// as ?format=raw of the audio support no ranges.
+func serveRecordingFile(c *fiber.Ctx, name, contentType string, validate func(string) error) error {
+	path, err := recordingFile(c.Params("uuid"), name, validate)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	if err := c.SendFile(path); err != nil {
+		return err
+	}
+	c.Set(fiber.HeaderContentType, contentType)
+	return nil
+}
+
+func handleVideoFile(c *fiber.Ctx) error {
+	return serveRecordingFile(c, videoFileName, "video/x-ivf", validateIVFFile)
+}
+
+// handleAudioFile serves the Ogg/Opus recording, or the bare Opus packets with ?format=raw
+func handleAudioFile(c *fiber.Ctx) error {
+	switch c.Query("format") {
+	case "", "ogg":
+		return serveRecordingFile(c, audioFileName, "audio/ogg", validateOGGFile)
+	case "raw":
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "unsupported format"})
+	}
+
+	path, err := recordingFile(c.Params("uuid"), audioFileName, validateOGGFile)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	c.Set(fiber.HeaderContentType, fiber.MIMEOctetStream)
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="output.opus.raw"`)
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		file, err := os.Open(path)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		defer file.Close()
+
+		if err := convertOGGToRawOpus(file, w); err != nil {
+			fmt.Println(err)
+			return
+		}
+		if err := w.Flush(); err != nil {
+			fmt.Println(err)
+		}
+	})
+	return nil
+}
+
+// handleBundle streams the video and audio of a recording as the parts of one multipart/mixed response
+func handleBundle(c *fiber.Ctx) error {
+	id := c.Params("uuid")
+	if !isUUID(id) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid session id"})
+	}
+
+	type bundlePart struct {
+		name, contentType string
+	}
+	var parts []bundlePart
+	for _, p := range []bundlePart{{videoFileName, "video/x-ivf"}, {audioFileName, "audio/ogg"}} {
+		if fileExists(recordingPath(id, p.name)) {
+			parts = append(parts, p)
+		}
+	}
+	if len(parts) == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "recording not found"})
+	}
+
+	boundary := "bundle-" + uuid.NewString()
+	c.Set(fiber.HeaderContentType, "multipart/mixed; boundary="+boundary)
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		mw := multipart.NewWriter(w)
+		if err := mw.SetBoundary(boundary); err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		for _, p := range parts {
+			header := textproto.MIMEHeader{}
+			header.Set(fiber.HeaderContentType, p.contentType)
+			header.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s"`, p.name))
+			part, err := mw.CreatePart(header)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+
+			file, err := os.Open(recordingPath(id, p.name))
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			_, err = io.Copy(part, file)
+			file.Close()
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+		}
+
+		if err := mw.Close(); err != nil {
+			fmt.Println(err)
+			return
+		}
+		if err := w.Flush(); err != nil {
+			fmt.Println(err)
+		}
+	})
+	return nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// newTestSessionDir runs the test in a temporary directory and creates the directory of a new
+// session under files/ in it, returning the session id
+func newTestSessionDir(t *testing.T) string {
+	t.Helper()
+	t.Chdir(t.TempDir())
+
+	id := uuid.NewString()
+	if err := os.MkdirAll(filepath.Join(filesDir, id), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// writeTestFile stores data as the file name of session id
+func writeTestFile(t *testing.T, id, name string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(recordingPath(id, name), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHandleBundle(t *testing.T) {
+	id := newTestSessionDir(t)
+	video, audio := []byte("DKIF video frames"), []byte("OggS audio pages")
+	writeTestFile(t, id, videoFileName, video)
+	writeTestFile(t, id, audioFileName, audio)
+
+	app := fiber.New()
+	app.Get("/files/:uuid/bundle", handleBundle)
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/files/"+id+"/bundle", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("status %d, want 200", resp.StatusCode)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(resp.Header.Get(fiber.HeaderContentType))
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("Content-Type %q (%v), want multipart/mixed", resp.Header.Get(fiber.HeaderContentType), err)
+	}
+
+	want := []struct {
+		name, contentType string
+		data              []byte
+	}{
+		{videoFileName, "video/x-ivf", video},
+		{audioFileName, "audio/ogg", audio},
+	}
+	r := multipart.NewReader(resp.Body, params["boundary"])
+	for _, w := range want {
+		part, err := r.NextPart()
+		if err != nil {
+			t.Fatalf("part %s: %v", w.name, err)
+		}
+		if got := part.FileName(); got != w.name {
+			t.Errorf("part file name %q, want %q", got, w.name)
+		}
+		if got := part.Header.Get(fiber.HeaderContentType); got != w.contentType {
+			t.Errorf("part %s Content-Type %q, want %q", w.name, got, w.contentType)
+		}
+		data, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != string(w.data) {
+			t.Errorf("part %s holds %q, want %q", w.name, data, w.data)
+		}
+	}
+	if _, err := r.NextPart(); err != io.EOF {
+		t.Errorf("after the audio part got %v, want io.EOF", err)
+	}
+}
+
+func TestHandleBundleNotFound(t *testing.T) {
+	id := newTestSessionDir(t)
+
+	app := fiber.New()
+	app.Get("/files/:uuid/bundle", handleBundle)
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/files/"+id+"/bundle", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusNotFound {
+		t.Errorf("status %d for a session without recordings, want 404", resp.StatusCode)
+	}
+}
+
+func TestHandleVideoFileRange(t *testing.T) {
+	id := newTestSessionDir(t)
+	path := recordingPath(id, videoFileName)
+	writeTestIVF(t, path, fourCCVP8)
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.Write(bytes.Repeat([]byte{0xab}, 200)); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	video, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	app.Get("/files/:uuid/video", handleVideoFile)
+	req := httptest.NewRequest(fiber.MethodGet, "/files/"+id+"/video", nil)
+	req.Header.Set(fiber.HeaderRange, "bytes=0-99")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != fiber.StatusPartialContent {
+		t.Fatalf("status %d, want 206", resp.StatusCode)
+	}
+	if got, want := resp.Header.Get(fiber.HeaderContentRange), fmt.Sprintf("bytes 0-99/%d", len(video)); got != want {
+		t.Errorf("Content-Range %q, want %q", got, want)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, video[:100]) {
+		t.Errorf("got %d bytes %x, want the first 100 of the file", len(data), data)
+	}
+}
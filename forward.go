@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+)
+
+// RTPForwarder sends RTP packets to a UDP address, e.g. a plain RTP ingest of a downstream SFU.
+// The socket is opened on the first write.
+type RTPForwarder struct {
+	addr string
+
+	once sync.Once
+	conn *net.UDPConn
+	err  error
+}
+
+func NewRTPForwarder(target string, port int) *RTPForwarder {
+	return &RTPForwarder{addr: net.JoinHostPort(target, strconv.Itoa(port))}
+}
+
+// Write sends b, a marshaled RTP packet, as one datagram
+func (f *RTPForwarder) Write(b []byte) (int, error) {
+	f.once.Do(func() {
+		var raddr *net.UDPAddr
+		if raddr, f.err = net.ResolveUDPAddr("udp", f.addr); f.err == nil {
+			f.conn, f.err = net.DialUDP("udp", nil, raddr)
+		}
+	})
+	if f.err != nil {
+		return 0, f.err
+	}
+	return f.conn.Write(b)
+}
+
+func (f *RTPForwarder) Close() error {
+	// Keep a later Write from opening the socket after the forwarder was closed
+	f.once.Do(func() { f.err = net.ErrClosed })
+	if f.conn == nil {
+		return nil
+	}
+	return f.conn.Close()
+}
+
+// forwardPacket marshals packet and sends it through f, failures are logged once per forwarder and otherwise dropped
+func forwardPacket(f *RTPForwarder, packet *rtp.Packet, logged *bool) {
+	b, err := packet.Marshal()
+	if err == nil {
+		_, err = f.Write(b)
+	}
+	if err != nil && !*logged {
+		*logged = true
+		fmt.Printf("Cannot forward RTP to %s: %v\n", f.addr, err)
+	}
+}
+
+// errForwardTargetNotAllowed is returned by forwardTarget for an address RTP may not be sent to
+var errForwardTargetNotAllowed = errors.New("forward target is not allowed")
+
+// forwardTarget resolves host to the address RTP is forwarded to. With FORWARD_ALLOWED_NETWORKS the
+// address must be in one of its networks, without it the address must be public: loopback,
+// link-local, private, multicast and unspecified addresses are refused, so the server cannot be
+// used to send traffic into its own network.
+func forwardTarget(ctx context.Context, cfg Config, host string) (netip.Addr, error) {
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil || len(addrs) == 0 {
+		return netip.Addr{}, fmt.Errorf("cannot resolve %s: %v", host, err)
+	}
+	// The forwarder sends to the address checked here, resolving again could give another one
+	addr := addrs[0].Unmap()
+
+	if len(cfg.ForwardAllowedNetworks) > 0 {
+		for _, network := range cfg.ForwardAllowedNetworks {
+			if network.Contains(addr) {
+				return addr, nil
+			}
+		}
+		return netip.Addr{}, fmt.Errorf("%w: %s is not in FORWARD_ALLOWED_NETWORKS", errForwardTargetNotAllowed, addr)
+	}
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return netip.Addr{}, fmt.Errorf("%w: %s is not a public address", errForwardTargetNotAllowed, addr)
+	}
+	return addr, nil
+}
+
+// handleForward starts relaying the RTP packets received in a live session to a downstream host.
+// Packets are sent as received, with the payload types negotiated with the client (96 for VP8, 111 for Opus).
+// Either port may be left out to forward only one kind, posting again replaces the previous target.
+// It is served under /admin and only sends to the addresses forwardTarget allows.
+func handleForward(cfg Config) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := c.Params("uuid")
+		if !isUUID(id) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid session id"})
+		}
+
+		var body struct {
+			Host      string `json:"host"`
+			VideoPort int    `json:"videoPort"`
+			AudioPort int    `json:"audioPort"`
+		}
+		if err := c.BodyParser(&body); err != nil || body.Host == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "host is required"})
+		}
+		if body.VideoPort == 0 && body.AudioPort == 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "videoPort or audioPort is required"})
+		}
+		for _, port := range []int{body.VideoPort, body.AudioPort} {
+			if port < 0 || port > 65535 {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ports must be between 1 and 65535"})
+			}
+		}
+
+		session, ok := sessions.get(id)
+		if !ok {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "session not found"})
+		}
+		if session.peerConnection == nil || session.peerConnection.ConnectionState() == webrtc.PeerConnectionStateClosed {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "session is not live"})
+		}
+
+		target, err := forwardTarget(c.UserContext(), cfg, body.Host)
+		if errors.Is(err, errForwardTargetNotAllowed) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		} else if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		forwarders := map[webrtc.RTPCodecType]*RTPForwarder{}
+		if body.VideoPort != 0 {
+			forwarders[webrtc.RTPCodecTypeVideo] = NewRTPForwarder(target.String(), body.VideoPort)
+		}
+		if body.AudioPort != 0 {
+			forwarders[webrtc.RTPCodecTypeAudio] = NewRTPForwarder(target.String(), body.AudioPort)
+		}
+		session.setForwarders(forwarders)
+		fmt.Printf("Session %s: forwarding RTP to %s (%s, video port %d, audio port %d)\n", session.id, body.Host, target, body.VideoPort, body.AudioPort)
+
+		return c.JSON(fiber.Map{"host": body.Host, "videoPort": body.VideoPort, "audioPort": body.AudioPort})
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+)
+
+func TestForwardTarget(t *testing.T) {
+	allowPrivate := Config{ForwardAllowedNetworks: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}}
+	tests := []struct {
+		name    string
+		cfg     Config
+		host    string
+		allowed bool
+	}{
+		{"public", Config{}, "8.8.8.8", true},
+		{"public IPv6", Config{}, "2001:4860:4860::8888", true},
+		{"loopback", Config{}, "127.0.0.1", false},
+		{"loopback IPv6", Config{}, "::1", false},
+		{"IPv4 mapped loopback", Config{}, "::ffff:127.0.0.1", false},
+		{"private", Config{}, "192.168.1.10", false},
+		{"unique local", Config{}, "fd00::1", false},
+		{"link-local", Config{}, "169.254.169.254", false},
+		{"link-local IPv6", Config{}, "fe80::1", false},
+		{"multicast", Config{}, "239.1.2.3", false},
+		{"unspecified", Config{}, "0.0.0.0", false},
+		{"allowed private network", allowPrivate, "10.1.2.3", true},
+		{"outside the allowed networks", allowPrivate, "8.8.8.8", false},
+		{"loopback outside the allowed networks", allowPrivate, "127.0.0.1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, err := forwardTarget(context.Background(), tt.cfg, tt.host)
+			if tt.allowed {
+				if err != nil {
+					t.Fatalf("forwardTarget(%s): %v", tt.host, err)
+				}
+				if want := netip.MustParseAddr(tt.host); addr != want {
+					t.Errorf("forwardTarget(%s) = %s", tt.host, addr)
+				}
+				return
+			}
+			if !errors.Is(err, errForwardTargetNotAllowed) {
+				t.Errorf("forwardTarget(%s) = %s, %v, want errForwardTargetNotAllowed", tt.host, addr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/webrtc/v3/pkg/media"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// droppedFrames is webrtc_dropped_frames_total, the video frames dropped by MAX_VIDEO_FPS across all sessions
+var droppedFrames, _ = otel.Meter("github.com/sahilpawar58/webrtcPost").Int64Counter("webrtc_dropped_frames_total",
+	metric.WithDescription("Video frames dropped for arriving faster than MAX_VIDEO_FPS"))
+
+// frameRateCap is a MediaPipeline stage passing at most max video frames per second of arrival
+// time on to next. Keyframes always go through, the frames dropped are inter frames. A dropped
+// frame leaves the frames after it referencing a frame the recording lacks until the next keyframe,
+// the answer asks the client not to send more than max frames per second in the first place.
+type frameRateCap struct {
+	next    MediaPipeline
+	max     int
+	dropped *atomic.Uint64
+	// arrivals are the times of the frames passed within the last second, oldest first
+	arrivals []time.Time
+}
+
+func newFrameRateCap(next MediaPipeline, max int, dropped *atomic.Uint64) *frameRateCap {
+	return &frameRateCap{next: next, max: max, dropped: dropped}
+}
+
+func (f *frameRateCap) ProcessSample(sample media.Sample, codec string) error {
+	now := time.Now()
+	for len(f.arrivals) > 0 && now.Sub(f.arrivals[0]) >= time.Second {
+		f.arrivals = f.arrivals[1:]
+	}
+
+	fourCC, _ := MimeTypeToFourCC(codec)
+	if len(f.arrivals) >= f.max && !isIVFKeyFrame(fourCC, sample.Data) {
+		f.dropped.Add(1)
+		droppedFrames.Add(context.Background(), 1)
+		return nil
+	}
+	f.arrivals = append(f.arrivals, now)
+	return f.next.ProcessSample(sample, codec)
+}
+
+func (f *frameRateCap) Close() error {
+	return f.next.Close()
+}
+
+// capFrameRate sets max-fr in VP8 fmtp parameters, unless they already ask for max frames per second or fewer
+func capFrameRate(fmtp string, max int) string {
+	for _, param := range strings.Split(fmtp, ";") {
+		if v, ok := strings.CutPrefix(param, "max-fr="); ok {
+			if fr, err := strconv.Atoi(v); err == nil && fr <= max {
+				return fmtp
+			}
+		}
+	}
+	return mergeFmtp(fmtp, "max-fr="+strconv.Itoa(max))
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pion/webrtc/v3"
+)
+
+// signalingKeepalive is how often the signaling stream sends a comment, so a client that went away
+// is noticed and proxies keep the stream open
+const signalingKeepalive = 15 * time.Second
+
+// pushSignaling queues msg for the client on GET /sessions/:uuid/signaling. Only the latest
+// message is kept, an older one nobody read is stale by then.
+func (s *recordingSession) pushSignaling(msg string) {
+	for {
+		select {
+		case s.signaling <- msg:
+			return
+		default:
+		}
+		select {
+		case <-s.signaling:
+		default:
+		}
+	}
+}
+
+// startICERestart is called when ICE gets disconnected. It offers an ICE restart to the client
+// through the signaling stream, once until ICE connects again. A restart that does not bring the
+// connection back ends the session when ICE fails, like before.
+func (s *recordingSession) startICERestart(cfg Config) {
+	s.mu.Lock()
+	if s.iceRestarting {
+		s.mu.Unlock()
+		fmt.Printf("Session %s: ICE disconnected again after a restart, waiting for it to fail\n", s.id)
+		return
+	}
+	s.iceRestarting = true
+	s.mu.Unlock()
+
+	pc := s.peerConnection
+	if pc.SignalingState() != webrtc.SignalingStateStable {
+		fmt.Printf("Session %s: cannot restart ICE during a negotiation\n", s.id)
+		return
+	}
+	offer, err := pc.CreateOffer(&webrtc.OfferOptions{ICERestart: true})
+	if err != nil {
+		fmt.Printf("Session %s: cannot create ICE restart offer: %v\n", s.id, err)
+		return
+	}
+	gatherComplete := webrtc.GatheringCompletePromise(pc)
+	if err := pc.SetLocalDescription(offer); err != nil {
+		fmt.Printf("Session %s: cannot create ICE restart offer: %v\n", s.id, err)
+		return
+	}
+	<-gatherComplete
+
+	s.pushSignaling(encode(s.localDescription(cfg)))
+	fmt.Printf("Session %s: ICE disconnected, offered an ICE restart\n", s.id)
+}
+
+// iceConnected allows the next disconnection to restart ICE again
+func (s *recordingSession) iceConnected() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.iceRestarting = false
+}
+
+// handleSignaling streams the offers the server makes to a live session as server-sent events,
+// currently the ICE restart offers:
+//
+//	event: offer
+//	data: <base64 encoded offer>
+//
+// The offer is encoded like the answer of POST /, the client answers it with POST /sessions/:uuid/answer.
+func handleSignaling(c *fiber.Ctx) error {
+	id := c.Params("uuid")
+	if !isUUID(id) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid session id"})
+	}
+	session, ok := sessions.get(id)
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "session not found"})
+	}
+	pc := session.peerConnection
+	if pc == nil || pc.ConnectionState() == webrtc.PeerConnectionStateClosed {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "session is not live"})
+	}
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		ticker := time.NewTicker(signalingKeepalive)
+		defer ticker.Stop()
+		for {
+			select {
+			case msg := <-session.signaling:
+				fmt.Fprintf(w, "event: offer\ndata: %s\n\n", msg)
+			case <-ticker.C:
+				if pc.ConnectionState() == webrtc.PeerConnectionStateClosed {
+					return
+				}
+				fmt.Fprint(w, ": keepalive\n\n")
+			}
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	})
+	return nil
+}
+
+// handleAnswer applies the client's answer to an offer sent on the signaling stream
+func handleAnswer(c *fiber.Ctx) error {
+	id := c.Params("uuid")
+	if !isUUID(id) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid session id"})
+	}
+
+	var body struct {
+		Param string `json:"param"`
+	}
+	if err := c.BodyParser(&body); err != nil || body.Param == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "param is required"})
+	}
+	answer := webrtc.SessionDescription{}
+	if err := decode(body.Param, &answer); err != nil {
+		return sendDecodeError(c, "param", err)
+	}
+	if answer.Type != webrtc.SDPTypeAnswer {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "param is not an answer", "field": "param"})
+	}
+
+	session, ok := sessions.get(id)
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "session not found"})
+	}
+	pc := session.peerConnection
+	if pc == nil || pc.ConnectionState() == webrtc.PeerConnectionStateClosed {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "session is not live"})
+	}
+	if err := pc.SetRemoteDescription(answer); err != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pion/webrtc/v3/pkg/media"
+)
+
+const (
+	// injectFrameRate is the rate at which synthetic frames are generated
+	injectFrameRate = 30
+	// maxInjectDuration bounds how much synthetic video a single request may add to a recording
+	maxInjectDuration = 60 * time.Second
+)
+
+// vp8BlackKeyFrame is a 16x16 VP8 keyframe of a single black macroblock: DC prediction for luma and
+// chroma, quantizer index 127 and one Y2 DC coefficient of -23 that brings luma down to 16.
+var vp8BlackKeyFrame = []byte{
+	0xf0, 0x00, 0x00, 0x9d, 0x01, 0x2a, 0x10, 0x00, 0x10, 0x00, 0x00, 0x00,
+	0xfe, 0x00, 0x00, 0x0d, 0xc0, 0xfe, 0xe6, 0xb5, 0x00,
+}
+
+// handleInject writes durationMs worth of black VP8 keyframes into the video of a live session,
+// which lets QA check the recording path with a known test pattern. It alters recordings, so it is
+// served under /admin.
+func handleInject(c *fiber.Ctx) error {
+	id := c.Params("uuid")
+	if !isUUID(id) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid session id"})
+	}
+
+	var body struct {
+		Codec      string `json:"codec"`
+		DurationMs int    `json:"durationMs"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid body"})
+	}
+	if !strings.EqualFold(body.Codec, "VP8") {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "only VP8 can be injected"})
+	}
+	duration := time.Duration(body.DurationMs) * time.Millisecond
+	if duration <= 0 || duration > maxInjectDuration {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "durationMs must be between 1 and 60000"})
+	}
+
+	session, ok := sessions.get(id)
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "session not found"})
+	}
+
+	frameDuration := time.Second / injectFrameRate
+	frames := int(duration / frameDuration)
+	if frames == 0 {
+		frames = 1
+	}
+	samples := make([]media.Sample, frames)
+	for i := range samples {
+		samples[i] = media.Sample{Data: vp8BlackKeyFrame, Duration: frameDuration}
+	}
+
+	if err := session.injectVideo(samples); err != nil {
+		if !errors.Is(err, errPipelineStopped) {
+			return err
+		}
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "session is not recording video"})
+	}
+	return c.JSON(fiber.Map{"frames": frames})
+}
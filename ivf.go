@@ -0,0 +1,320 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media/ivfreader"
+	"github.com/pion/webrtc/v3/pkg/media/ivfwriter"
+)
+
+const ivfFrameHeaderSize = 12
+
+// writeIVFHeader writes a 32 byte IVF file header using the codec, size and timebase of h
+func writeIVFHeader(w io.Writer, h *ivfreader.IVFFileHeader, frameCount uint32) error {
+	header := make([]byte, ivfHeaderSize)
+	copy(header[0:], "DKIF")
+	binary.LittleEndian.PutUint16(header[4:], 0)
+	binary.LittleEndian.PutUint16(header[6:], ivfHeaderSize)
+	copy(header[8:], h.FourCC)
+	binary.LittleEndian.PutUint16(header[12:], h.Width)
+	binary.LittleEndian.PutUint16(header[14:], h.Height)
+	binary.LittleEndian.PutUint32(header[16:], h.TimebaseDenominator)
+	binary.LittleEndian.PutUint32(header[20:], h.TimebaseNumerator)
+	binary.LittleEndian.PutUint32(header[24:], frameCount)
+
+	_, err := w.Write(header)
+	return err
+}
+
+func writeIVFFrame(w io.Writer, frame []byte, pts uint64) error {
+	header := make([]byte, ivfFrameHeaderSize)
+	binary.LittleEndian.PutUint32(header[0:], uint32(len(frame)))
+	binary.LittleEndian.PutUint64(header[4:], pts)
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(frame)
+	return err
+}
+
+// patchIVFFrameCount rewrites the frame count of an IVF file written to w, like ivfwriter does on Close.
+// Writers that cannot seek keep the count given to writeIVFHeader.
+func patchIVFFrameCount(w io.Writer, count uint32) error {
+	ws, ok := w.(io.WriteSeeker)
+	if !ok {
+		return nil
+	}
+
+	end, err := ws.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := ws.Seek(24, io.SeekStart); err != nil {
+		return err
+	}
+	buf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(buf, count)
+	if _, err := ws.Write(buf); err != nil {
+		return err
+	}
+	_, err = ws.Seek(end, io.SeekStart)
+	return err
+}
+
+// ivfAppender lets an ivfwriter.IVFWriter continue an IVF file. ivfwriter writes the file header,
+// each frame header and each frame in calls of their own, so the appender drops the header, moves the
+// PTS of the frame headers past those in the file and adds the frames in the file to the count
+// written on Close.
+type ivfAppender struct {
+	file      *os.File
+	frames    uint32
+	ptsOffset uint64
+
+	skippedHeader, inFrame, patchingCount bool
+}
+
+func (a *ivfAppender) Write(p []byte) (int, error) {
+	switch {
+	case !a.skippedHeader:
+		a.skippedHeader = true
+		return len(p), nil
+	case a.patchingCount:
+		a.patchingCount = false
+		count := make([]byte, 4)
+		binary.LittleEndian.PutUint32(count, a.frames+binary.LittleEndian.Uint32(p))
+		if _, err := a.file.Write(count); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	case !a.inFrame && len(p) == ivfFrameHeaderSize:
+		a.inFrame = true
+		header := append([]byte{}, p...)
+		binary.LittleEndian.PutUint64(header[4:], binary.LittleEndian.Uint64(header[4:])+a.ptsOffset)
+		if _, err := a.file.Write(header); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	a.inFrame = false
+	return a.file.Write(p)
+}
+
+// Seek is only called by ivfwriter to go back to the frame count on Close
+func (a *ivfAppender) Seek(offset int64, whence int) (int64, error) {
+	a.patchingCount = true
+	return a.file.Seek(offset, whence)
+}
+
+func (a *ivfAppender) Close() error {
+	return a.file.Close()
+}
+
+// AppendIVF writes more frames to the IVF file, opened for reading and writing, after the ones it
+// holds, returning the index of the last frame in the file, -1 if it has none. A frame cut short, as
+// left by a process that stopped while writing, is dropped. Like a new recording, the appended
+// frames start at a keyframe. The writer closes file, as does a failure.
+func AppendIVF(file *os.File) (*ivfwriter.IVFWriter, int, error) {
+	fail := func(err error) (*ivfwriter.IVFWriter, int, error) {
+		file.Close()
+		return nil, 0, err
+	}
+
+	ivf, header, err := ivfreader.NewWith(file)
+	if err != nil {
+		return fail(fmt.Errorf("%w: %v", errCorruptRecording, err))
+	}
+	mimeType, err := FourCCToMimeType(header.FourCC)
+	if err != nil {
+		return fail(err)
+	}
+
+	appender := &ivfAppender{file: file}
+	end := int64(ivfHeaderSize)
+	for {
+		frame, frameHeader, err := ivf.ParseNextFrame()
+		if err != nil {
+			break
+		}
+		end += ivfFrameHeaderSize + int64(len(frame))
+		appender.frames++
+		appender.ptsOffset = frameHeader.Timestamp + 1
+	}
+	if err := file.Truncate(end); err != nil {
+		return fail(err)
+	}
+	if _, err := file.Seek(end, io.SeekStart); err != nil {
+		return fail(err)
+	}
+
+	writer, err := ivfwriter.NewWith(appender, ivfwriter.WithCodec(mimeType))
+	if err != nil {
+		return fail(err)
+	}
+	return writer, int(appender.frames) - 1, nil
+}
+
+// normalizeClockRate converts one unit of an IVF timebase, numerator/denominator seconds, to a
+// sample duration that is a whole number of ticks of the RTP clock. pion turns sample durations
+// into RTP timestamp increments by rounding down, a duration between two ticks, such as 1/30s at
+// 90 kHz taken as 33ms, would make the timestamps drift from the frame rate.
+func normalizeClockRate(ivfNumerator, ivfDenominator uint32, rtpClockRate uint32) time.Duration {
+	if ivfDenominator == 0 || rtpClockRate == 0 {
+		return 0
+	}
+	ticks := (uint64(ivfNumerator)*uint64(rtpClockRate) + uint64(ivfDenominator)/2) / uint64(ivfDenominator)
+	// Rounded up to the next nanosecond so that pion's conversion back lands on ticks again
+	return time.Duration((ticks*uint64(time.Second) + uint64(rtpClockRate) - 1) / uint64(rtpClockRate))
+}
+
+// isIVFKeyFrame reports whether frame is a keyframe, codecs we cannot inspect are treated as all keyframes
+func isIVFKeyFrame(fourCC string, frame []byte) bool {
+	if len(frame) == 0 {
+		return false
+	}
+	mimeType, _ := FourCCToMimeType(fourCC)
+	switch mimeType {
+	case webrtc.MimeTypeVP8:
+		return frame[0]&0x01 == 0
+	case webrtc.MimeTypeVP9:
+		// frame_marker(2) profile(2) show_existing_frame(1) frame_type(1), for profiles 0 and 1
+		return frame[0]&0x04 == 0
+	default:
+		return true
+	}
+}
+
+// TrimIVF copies the frames of an IVF stream between startMs and endMs to w.
+// Output starts at the first keyframe at or after startMs so it can be decoded on its own,
+// and frame timestamps are rebased to start from zero.
+func TrimIVF(r io.Reader, w io.Writer, startMs, endMs float64, frameRateHz float64) error {
+	if frameRateHz <= 0 {
+		return fmt.Errorf("invalid frame rate %f", frameRateHz)
+	}
+	if endMs <= startMs {
+		return fmt.Errorf("end %fms is not after start %fms", endMs, startMs)
+	}
+
+	ivf, header, err := ivfreader.NewWith(r)
+	if err != nil {
+		return err
+	}
+	if err := writeIVFHeader(w, header, 0); err != nil {
+		return err
+	}
+
+	var (
+		count    uint32
+		firstPTS uint64
+		started  bool
+	)
+	for {
+		frame, frameHeader, err := ivf.ParseNextFrame()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		timeMs := float64(frameHeader.Timestamp) / frameRateHz * 1000
+		if timeMs >= endMs {
+			break
+		}
+		if timeMs < startMs {
+			continue
+		}
+		if !started {
+			if !isIVFKeyFrame(header.FourCC, frame) {
+				continue
+			}
+			started = true
+			firstPTS = frameHeader.Timestamp
+		}
+
+		if err := writeIVFFrame(w, frame, frameHeader.Timestamp-firstPTS); err != nil {
+			return err
+		}
+		count++
+	}
+
+	return patchIVFFrameCount(w, count)
+}
+
+// MergeIVF writes the frames of first followed by those of second to w as one IVF stream.
+// The timestamps of second are shifted to continue one frame after the end of first, using the
+// PTS step between the last two frames of first as the frame duration.
+func MergeIVF(first, second io.Reader, w io.Writer) error {
+	ivfFirst, headerFirst, err := ivfreader.NewWith(first)
+	if err != nil {
+		return err
+	}
+	ivfSecond, headerSecond, err := ivfreader.NewWith(second)
+	if err != nil {
+		return err
+	}
+	if headerFirst.FourCC != headerSecond.FourCC {
+		return fmt.Errorf("%w: cannot append %s video to %s video", errIncompatibleRecordings, headerSecond.FourCC, headerFirst.FourCC)
+	}
+	if headerFirst.TimebaseDenominator != headerSecond.TimebaseDenominator || headerFirst.TimebaseNumerator != headerSecond.TimebaseNumerator {
+		return fmt.Errorf("%w: video timebases differ", errIncompatibleRecordings)
+	}
+	if err := writeIVFHeader(w, headerFirst, 0); err != nil {
+		return err
+	}
+
+	var (
+		count         uint32
+		lastPTS, step uint64 = 0, 1
+	)
+	for {
+		frame, frameHeader, err := ivfFirst.ParseNextFrame()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if count > 0 && frameHeader.Timestamp > lastPTS {
+			step = frameHeader.Timestamp - lastPTS
+		}
+		lastPTS = frameHeader.Timestamp
+
+		if err := writeIVFFrame(w, frame, frameHeader.Timestamp); err != nil {
+			return err
+		}
+		count++
+	}
+
+	var offset, firstPTS uint64
+	started := false
+	for {
+		frame, frameHeader, err := ivfSecond.ParseNextFrame()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if !started {
+			started = true
+			firstPTS = frameHeader.Timestamp
+			if count > 0 {
+				offset = lastPTS + step
+			}
+		}
+
+		if err := writeIVFFrame(w, frame, offset+frameHeader.Timestamp-firstPTS); err != nil {
+			return err
+		}
+		count++
+	}
+
+	return patchIVFFrameCount(w, count)
+}
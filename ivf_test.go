@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3/pkg/media/ivfreader"
+	"github.com/pion/webrtc/v3/pkg/media/ivfwriter"
+)
+
+// writeVP8Frames writes frames as single packet VP8 frames tagged with their index from first,
+// the first of them a keyframe
+func writeVP8Frames(t *testing.T, w *ivfwriter.IVFWriter, first, frames int) {
+	t.Helper()
+	for i := first; i < first+frames; i++ {
+		// The VP8 payload descriptor starts a partition, bit 0 of the frame tag is clear on keyframes
+		tag := byte(0x01)
+		if i == first {
+			tag = 0x00
+		}
+		packet := &rtp.Packet{Header: rtp.Header{Marker: true, Timestamp: uint32(3000 * i)}, Payload: []byte{0x10, tag, byte(i)}}
+		if err := w.WriteRTP(packet); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestAppendIVF(t *testing.T) {
+	path := filepath.Join(t.TempDir(), videoFileName)
+	w, err := ivfwriter.New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeVP8Frames(t, w, 0, 3)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A process that stopped while writing leaves a frame cut short
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.Write([]byte{0xff, 0, 0, 0, 0}); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	file, err = os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, last, err := AppendIVF(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last != 2 {
+		t.Errorf("last frame index %d, want 2", last)
+	}
+	writeVP8Frames(t, w, 3, 2)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err = os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	r, header, err := ivfreader.NewWith(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.NumFrames != 5 {
+		t.Errorf("header counts %d frames, want 5", header.NumFrames)
+	}
+	var frames int
+	for ; ; frames++ {
+		frame, frameHeader, err := r.ParseNextFrame()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("frame %d: %v", frames, err)
+		}
+		if frameHeader.Timestamp != uint64(frames) {
+			t.Errorf("frame %d has PTS %d, want %d", frames, frameHeader.Timestamp, frames)
+		}
+		if len(frame) != 2 || frame[1] != byte(frames) {
+			t.Errorf("frame %d holds %x, want the frame written as %d", frames, frame, frames)
+		}
+	}
+	if frames != 5 {
+		t.Errorf("read %d frames, want 5", frames)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pion/rtcp"
+)
+
+var errNoVideoTrack = errors.New("session has no live video track")
+
+// setVideoSSRC records the SSRC of the video track being recorded, 0 once it ended
+func (s *recordingSession) setVideoSSRC(ssrc uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.videoSSRC = ssrc
+}
+
+// requestKeyframe sends a PLI for the video track to the client and notes the time in session.json
+func (s *recordingSession) requestKeyframe() error {
+	s.mu.Lock()
+	ssrc := s.videoSSRC
+	s.mu.Unlock()
+
+	if ssrc == 0 || s.peerConnection == nil {
+		return errNoVideoTrack
+	}
+	if err := s.peerConnection.WriteRTCP([]rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: ssrc}}); err != nil {
+		return err
+	}
+	return s.update(func(meta *sessionMetadata) {
+		meta.KeyframeRequests = append(meta.KeyframeRequests, time.Now().UTC())
+	})
+}
+
+// handleKeyframe asks the client of a live session for a video keyframe
+func handleKeyframe(c *fiber.Ctx) error {
+	id := c.Params("uuid")
+	if !isUUID(id) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid session id"})
+	}
+	session, ok := sessions.get(id)
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "session not found"})
+	}
+
+	if err := session.requestKeyframe(); err != nil {
+		if errors.Is(err, errNoVideoTrack) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+		}
+		return err
+	}
+	fmt.Printf("Session %s: keyframe requested\n", session.id)
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"requested": true})
+}
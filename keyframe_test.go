@@ -0,0 +1,136 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pion/rtcp"
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media"
+)
+
+func TestHandleKeyframe(t *testing.T) {
+	id := newTestSessionDir(t)
+
+	client, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The default API has no interval PLI interceptor, so every PLI the client reads was asked for
+	server, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	track, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8}, "video", "stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender, err := client.AddTrack(track)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session := newRecordingSession(id)
+	session.peerConnection = server
+	sessions.add(session)
+	t.Cleanup(func() { sessions.remove(id) })
+
+	received := make(chan struct{})
+	server.OnTrack(func(remote *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		session.setVideoSSRC(uint32(remote.SSRC()))
+		close(received)
+		for {
+			if _, _, err := remote.ReadRTP(); err != nil {
+				return
+			}
+		}
+	})
+	connectLoopback(t, client, server)
+
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+	go func() {
+		ticker := time.NewTicker(20 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := track.WriteSample(media.Sample{Data: []byte{0x10, 0x02, 0x00, 0x9d, 0x01, 0x2a}, Duration: 20 * time.Millisecond}); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	select {
+	case <-received:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the server got no video track")
+	}
+
+	app := fiber.New()
+	app.Post("/sessions/:uuid/keyframe", handleKeyframe)
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodPost, "/sessions/"+id+"/keyframe", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusAccepted {
+		t.Fatalf("status %d, want 202", resp.StatusCode)
+	}
+
+	pli := make(chan *rtcp.PictureLossIndication, 1)
+	go func() {
+		for {
+			packets, _, err := sender.ReadRTCP()
+			if err != nil {
+				return
+			}
+			for _, packet := range packets {
+				if p, ok := packet.(*rtcp.PictureLossIndication); ok {
+					select {
+					case pli <- p:
+					default:
+					}
+				}
+			}
+		}
+	}()
+
+	select {
+	case p := <-pli:
+		if want := uint32(sender.GetParameters().Encodings[0].SSRC); p.MediaSSRC != want {
+			t.Errorf("PLI for SSRC %d, want the video track's %d", p.MediaSSRC, want)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the client got no PLI")
+	}
+
+	stored, err := loadRecordingSession(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(stored.meta.KeyframeRequests); n != 1 {
+		t.Errorf("session.json holds %d keyframe requests, want 1", n)
+	}
+}
+
+func TestHandleKeyframeWithoutVideo(t *testing.T) {
+	id := newTestSessionDir(t)
+	sessions.add(newRecordingSession(id))
+	t.Cleanup(func() { sessions.remove(id) })
+
+	app := fiber.New()
+	app.Post("/sessions/:uuid/keyframe", handleKeyframe)
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodPost, "/sessions/"+id+"/keyframe", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusConflict {
+		t.Errorf("status %d for a session without a video track, want 409", resp.StatusCode)
+	}
+}
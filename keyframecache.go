@@ -0,0 +1,44 @@
+package main
+
+// keyframeCache keeps the last VP8 keyframe played on a track. A file with keyframes only at the
+// start leaves a viewer that lost the picture, or joined late, without one for good, so its PLI is
+// answered with the cached keyframe right before the next frame of the file. The frames in between
+// are missing from the decoder's references, the picture is only fully repaired by the next keyframe
+// of the file, but it no longer stays frozen until then.
+type keyframeCache struct {
+	keyframe []byte
+	// pli holds a request of the viewer until the next frame is played
+	pli chan struct{}
+}
+
+func newKeyframeCache() *keyframeCache {
+	return &keyframeCache{pli: make(chan struct{}, 1)}
+}
+
+// request notes a PLI of the viewer, requests arriving before the next frame is played count once
+func (k *keyframeCache) request() {
+	select {
+	case k.pli <- struct{}{}:
+	default:
+	}
+}
+
+// requested is called with every frame before it is played and returns the keyframe to play first,
+// if the viewer asked for one. A keyframe needs none, the frame itself replaces the cached one.
+func (k *keyframeCache) requested(frame []byte) ([]byte, bool) {
+	if isIVFKeyFrame(fourCCVP8, frame) {
+		k.keyframe = frame
+		select {
+		case <-k.pli:
+		default:
+		}
+		return nil, false
+	}
+
+	select {
+	case <-k.pli:
+		return k.keyframe, k.keyframe != nil
+	default:
+		return nil, false
+	}
+}
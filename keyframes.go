@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pion/webrtc/v3/pkg/media"
+)
+
+const (
+	keyframesDirName  = "keyframes"
+	keyframesFileName = "keyframes.jsonl"
+)
+
+// keyframeRecord is one line of keyframes.jsonl
+type keyframeRecord struct {
+	FrameIndex int   `json:"frameIndex"`
+	TimeMs     int64 `json:"timeMs"`
+	SizeBytes  int   `json:"sizeBytes"`
+}
+
+// keyframeSaver is a MediaPipeline stage that stores every video keyframe as it was received, in
+// keyframes/<frameIndex>.vp8 or .vp9 of the session directory, for decoding offline. Frames are
+// counted from the first sample of the track and timed by the sample durations.
+//
+// Saving keyframes is a debugging aid, when it fails it is logged and given up without affecting the recording.
+type keyframeSaver struct {
+	dir     string
+	files   *ResourceTracker
+	index   int
+	elapsed time.Duration
+	records *os.File
+	failed  bool
+}
+
+func newKeyframeSaver(session *recordingSession) *keyframeSaver {
+	return &keyframeSaver{dir: session.dir, files: &session.files}
+}
+
+func (k *keyframeSaver) ProcessSample(sample media.Sample, codec string) error {
+	index, start := k.index, k.elapsed
+	k.index++
+	k.elapsed += sample.Duration
+	if k.failed {
+		return nil
+	}
+
+	fourCC, err := MimeTypeToFourCC(codec)
+	if err != nil || !isIVFKeyFrame(fourCC, sample.Data) {
+		return nil
+	}
+	if err := k.save(index, start, sample.Data, strings.ToLower(strings.TrimPrefix(codec, "video/"))); err != nil {
+		k.failed = true
+		fmt.Println("Cannot save keyframe, no longer saving keyframes:", err)
+	}
+	return nil
+}
+
+func (k *keyframeSaver) save(index int, start time.Duration, frame []byte, ext string) error {
+	if k.records == nil {
+		if err := os.MkdirAll(filepath.Join(k.dir, keyframesDirName), 0o755); err != nil {
+			return err
+		}
+		records, err := k.files.OpenFile(filepath.Join(k.dir, keyframesFileName), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		k.records = records
+	}
+
+	if err := os.WriteFile(filepath.Join(k.dir, keyframesDirName, strconv.Itoa(index)+"."+ext), frame, 0o644); err != nil {
+		return err
+	}
+	b, err := json.Marshal(keyframeRecord{FrameIndex: index, TimeMs: start.Milliseconds(), SizeBytes: len(frame)})
+	if err != nil {
+		return err
+	}
+	_, err = k.records.Write(append(b, '\n'))
+	return err
+}
+
+func (k *keyframeSaver) Close() error {
+	if k.records == nil {
+		return nil
+	}
+	return k.records.Close()
+}
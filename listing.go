@@ -0,0 +1,31 @@
+package main
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+)
+
+const (
+	// listingRateLimit is how many times a client may list the recordings per listingRateWindow
+	listingRateLimit  = 10
+	listingRateWindow = time.Minute
+)
+
+// listingGuard lets each IP list the recordings listingRateLimit times a minute, so the session ids
+// cannot be polled faster than they could be guessed otherwise. With LISTING_REQUIRES_AUTH the listing
+// also takes ADMIN_TOKEN as a bearer token, like the /admin endpoints.
+func listingGuard(cfg Config) []fiber.Handler {
+	guard := []fiber.Handler{limiter.New(limiter.Config{
+		Max:        listingRateLimit,
+		Expiration: listingRateWindow,
+		LimitReached: func(c *fiber.Ctx) error {
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"error": "too many listing requests, try again later"})
+		},
+	})}
+	if cfg.ListingRequiresAuth {
+		guard = append(guard, adminAuth(cfg))
+	}
+	return guard
+}
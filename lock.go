@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const lockFileName = ".lock"
+
+// errSessionLocked means another process holds the lock of a session directory, e.g. a second
+// server instance sharing files/
+var errSessionLocked = errors.New("session directory is locked by another process")
+
+// lockDir takes the lock on .lock in the session directory, so no other process writes to it
+// while this one records. It reports whether this call took the lock, false when it was already held.
+func (s *recordingSession) lockDir() (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.dirLock != nil {
+		return false, nil
+	}
+	file, err := s.files.OpenFile(filepath.Join(s.dir, lockFileName), os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return false, err
+	}
+	if err := lockFile(file); err != nil {
+		file.Close()
+		return false, err
+	}
+	s.dirLock = file
+	return true, nil
+}
+
+// unlockDir releases the lock taken by lockDir. The file stays, removing it would let a process
+// lock a new file while another one still holds the old one.
+func (s *recordingSession) unlockDir() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.dirLock == nil {
+		return
+	}
+	if err := s.dirLock.Close(); err != nil {
+		fmt.Println(err)
+	}
+	s.dirLock = nil
+}
+
+// sessionLockedError is the 409 sent for errSessionLocked, other errors are returned as they are
+func sessionLockedError(err error) error {
+	if errors.Is(err, errSessionLocked) {
+		return fiber.NewError(fiber.StatusConflict, err.Error())
+	}
+	return err
+}
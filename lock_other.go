@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// lockFile does nothing where there is no flock, session directories are not locked there
+func lockFile(*os.File) error {
+	return nil
+}
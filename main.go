@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
@@ -19,6 +20,8 @@ import (
 	"github.com/google/uuid"
 	"github.com/pion/interceptor"
 	"github.com/pion/interceptor/pkg/intervalpli"
+	"github.com/pion/rtp"
+	"github.com/pion/sdp/v3"
 	"github.com/pion/webrtc/v3"
 	"github.com/pion/webrtc/v3/pkg/media"
 	"github.com/pion/webrtc/v3/pkg/media/ivfreader"
@@ -26,6 +29,8 @@ import (
 	"github.com/pion/webrtc/v3/pkg/media/oggreader"
 	"github.com/pion/webrtc/v3/pkg/media/oggwriter"
 	"github.com/spf13/afero"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -34,53 +39,77 @@ const (
 	oggPageDuration = time.Millisecond * 20
 )
 
-func saveToDisk(i media.Writer, track *webrtc.TrackRemote) {
-	defer func() {
-		if err := i.Close(); err != nil {
-			panic(err)
-		}
-	}()
+func isUUID(s string) bool {
+	// UUIDs have a specific format, so let's check if it matches
+	// Note: This is a basic check; for more robust validation, consider using a UUID library
+	return len(s) == 36 && strings.Count(s, "-") == 4
+}
 
-	for {
-		rtpPacket, _, err := track.ReadRTP()
-		if err != nil {
-			fmt.Println(err)
-			return
-		}
-		if err := i.WriteRTP(rtpPacket); err != nil {
-			fmt.Println(err)
-			return
+// trackLabels are the stream and track ids given to the local tracks, they end up in the msid of the answer
+type trackLabels struct {
+	StreamID     string
+	VideoTrackID string
+	AudioTrackID string
+}
+
+var defaultTrackLabels = trackLabels{StreamID: "pion", VideoTrackID: "video", AudioTrackID: "audio"}
+
+// isValidTrackLabel allows non-empty ids of up to 63 alphanumeric characters and hyphens
+func isValidTrackLabel(s string) bool {
+	if len(s) == 0 || len(s) >= 64 {
+		return false
+	}
+	for _, r := range s {
+		if !(r == '-' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')) {
+			return false
 		}
 	}
+	return true
 }
 
-func isUUID(s string) bool {
-	// UUIDs have a specific format, so let's check if it matches
-	// Note: This is a basic check; for more robust validation, consider using a UUID library
-	return len(s) == 36 && strings.Count(s, "-") == 4
+// parseTrackLabels reads the optional streamID, videoTrackID and audioTrackID fields of a request body
+func parseTrackLabels(body map[string]interface{}) (trackLabels, error) {
+	labels := defaultTrackLabels
+	for field, dst := range map[string]*string{
+		"streamID":     &labels.StreamID,
+		"videoTrackID": &labels.VideoTrackID,
+		"audioTrackID": &labels.AudioTrackID,
+	} {
+		value, present := body[field]
+		if !present {
+			continue
+		}
+		str, ok := value.(string)
+		if !ok || !isValidTrackLabel(str) {
+			return labels, fmt.Errorf("Parameter '%s' must be 1-63 alphanumeric characters or hyphens", field)
+		}
+		*dst = str
+	}
+	return labels, nil
 }
 
-func setupMediaTracks(peerConnection *webrtc.PeerConnection, videoFileName, audioFileName string, iceConnectedCtx context.Context) error {
+// setupMediaTracks adds the tracks playing the files that exist and returns the audio track, nil without audio
+func setupMediaTracks(cfg Config, peerConnection PeerConnectionInterface, videoFileName, audioFileName string, labels trackLabels, iceConnectedCtx context.Context) (*opusDTMFTrack, error) {
 	haveVideoFile := fileExists(videoFileName)
 	haveAudioFile := fileExists(audioFileName)
 
 	if !haveAudioFile && !haveVideoFile {
-		return fmt.Errorf("Could not find `%s` or `%s`", audioFileName, videoFileName)
+		return nil, fmt.Errorf("Could not find `%s` or `%s`", audioFileName, videoFileName)
 	}
 
 	if haveVideoFile {
-		if err := setupVideoTrack(peerConnection, videoFileName, iceConnectedCtx); err != nil {
-			return err
+		if err := setupVideoTrack(cfg, peerConnection, videoFileName, labels, iceConnectedCtx); err != nil {
+			return nil, err
 		}
-	}
-
-	if haveAudioFile {
-		if err := setupAudioTrack(peerConnection, audioFileName, iceConnectedCtx); err != nil {
-			return err
+		if err := writeVideoInfo(videoFileName); err != nil {
+			fmt.Println("Error writing video info:", err)
 		}
 	}
 
-	return nil
+	if !haveAudioFile {
+		return nil, nil
+	}
+	return setupAudioTrack(peerConnection, audioFileName, labels, iceConnectedCtx)
 }
 
 func fileExists(filename string) bool {
@@ -88,31 +117,40 @@ func fileExists(filename string) bool {
 	return !os.IsNotExist(err)
 }
 
-func setupVideoTrack(peerConnection *webrtc.PeerConnection, videoFileName string, iceConnectedCtx context.Context) error {
+func setupVideoTrack(cfg Config, peerConnection PeerConnectionInterface, videoFileName string, labels trackLabels, iceConnectedCtx context.Context) error {
 	file, err := os.Open(videoFileName)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
+	// The goroutine playing the file reads on from the header and closes it
+	playing := false
+	defer func() {
+		if !playing {
+			file.Close()
+		}
+	}()
 
-	_, header, err := ivfreader.NewWith(file)
+	ivf, header, err := ivfreader.NewWith(file)
 	if err != nil {
 		return err
 	}
 
-	var trackCodec string
-	switch header.FourCC {
-	case "AV01":
-		trackCodec = webrtc.MimeTypeAV1
-	case "VP90":
-		trackCodec = webrtc.MimeTypeVP9
-	case "VP80":
-		trackCodec = webrtc.MimeTypeVP8
-	default:
-		return fmt.Errorf("Unable to handle FourCC %s", header.FourCC)
+	trackCodec, err := FourCCToMimeType(header.FourCC)
+	if err != nil {
+		return err
+	}
+	// Each frame of the file takes one unit of its timebase, in RTP time at 90 kHz like every video codec
+	frameDuration := normalizeClockRate(header.TimebaseNumerator, header.TimebaseDenominator, 90000)
+	if frameDuration <= 0 {
+		return fmt.Errorf("IVF timebase %d/%d has no frame duration", header.TimebaseNumerator, header.TimebaseDenominator)
 	}
 
-	videoTrack, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: trackCodec}, "video", "pion")
+	capability := webrtc.RTPCodecCapability{MimeType: trackCodec}
+	// pion's default codecs hold VP9 with profile-id 0 and 2, VP9_PROFILE picks the one sent
+	if trackCodec == webrtc.MimeTypeVP9 {
+		capability.SDPFmtpLine = vp9FmtpLine(cfg.VP9Profile)
+	}
+	videoTrack, err := webrtc.NewTrackLocalStaticSample(capability, labels.VideoTrackID, labels.StreamID)
 	if err != nil {
 		return err
 	}
@@ -121,32 +159,37 @@ func setupVideoTrack(peerConnection *webrtc.PeerConnection, videoFileName string
 	if err != nil {
 		return err
 	}
+	if trackCodec == webrtc.MimeTypeVP9 {
+		if err := preferVP9Profile(peerConnection, rtpSender, capability.SDPFmtpLine); err != nil {
+			return err
+		}
+	}
 
-	go func() {
-		rtcpBuf := make([]byte, 1500)
-		for {
-			if _, _, err := rtpSender.Read(rtcpBuf); err != nil {
-				return
-			}
+	// Read incoming RTCP packets, a client that reports nothing back is warned about. The loss
+	// in the receiver reports paces the frames sent.
+	estimator := NewBandwidthEstimator()
+	var keyframes *keyframeCache
+	if cfg.PlaybackKeyframeCache && trackCodec == webrtc.MimeTypeVP8 {
+		keyframes = newKeyframeCache()
+	}
+	if rtpSender != nil {
+		monitor := NewRTCPMonitor(labels.VideoTrackID, func() { closeOnGoodbye(peerConnection) })
+		monitor.onReception = estimator.OnReport
+		if keyframes != nil {
+			monitor.onPictureLoss = keyframes.request
 		}
-	}()
+		go monitor.Run(rtpSender, iceConnectedCtx)
+	}
 
+	playing = true
 	go func() {
-		file, err := os.Open(videoFileName)
-		if err != nil {
-			panic(err)
-		}
 		defer file.Close()
 
-		ivf, _, err := ivfreader.NewWith(file)
-		if err != nil {
-			panic(err)
-		}
-
 		<-iceConnectedCtx.Done()
 
-		ticker := time.NewTicker(time.Millisecond * time.Duration((float32(header.TimebaseNumerator)/float32(header.TimebaseDenominator))*1000))
+		ticker := time.NewTicker(frameDuration)
 		defer ticker.Stop()
+		lastLog := time.Now()
 		for ; true; <-ticker.C {
 			frame, _, err := ivf.ParseNextFrame()
 			if errors.Is(err, io.EOF) {
@@ -158,46 +201,56 @@ func setupVideoTrack(peerConnection *webrtc.PeerConnection, videoFileName string
 				panic(err)
 			}
 
-			if err := videoTrack.WriteSample(media.Sample{Data: frame, Duration: time.Second}); err != nil {
+			if keyframes != nil {
+				if keyframe, ok := keyframes.requested(frame); ok {
+					if err := videoTrack.WriteSample(media.Sample{Data: keyframe, Duration: frameDuration}); err != nil {
+						panic(err)
+					}
+				}
+			}
+			if err := videoTrack.WriteSample(media.Sample{Data: frame, Duration: frameDuration}); err != nil {
 				panic(err)
 			}
+
+			// A frame too large for the estimated bandwidth holds back the next one
+			if wait := estimator.SendTime(len(frame)); wait > frameDuration {
+				time.Sleep(wait - frameDuration)
+			}
+			if time.Since(lastLog) >= bweLogInterval {
+				lastLog = time.Now()
+				fmt.Printf("Track %s: estimated bandwidth %d kbit/s\n", labels.VideoTrackID, estimator.Bitrate()/1000)
+			}
 		}
 	}()
 	return nil
 }
 
-func setupAudioTrack(peerConnection *webrtc.PeerConnection, audioFileName string, iceConnectedCtx context.Context) error {
-	audioTrack, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus}, "audio", "pion")
+// setupAudioTrack plays the Ogg/Opus file, POST /sessions/:uuid/dtmf sends its tones in between the pages
+func setupAudioTrack(peerConnection PeerConnectionInterface, audioFileName string, labels trackLabels, iceConnectedCtx context.Context) (*opusDTMFTrack, error) {
+	file, err := os.Open(audioFileName)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	ogg, _, err := oggreader.NewWith(file)
+	if err != nil {
+		file.Close()
+		return nil, err
 	}
 
+	audioTrack := newOpusDTMFTrack(labels.AudioTrackID, labels.StreamID)
 	rtpSender, err := peerConnection.AddTrack(audioTrack)
 	if err != nil {
-		return err
+		file.Close()
+		return nil, err
 	}
 
-	go func() {
-		rtcpBuf := make([]byte, 1500)
-		for {
-			if _, _, err := rtpSender.Read(rtcpBuf); err != nil {
-				return
-			}
-		}
-	}()
+	if rtpSender != nil {
+		go NewRTCPMonitor(labels.AudioTrackID, func() { closeOnGoodbye(peerConnection) }).Run(rtpSender, iceConnectedCtx)
+	}
 
 	go func() {
-		file, err := os.Open(audioFileName)
-		if err != nil {
-			panic(err)
-		}
 		defer file.Close()
 
-		ogg, _, err := oggreader.NewWith(file)
-		if err != nil {
-			panic(err)
-		}
-
 		<-iceConnectedCtx.Done()
 
 		var lastGranule uint64
@@ -214,94 +267,523 @@ func setupAudioTrack(peerConnection *webrtc.PeerConnection, audioFileName string
 				panic(err)
 			}
 
-			sampleCount := float64(pageHeader.GranulePosition - lastGranule)
+			sampleDuration := oggSampleDuration(pageHeader.GranulePosition, lastGranule)
 			lastGranule = pageHeader.GranulePosition
-			sampleDuration := time.Duration((sampleCount/48000)*1000) * time.Millisecond
 
 			if err := audioTrack.WriteSample(media.Sample{Data: pageData, Duration: sampleDuration}); err != nil {
 				panic(err)
 			}
 		}
 	}()
-	return nil
+	return audioTrack, nil
 }
 
-func main() {
+// closeOnGoodbye closes a peer connection whose remote sent an RTCP BYE
+func closeOnGoodbye(pc PeerConnectionInterface) {
+	if err := pc.Close(); err != nil {
+		fmt.Printf("cannot close peerConnection: %v\n", err)
+	}
+}
 
-	app := fiber.New()
+// newPlaybackPeerConnection creates a peer connection with pion's default codecs and
+// telephone-event/48000, which carries the DTMF tones next to the Opus audio
+func newPlaybackPeerConnection(cfg Config) (*webrtc.PeerConnection, error) {
+	m := &webrtc.MediaEngine{}
+	if err := m.RegisterDefaultCodecs(); err != nil {
+		return nil, err
+	}
+	if err := m.RegisterCodec(webrtc.RTPCodecParameters{
+		RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: mimeTypeTelephoneEvent, ClockRate: opusClockRate, SDPFmtpLine: "0-16"},
+		PayloadType:        telephoneEventPayloadType,
+	}, webrtc.RTPCodecTypeAudio); err != nil {
+		return nil, err
+	}
 
-	app.Use(cors.New(cors.Config{
-		AllowOrigins: "http://localhost:5173", // Allow specific origin
-		AllowMethods: "GET,POST,PUT,DELETE,OPTIONS",
-		AllowHeaders: "Origin, Content-Type, Accept",
-	}))
-	app.Post("/video", func(c *fiber.Ctx) error {
-		var body map[string]interface{}
-		if err := c.BodyParser(&body); err != nil {
-			return err
+	i := &interceptor.Registry{}
+	if err := webrtc.RegisterDefaultInterceptors(m, i); err != nil {
+		return nil, err
+	}
+	api := webrtc.NewAPI(webrtc.WithMediaEngine(m), webrtc.WithInterceptorRegistry(i), webrtc.WithSettingEngine(settingEngine(cfg)))
+	return api.NewPeerConnection(peerConnectionConfig(cfg))
+}
+
+// newRecordingPeerConnection creates a peer connection that can receive one audio and one video track
+func newRecordingPeerConnection(cfg Config) (*webrtc.PeerConnection, error) {
+	m := &webrtc.MediaEngine{}
+
+	// Setup the codecs you want to use.
+	// We'll use a VP8 and Opus but you can also define your own
+	if err := m.RegisterCodec(webrtc.RTPCodecParameters{
+		RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8, ClockRate: 90000, Channels: 0, SDPFmtpLine: "", RTCPFeedback: nil},
+		PayloadType:        96,
+	}, webrtc.RTPCodecTypeVideo); err != nil {
+		return nil, err
+	}
+	if err := m.RegisterCodec(webrtc.RTPCodecParameters{
+		RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus, ClockRate: 48000, Channels: 0, SDPFmtpLine: "", RTCPFeedback: nil},
+		PayloadType:        111,
+	}, webrtc.RTPCodecTypeAudio); err != nil {
+		return nil, err
+	}
+
+	// abs-send-time lets us measure the one-way delay of the packets we receive
+	for _, kind := range []webrtc.RTPCodecType{webrtc.RTPCodecTypeAudio, webrtc.RTPCodecTypeVideo} {
+		if err := m.RegisterHeaderExtension(webrtc.RTPHeaderExtensionCapability{URI: sdp.ABSSendTimeURI}, kind); err != nil {
+			return nil, err
 		}
-		base, okBase := body["base"].(string)
-		if !okBase {
-			return c.SendString("Parameter 'base' not found or not a string")
+	}
+
+	// Create a InterceptorRegistry. This is the user configurable RTP/RTCP Pipeline.
+	// This provides NACKs, RTCP Reports and other features. If you use `webrtc.NewPeerConnection`
+	// this is enabled by default. If you are manually managing You MUST create a InterceptorRegistry
+	// for each PeerConnection.
+	i := &interceptor.Registry{}
+
+	// Register a intervalpli factory
+	// This interceptor sends a PLI every 3 seconds. A PLI causes a video keyframe to be generated by the sender.
+	// This makes our video seekable and more error resilent, but at a cost of lower picture quality and higher bitrates
+	// A real world application should process incoming RTCP packets from viewers and forward them to senders
+	intervalPliFactory, err := intervalpli.NewReceiverInterceptor()
+	if err != nil {
+		return nil, err
+	}
+	i.Add(intervalPliFactory)
+
+	// Use the default set of Interceptors
+	if err = webrtc.RegisterDefaultInterceptors(m, i); err != nil {
+		return nil, err
+	}
+
+	// Create the API object with the MediaEngine
+	api := webrtc.NewAPI(webrtc.WithMediaEngine(m), webrtc.WithInterceptorRegistry(i), webrtc.WithSettingEngine(settingEngine(cfg)))
+
+	// Create a new RTCPeerConnection
+	peerConnection, err := api.NewPeerConnection(peerConnectionConfig(cfg))
+	if err != nil {
+		return nil, err
+	}
+
+	// Allow us to receive 1 audio track, and 1 video track
+	if _, err = peerConnection.AddTransceiverFromKind(webrtc.RTPCodecTypeAudio); err == nil {
+		_, err = peerConnection.AddTransceiverFromKind(webrtc.RTPCodecTypeVideo)
+	}
+	if err != nil {
+		if cErr := peerConnection.Close(); cErr != nil {
+			fmt.Printf("cannot close peerConnection: %v\n", cErr)
 		}
+		return nil, err
+	}
+	return peerConnection, nil
+}
 
-		// Create a new RTCPeerConnection
-		peerConnection, err := webrtc.NewPeerConnection(webrtc.Configuration{
-			ICEServers: []webrtc.ICEServer{
-				{
-					URLs:       []string{"turn:cvcp.csinfocomm.com:3478"},
-					Username:   "admin",
-					Credential: "pass@123",
-				},
-			},
-		})
-		if err != nil {
-			return err
+// logICECandidate logs a candidate gathered for a session, nil marks the end of gathering
+func logICECandidate(sessionID string, candidate *webrtc.ICECandidate) {
+	if candidate == nil {
+		slog.Debug("ICE gathering complete", "session", sessionID)
+		return
+	}
+	slog.Debug("ICE candidate gathered",
+		"session", sessionID,
+		"type", candidate.Typ.String(),
+		"protocol", candidate.Protocol.String(),
+		"address", candidate.Address,
+		"port", candidate.Port,
+		"priority", candidate.Priority,
+	)
+}
+
+// startRecording creates a peer connection for offer that saves the received audio and video
+// into a new session directory. When onICECandidate is nil it blocks until ICE gathering is
+// complete so the local description holds every candidate, otherwise candidates are trickled
+// through the callback and the local description is returned straight away.
+func startRecording(ctx context.Context, cfg Config, session *recordingSession, offer webrtc.SessionDescription, onICECandidate func(*webrtc.ICECandidate)) (*recordingSession, *webrtc.PeerConnection, error) {
+	_, createSpan := tracer.Start(ctx, "peerconnection.create")
+	peerConnection, err := newRecordingPeerConnection(cfg)
+	endSpan(createSpan, err)
+	if err != nil {
+		return nil, nil, err
+	}
+	var (
+		sessionSpan trace.Span
+		locked      bool
+	)
+	fail := func(err error) (*recordingSession, *webrtc.PeerConnection, error) {
+		if sessionSpan != nil {
+			endSpan(sessionSpan, err)
+		}
+		if locked {
+			session.unlockDir()
+		}
+		if cErr := peerConnection.Close(); cErr != nil {
+			fmt.Printf("cannot close peerConnection: %v\n", cErr)
 		}
+		return nil, nil, err
+	}
+
+	// A session created by POST /sessions already has its directory
+	created := session == nil
+	if created {
+		session = newRecordingSession(uuid.NewString())
+	}
+	oggfs := afero.NewOsFs()
+
+	destPathIvf := "files/" + session.id + "/output.ivf"
+	destpathOgg := "files/" + session.id + "/output.opus"
+
+	// Move the file
+	errogg := oggfs.MkdirAll("files/"+session.id, 48000)
+	if errogg != nil {
+		fmt.Println("Error creating directory:", errogg)
+	} else {
+		fmt.Println("Directory created successfully!")
+	}
+
+	// Two servers sharing files/ must not record into the same directory
+	if locked, err = session.lockDir(); err != nil {
+		return fail(err)
+	}
+	session.logEvent("offer.received", fiber.Map{"sdpBytes": len(offer.SDP)})
+	watchSelectedCandidatePair(peerConnection, session)
+
+	session.peerConnection = peerConnection
+	if err := session.update(func(meta *sessionMetadata) {
+		meta.State = sessionStateRecording
+		meta.Quality = cfg.RecordingQuality
+	}); err != nil {
+		fmt.Println("Error writing session metadata:", err)
+	}
+	sessions.add(session)
+	if created {
+		events.publish("session.created", session.id, fiber.Map{"state": sessionStateRecording})
+	} else if session.resume {
+		events.publish("session.reconnected", session.id, nil)
+		session.logEvent("session.reconnected", nil)
+	}
 
-		iceConnectedCtx, iceConnectedCtxCancel := context.WithCancel(context.Background())
-		defer func() {
-			if cErr := peerConnection.Close(); cErr != nil {
-				fmt.Printf("cannot close peerConnection: %v\n", cErr)
+	// The session span lives until teardown and follows the ICE state
+	ctx, sessionSpan = tracer.Start(ctx, "recording.session", trace.WithAttributes(attribute.String("session.id", session.id)))
+
+	// Dry runs go through the whole session without storing any media
+	var audioPipeline, videoPipeline MediaPipeline = NullWriter{}, NullWriter{}
+	if !cfg.DryRun {
+		if cfg.AudioSegmentDuration > 0 {
+			audioPipeline, err = newAudioSegmentWriter(session, cfg.AudioSegmentDuration, cfg.AudioSampleRate)
+		} else {
+			var oggFile *oggwriter.OggWriter
+			if session.resume && fileExists(destpathOgg) {
+				oggFile, err = session.appendOGG(audioFileName)
+			} else {
+				oggFile, err = session.createOGG(audioFileName, cfg.AudioSampleRate, 2)
 			}
-		}()
+			if err == nil {
+				audioPipeline = NewDiskWriter(oggFile)
+			}
+		}
+		if err != nil {
+			return fail(err)
+		}
 
-		if err := setupMediaTracks(peerConnection, videoFileName, audioFileName, iceConnectedCtx); err != nil {
-			return err
+		if cfg.VideoSegmentDuration > 0 {
+			videoPipeline, err = newVideoSegmentWriter(session, cfg.VideoSegmentDuration)
+		} else {
+			var ivfFile *ivfwriter.IVFWriter
+			if session.resume && fileExists(destPathIvf) {
+				var lastFrame int
+				if ivfFile, lastFrame, err = session.appendIVF(videoFileName); err == nil {
+					fmt.Printf("Session %s: resuming video after frame %d\n", session.id, lastFrame)
+				}
+			} else {
+				ivfFile, err = session.createIVF(videoFileName)
+			}
+			if err == nil {
+				videoPipeline = NewDiskWriter(ivfFile)
+			}
+		}
+		if err != nil {
+			audioPipeline.Close()
+			return fail(err)
+		}
+		if cfg.SaveKeyframes {
+			videoPipeline = NewMultiWriter(videoPipeline, newKeyframeSaver(session))
+		}
+		if cfg.MaxVideoFPS > 0 {
+			videoPipeline = newFrameRateCap(videoPipeline, cfg.MaxVideoFPS, &session.videoStats.dropped)
+		}
+	}
+	audioRecording, videoRecording := newTrackPipeline(audioPipeline), newTrackPipeline(videoPipeline)
+
+	setupEchoDataChannel(peerConnection, session.id, cfg.MaxDataChannelMessageSize)
+
+	// Set a handler for when a new remote track starts, this handler saves buffers to disk as
+	// an ivf file, since we could have multiple video tracks we provide a counter.
+	// In your application this is where you would handle/process video
+	delays := NewOneWayDelayTracker()
+	peerConnection.OnTrack(func(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) { //nolint: revive
+		codec := track.Codec()
+		trackCtx, trackSpan := tracer.Start(ctx, "track.record", trace.WithAttributes(attribute.String("session.id", session.id)))
+		defer trackSpan.End()
+
+		// Retransmissions are no media of their own, taken for video they would corrupt output.ivf and
+		// would take the place of the first video track
+		if strings.EqualFold(codec.MimeType, mimeTypeRTX) {
+			fmt.Printf("Session %s: discarding RTX track %q\n", session.id, track.ID())
+			discardTrack(track)
+			return
 		}
 
-		peerConnection.OnICEConnectionStateChange(func(connectionState webrtc.ICEConnectionState) {
-			fmt.Printf("Connection State has changed %s \n", connectionState.String())
-			if connectionState == webrtc.ICEConnectionStateConnected {
-				iceConnectedCtxCancel()
+		// Tracks added by renegotiation, e.g. a screen share, go to files of their own
+		if n := session.nextTrackIndex(track.Kind()); n > 0 {
+			trackSpan.SetAttributes(attribute.String("codec."+track.Kind().String(), codec.MimeType))
+			if err := recordExtraTrack(cfg, session, track, n); err != nil {
+				fmt.Println(err)
 			}
-		})
+			return
+		}
 
-		offer := webrtc.SessionDescription{}
-		decode(base, &offer)
-		if err := peerConnection.SetRemoteDescription(offer); err != nil {
-			return err
+		// A BYE on the track means the client hung up, closing the connection tears the session down
+		go watchGoodbye(receiver, track.ID(), func() { closeOnGoodbye(peerConnection) })
+
+		forward := session.forwarder(track.Kind())
+		absSendTimeID := headerExtensionID(receiver, sdp.ABSSendTimeURI)
+		counters := &session.audioStats
+		if track.Kind() == webrtc.RTPCodecTypeVideo {
+			counters = &session.videoStats
+		}
+		counters.setCodec(codec.MimeType)
+		events.publish("session.recording", session.id, fiber.Map{"kind": track.Kind().String(), "codec": codec.MimeType})
+		onPacket := func(packet *rtp.Packet) {
+			counters.observePacket(packet)
+			delays.Observe(packet, absSendTimeID, time.Now())
+			forward(packet)
 		}
 
-		answer, err := peerConnection.CreateAnswer(nil)
+		// Each track reports its own failure, audio keeps recording when video fails and vice versa
+		var err error
+		if strings.EqualFold(codec.MimeType, webrtc.MimeTypeOpus) {
+			if !audioRecording.start() {
+				fmt.Printf("Session %s: discarding audio track %q of an ended session\n", session.id, track.ID())
+				discardTrack(track)
+				return
+			}
+			fmt.Println("Got Opus track, saving to disk as output.opus (48 kHz, 2 channels)")
+			if !cfg.DryRun {
+				session.addAudioTrack(audioFileName)
+			}
+			trackSpan.SetAttributes(attribute.String("codec.audio", codec.MimeType))
+			err = saveAudioTrack(trackCtx, session, audioRecording, track, pipelineTaps{onPacket: onPacket})
+		} else if strings.EqualFold(codec.MimeType, webrtc.MimeTypeVP8) {
+			if !videoRecording.start() {
+				fmt.Printf("Session %s: discarding video track %q of an ended session\n", session.id, track.ID())
+				discardTrack(track)
+				return
+			}
+			fmt.Println("Got VP8 track, saving to disk as output.ivf")
+			if err := session.update(func(meta *sessionMetadata) { meta.VideoCodec = ivfCodecName(fourCCVP8) }); err != nil {
+				fmt.Println("Error writing session metadata:", err)
+			}
+			trackSpan.SetAttributes(attribute.String("codec.video", codec.MimeType))
+			err = saveVideoTrack(trackCtx, session, videoRecording, track, pipelineTaps{onPacket: onPacket})
+		}
 		if err != nil {
-			return err
+			session.recordTrackError(track.Kind(), err)
 		}
+	})
 
-		gatherComplete := webrtc.GatheringCompletePromise(peerConnection)
-		if err := peerConnection.SetLocalDescription(answer); err != nil {
-			return err
+	// Set the handler for ICE connection state
+	// This will notify you when the peer has connected/disconnected
+	peerConnection.OnICEConnectionStateChange(func(connectionState webrtc.ICEConnectionState) {
+		fmt.Printf("Connection State has changed %s \n", connectionState.String())
+		session.recordICEState(connectionState)
+		sessionSpan.SetAttributes(attribute.String("ice.state", connectionState.String()))
+		sessionSpan.AddEvent("ice.state", trace.WithAttributes(attribute.String("ice.state", connectionState.String())))
+
+		if connectionState == webrtc.ICEConnectionStateConnected {
+			fmt.Println("Ctrl+C the remote client to stop the demo")
+			session.iceConnected()
+			ready.Store(true)
+			events.publish("session.connected", session.id, nil)
+			session.logEvent("ice.connected", nil)
+
+			go func() {
+				pair, ok := selectedCandidatePair(peerConnection.GetStats())
+				if !ok {
+					fmt.Printf("Session %s: no nominated ICE candidate pair in stats\n", session.id)
+					return
+				}
+				fmt.Printf("Session %s: selected ICE candidate pair local %s, remote %s, RTT %.0fms\n", session.id, pair.LocalCandidateType, pair.RemoteCandidateType, pair.RTTMs)
+				if err := session.update(func(meta *sessionMetadata) { meta.ICESelectedPair = pair }); err != nil {
+					fmt.Println("Error writing session metadata:", err)
+				}
+			}()
+		} else if connectionState == webrtc.ICEConnectionStateDisconnected {
+			// ICE may still recover, the session is only torn down once it fails. Restarting ICE
+			// gets a connection whose network changed back sooner.
+			fmt.Println("Connection interrupted, restarting ICE")
+			session.logEvent("ice.disconnected", nil)
+			go session.startICERestart(cfg)
+		} else if connectionState == webrtc.ICEConnectionStateFailed || connectionState == webrtc.ICEConnectionStateClosed {
+			reason, first, endErr := session.end()
+			if !first {
+				return
+			}
+			if endErr != nil {
+				fmt.Println("Error writing session metadata:", endErr)
+			}
+			fmt.Printf("Session %s ended: %s\n", session.id, reason)
+			events.publish("session.closed", session.id, fiber.Map{"teardownReason": reason})
+			session.logEvent("session.closed", fiber.Map{"teardownReason": reason})
+			if delay, ok := delays.Median(); ok {
+				fmt.Printf("Session %s: median one-way delay %.1fms\n", session.id, float64(delay.Microseconds())/1000)
+			}
+			sessionSpan.SetAttributes(attribute.String("session.teardown_reason", string(reason)))
+			sessionSpan.End()
+			session.setForwarders(nil)
+			session.scheduleScreenshots(0)
+
+			// Closing the connection ends the tracks, their pipelines close the files once the last
+			// sample is written. This runs in a pion callback, so failures are logged, not raised.
+			if closeErr := peerConnection.Close(); closeErr != nil {
+				fmt.Printf("cannot close peerConnection: %v\n", closeErr)
+			}
+			if closeErr := audioRecording.stop(); closeErr != nil {
+				fmt.Println("Error closing the audio recording:", closeErr)
+			}
+			if closeErr := videoRecording.stop(); closeErr != nil {
+				fmt.Println("Error closing the video recording:", closeErr)
+			}
+
+			fmt.Println("Done writing media files")
+			session.unlockDir()
+			session.checkFilesClosed()
+			if err := session.writeCodecStats(); err != nil {
+				fmt.Println("Error writing codec stats:", err)
+			}
+			if err := session.writeChecksums(); err != nil {
+				fmt.Println("Error writing checksums:", err)
+			}
+			scheduleArchive(cfg, session.id)
 		}
+	})
 
+	if onICECandidate != nil || cfg.ICECandidateLog {
+		peerConnection.OnICECandidate(func(candidate *webrtc.ICECandidate) {
+			if cfg.ICECandidateLog {
+				logICECandidate(session.id, candidate)
+			}
+			if candidate != nil && !candidateAllowed(candidate.ToJSON().Candidate, cfg.ICECandidateTypes) {
+				return
+			}
+			if onICECandidate != nil {
+				onICECandidate(candidate)
+			}
+		})
+	}
+
+	// Set the remote SessionDescription
+	if err = peerConnection.SetRemoteDescription(offer); err != nil {
+		return fail(err)
+	}
+
+	// Create answer
+	answer, err := peerConnection.CreateAnswer(nil)
+	if err != nil {
+		return fail(err)
+	}
+
+	// Create channel that is blocked until ICE Gathering is complete
+	gatherComplete := webrtc.GatheringCompletePromise(peerConnection)
+
+	// Sets the LocalDescription, and starts our UDP listeners
+	if err = peerConnection.SetLocalDescription(answer); err != nil {
+		return fail(err)
+	}
+
+	// Without a way to trickle candidates we block until ICE Gathering is complete,
+	// since we only can exchange one signaling message
+	if onICECandidate == nil {
+		_, gatherSpan := tracer.Start(ctx, "ice.gather")
 		<-gatherComplete
-		return c.SendString(encode(peerConnection.LocalDescription()))
+		gatherSpan.End()
+	}
+
+	return session, peerConnection, nil
+}
 
+func main() {
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if cfg.ICECandidateLog {
+		// Candidates are logged at debug level, which the default logger drops
+		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	}
+
+	if err := os.MkdirAll(filesDir, 0o755); err != nil {
+		log.Fatalf("Cannot create storage directory: %v", err)
+	}
+	if err := recoverOrphanedFiles(".", filesDir); err != nil {
+		log.Fatalf("Cannot recover orphaned recordings: %v", err)
+	}
+	if err := loadSessions(filesDir); err != nil {
+		log.Fatalf("Cannot load sessions: %v", err)
+	}
+	watcher, err := watchSessions(filesDir)
+	if err != nil {
+		log.Fatalf("Cannot watch storage directory: %v", err)
+	}
+	defer watcher.Close()
+
+	shutdownTracing, err := setupTracing(context.Background())
+	if err != nil {
+		log.Fatalf("Cannot set up tracing: %v", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	// GET /ready reports 503 until a loopback connection shows the WebRTC stack works
+	go runReadinessProbe()
+
+	app := newApp(cfg)
+
+	if cfg.EnableWebTransport {
+		go func() {
+			log.Fatal(serveWebTransport(cfg))
+		}()
+	}
+
+	log.Fatal(app.Listen(":4000"))
+}
+
+// newApp sets up the middleware and the routes of the HTTP API
+func newApp(cfg Config) *fiber.App {
+	app := fiber.New(fiber.Config{
+		ReadTimeout:  cfg.ServerReadTimeout,
+		WriteTimeout: cfg.ServerWriteTimeout,
+		IdleTimeout:  cfg.ServerIdleTimeout,
+		BodyLimit:    cfg.ServerBodyLimit,
 	})
+	app.Use(recoverMiddleware())
+	app.Use(tracingMiddleware)
+	app.Use(compressionMiddleware(cfg))
+
+	app.Use(cors.New(cors.Config{
+		AllowOrigins: "http://localhost:5173", // Allow specific origin
+		AllowMethods: "GET,POST,PUT,PATCH,DELETE,OPTIONS",
+		// Authorization carries ADMIN_TOKEN, which GET /getFiles and PUT /files/:uuid/video may need
+		AllowHeaders: "Origin, Content-Type, Accept, If-Match, Authorization",
+		// The answer of /video names its playback in X-Session-Id
+		ExposeHeaders: "X-Session-Id, ETag",
+		// Spares signaling clients a preflight before every cross-origin POST
+		MaxAge: cfg.CORSMaxAge,
+	}))
+	app.Post("/video", handleVideo(cfg, func() (PeerConnectionInterface, error) {
+		return newPlaybackPeerConnection(cfg)
+	}))
 	app.Get("/", func(c *fiber.Ctx) error {
 		return c.SendString("Hello, World!")
 	})
 
-	app.Get("/getFiles", func(c *fiber.Ctx) error {
+	app.Get("/getFiles", append(listingGuard(cfg), func(c *fiber.Ctx) error {
 
 		dir := "./files" // Adjust this path as needed
 
@@ -341,224 +823,89 @@ func main() {
 		return c.JSON(fiber.Map{
 			"uuids": uuids,
 		})
-	})
+	})...)
+	app.Get("/ready", handleReady)
+	app.Get("/files/:uuid/video", handleVideoFile)
+	app.Put("/files/:uuid/video", adminAuth(cfg), handleReplaceVideo)
+	app.Get("/files/:uuid/audio", handleAudioFile)
+	app.Get("/files/:uuid/bundle", handleBundle)
+	app.Get("/files/:uuid/probe", handleProbe)
+	app.Get("/files/:uuid/timeline", handleTimeline)
+	app.Get("/files/:uuid/webm", handleWebMFile)
+	// Segments are read only, and numbered per kind, hence GET under /segment/video/ and /segment/audio/
+	app.Get("/files/:uuid/segments", handleSegments)
+	app.Get("/files/:uuid/segment/video/:index", handleSegmentFile(webrtc.RTPCodecTypeVideo))
+	app.Get("/files/:uuid/segment/audio/:index", handleSegmentFile(webrtc.RTPCodecTypeAudio))
+	app.Get("/events", handleEvents)
+	app.Get("/files/:uuid/status", handleStatus)
+	app.Get("/files/:uuid/verify", handleVerify)
+	app.Get("/files/:uuid/silence", handleSilence(cfg))
+	app.Patch("/files/:uuid/metadata", handleUpdateMetadata)
+	app.Post("/files/batch-upload", handleBatchUpload(cfg))
+	app.Post("/files/:uuid/export/webm", handleExportWebM)
+	app.Post("/files/:uuid/trim", handleTrim)
+	app.Post("/files/:uuid/normalize", handleNormalize)
+	app.Post("/files/:uuid/merge", handleMerge)
+	app.Get("/player/:uuid", handlePlayer)
+	app.Post("/sessions", handleCreateSession)
+	app.Post("/sessions/:uuid/offer", handleSessionOffer(cfg))
+	app.Post("/sessions/:uuid/reprocess", handleReprocess)
+	app.Post("/sessions/:uuid/channels", handleOpenChannel(cfg))
+	app.Post("/sessions/:uuid/renegotiate", handleRenegotiate(cfg))
+	app.Post("/sessions/:uuid/keyframe", handleKeyframe)
+	app.Post("/sessions/:uuid/screenshot/schedule", handleScheduleScreenshots)
+	app.Patch("/sessions/:uuid/codecConfig", handleCodecConfig)
+	app.Post("/sessions/:uuid/dtmf", handleDTMF)
+	app.Get("/sessions/:uuid/webrtc-stats", handleWebRTCStats)
+	app.Get("/sessions/:uuid/signaling", handleSignaling)
+	app.Post("/sessions/:uuid/answer", handleAnswer)
+	app.Post("/sessions/:uuid/annotations", handleAddAnnotation)
+	app.Post("/sessions/:uuid/transcript", handleTranscript(cfg))
+	app.Get("/sessions/:uuid/annotations", handleListAnnotations)
+	app.Post("/sessions/:uuid/export/webvtt", handleExportWebVTT)
+	app.Post("/validate/sdp", handleValidateSDP)
+
+	// Admin endpoints are only served in this group behind adminAuth. Of the public routes only
+	// PUT /files/:uuid/video, and GET /getFiles with LISTING_REQUIRES_AUTH, take the admin token too.
+	admin := app.Group("/admin", adminAuth(cfg))
+	admin.Post("/simulate/offer", handleSimulateOffer(cfg))
+	admin.Post("/debug/gc", handleDebugGC)
+	admin.Post("/sessions/:uuid/inject", handleInject)
+	admin.Post("/benchmark/signaling", handleSignalingBenchmark(cfg))
+	admin.Post("/sessions/:uuid/forward", handleForward(cfg))
+	admin.Get("/test/webrtc", handleWebRTCSelfTest)
+
 	app.Post("/", func(c *fiber.Ctx) error {
-		var body map[string]interface{}
-		if err := c.BodyParser(&body); err != nil {
-			return err
-		}
-		param, ok := body["param"].(string)
+		offer, ok, err := readOffer(c)
 		if !ok {
-			return c.SendString("Parameter 'param' not found or not a string")
-		}
-
-		m := &webrtc.MediaEngine{}
-
-		// Setup the codecs you want to use.
-		// We'll use a VP8 and Opus but you can also define your own
-		if err := m.RegisterCodec(webrtc.RTPCodecParameters{
-			RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8, ClockRate: 90000, Channels: 0, SDPFmtpLine: "", RTCPFeedback: nil},
-			PayloadType:        96,
-		}, webrtc.RTPCodecTypeVideo); err != nil {
-			panic(err)
-		}
-		if err := m.RegisterCodec(webrtc.RTPCodecParameters{
-			RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus, ClockRate: 48000, Channels: 0, SDPFmtpLine: "", RTCPFeedback: nil},
-			PayloadType:        111,
-		}, webrtc.RTPCodecTypeAudio); err != nil {
-			panic(err)
-		}
-
-		// Create a InterceptorRegistry. This is the user configurable RTP/RTCP Pipeline.
-		// This provides NACKs, RTCP Reports and other features. If you use `webrtc.NewPeerConnection`
-		// this is enabled by default. If you are manually managing You MUST create a InterceptorRegistry
-		// for each PeerConnection.
-		i := &interceptor.Registry{}
-
-		// Register a intervalpli factory
-		// This interceptor sends a PLI every 3 seconds. A PLI causes a video keyframe to be generated by the sender.
-		// This makes our video seekable and more error resilent, but at a cost of lower picture quality and higher bitrates
-		// A real world application should process incoming RTCP packets from viewers and forward them to senders
-		intervalPliFactory, err := intervalpli.NewReceiverInterceptor()
-		if err != nil {
-			panic(err)
-		}
-		i.Add(intervalPliFactory)
-
-		// Use the default set of Interceptors
-		if err = webrtc.RegisterDefaultInterceptors(m, i); err != nil {
-			panic(err)
-		}
-
-		// Create the API object with the MediaEngine
-		api := webrtc.NewAPI(webrtc.WithMediaEngine(m), webrtc.WithInterceptorRegistry(i))
-
-		// Prepare the configuration
-		config := webrtc.Configuration{
-			ICEServers: []webrtc.ICEServer{
-				{
-					URLs: []string{"stun:stun.l.google.com:19302"},
-				},
-			},
-		}
-
-		// Create a new RTCPeerConnection
-		peerConnection, err := api.NewPeerConnection(config)
-		if err != nil {
-			panic(err)
-		}
-
-		// Allow us to receive 1 audio track, and 1 video track
-		if _, err = peerConnection.AddTransceiverFromKind(webrtc.RTPCodecTypeAudio); err != nil {
-			panic(err)
-		} else if _, err = peerConnection.AddTransceiverFromKind(webrtc.RTPCodecTypeVideo); err != nil {
-			panic(err)
-		}
-		id := uuid.New()
-		oggfs := afero.NewOsFs()
-
-		destPathIvf := "files/" + id.String() + "/output.ivf"
-		destpathOgg := "files/" + id.String() + "/output.opus"
-
-		// Move the file
-		errogg := oggfs.Mkdir("files/"+id.String(), 48000)
-		if errogg != nil {
-			fmt.Println("Error creating directory:", errogg)
-		} else {
-			fmt.Println("Directory created successfully!")
-		}
-
-		// destPathIvf := "files/" + id.String() + "/output.ivf"
-
-		oggFile, err := oggwriter.New(destpathOgg, 48000, 2)
-		if err != nil {
-			panic(err)
+			return err
 		}
-		ivfFile, err := ivfwriter.New(destPathIvf)
+		quality, err := requestQuality(c, cfg)
 		if err != nil {
-			panic(err)
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error(), "field": "quality"})
 		}
+		cfg := cfg
+		cfg.RecordingQuality = quality
 
-		// Set a handler for when a new remote track starts, this handler saves buffers to disk as
-		// an ivf file, since we could have multiple video tracks we provide a counter.
-		// In your application this is where you would handle/process video
-		peerConnection.OnTrack(func(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) { //nolint: revive
-			codec := track.Codec()
-			if strings.EqualFold(codec.MimeType, webrtc.MimeTypeOpus) {
-				fmt.Println("Got Opus track, saving to disk as output.opus (48 kHz, 2 channels)")
-				saveToDisk(oggFile, track)
-			} else if strings.EqualFold(codec.MimeType, webrtc.MimeTypeVP8) {
-				fmt.Println("Got VP8 track, saving to disk as output.ivf")
-				saveToDisk(ivfFile, track)
-			}
-		})
-
-		// Set the handler for ICE connection state
-		// This will notify you when the peer has connected/disconnected
-		peerConnection.OnICEConnectionStateChange(func(connectionState webrtc.ICEConnectionState) {
-			fmt.Printf("Connection State has changed %s \n", connectionState.String())
-
-			if connectionState == webrtc.ICEConnectionStateConnected {
-				fmt.Println("Ctrl+C the remote client to stop the demo")
-			} else if connectionState == webrtc.ICEConnectionStateFailed || connectionState == webrtc.ICEConnectionStateClosed || connectionState == webrtc.ICEConnectionStateDisconnected {
-				if closeErr := oggFile.Close(); closeErr != nil {
-					panic(closeErr)
-				}
-
-				if closeErr := ivfFile.Close(); closeErr != nil {
-					panic(closeErr)
-				}
-				// id := uuid.New()
-				// fs := afero.NewOsFs()
-				// dirPath := "files/" + id.String() // Replace with your actual directory ID or name
-
-				// err := fs.MkdirAll(dirPath, 0755)
-				// if err != nil {
-				// 	fmt.Println("Error creating directory:", err)
-				// } else {
-				// 	fmt.Println("Directory created successfully!")
-				// }
-				// ivffs := afero.NewOsFs()
-
-				// destPathIvf := "files/" + id.String() + "/output.ivf"
-
-				// // Move the file
-				// errivf := ivffs.Rename("output.ivf", destPathIvf)
-				// if errivf != nil {
-				// 	fmt.Println("Error moving file:", errivf)
-				// } else {
-				// 	fmt.Println("File moved successfully!")
-				// }
-
-				// oggfs := afero.NewOsFs()
-
-				// destPathOgg := "files/" + id.String() + "/output.ogg"
-
-				// errogg := oggfs.Rename("output.ogg", destPathOgg)
-				// if errogg != nil {
-				// 	fmt.Println("Error moving file:", errogg)
-				// } else {
-				// 	fmt.Println("File moved successfully!")
-				// }
-
-				// if err != nil {
-				// 	fmt.Println(err)
-				// } else {
-				// 	fmt.Println("Directory created successfully!")
-				// }
-
-				fmt.Println("Done writing media files")
-
-				// Gracefully shutdown the peer connection
-				if closeErr := peerConnection.Close(); closeErr != nil {
-					panic(closeErr)
-				}
-
-				// os.Exit(0)
-
+		// A client that lost its connection can send its session id as reconnect to record on into the same files
+		var resumed *recordingSession
+		if id := requestReconnect(c); id != "" {
+			if resumed, err = claimReconnect(cfg, id); err != nil {
+				return sendError(c, err)
 			}
-		})
-
-		// Wait for the offer to be pasted
-		offer := webrtc.SessionDescription{}
-		decode(param, &offer)
-
-		// Set the remote SessionDescription
-		err = peerConnection.SetRemoteDescription(offer)
-		if err != nil {
-			panic(err)
 		}
-
-		// Create answer
-		answer, err := peerConnection.CreateAnswer(nil)
+		_, answer, err := NewRecordingSession(c.UserContext(), cfg, resumed, offer)
 		if err != nil {
-			panic(err)
-		}
-
-		// Create channel that is blocked until ICE Gathering is complete
-		gatherComplete := webrtc.GatheringCompletePromise(peerConnection)
-
-		// Sets the LocalDescription, and starts our UDP listeners
-		err = peerConnection.SetLocalDescription(answer)
-		if err != nil {
-			panic(err)
+			if resumed != nil {
+				resumed.releaseReconnect()
+			}
+			return sendError(c, sessionLockedError(err))
 		}
 
-		// Block until ICE Gathering is complete, disabling trickle ICE
-		// we do this because we only can exchange one signaling message
-		// in a production application you should exchange ICE Candidates via OnICECandidate
-		<-gatherComplete
-
-		// Output the answer in base64 so we can paste it in browser
-		return c.SendString(encode(peerConnection.LocalDescription()))
-
-		// // Block forever
-		// select {}
-
-		// return c.SendString("POST request " + param)
+		// Output the answer in base64 so we can paste it in browser, protobuf offers get a protobuf answer
+		return respondWithSDP(c, &answer)
 	})
-
-	log.Fatal(app.Listen(":4000"))
+	return app
 }
 
 func readUntilNewline(param any) (in string) {
@@ -580,6 +927,38 @@ func readUntilNewline(param any) (in string) {
 	return
 }
 
+// readOffer decodes the offer sent to POST / or POST /sessions/:uuid/offer, base64 JSON in the param
+// field or a protobuf body. When ok is false the request was rejected and err is what the handler returns.
+func readOffer(c *fiber.Ctx) (offer webrtc.SessionDescription, ok bool, err error) {
+	if isProtobuf(c) {
+		_, decodeSpan := tracer.Start(c.UserContext(), "sdp.decode")
+		err := decodeProtobuf(c.Body(), &offer)
+		endSpan(decodeSpan, err)
+		if err != nil {
+			return offer, false, sendDecodeError(c, "body", err)
+		}
+		return offer, true, nil
+	}
+
+	var body map[string]interface{}
+	if err := c.BodyParser(&body); err != nil {
+		return offer, false, err
+	}
+	param, found := body["param"].(string)
+	if !found {
+		return offer, false, c.SendString("Parameter 'param' not found or not a string")
+	}
+
+	// Wait for the offer to be pasted
+	_, decodeSpan := tracer.Start(c.UserContext(), "sdp.decode")
+	err = decode(param, &offer)
+	endSpan(decodeSpan, err)
+	if err != nil {
+		return offer, false, sendDecodeError(c, "param", err)
+	}
+	return offer, true, nil
+}
+
 // JSON encode + base64 a SessionDescription
 func encode(obj *webrtc.SessionDescription) string {
 	b, err := json.Marshal(obj)
@@ -590,14 +969,32 @@ func encode(obj *webrtc.SessionDescription) string {
 	return base64.StdEncoding.EncodeToString(b)
 }
 
-// Decode a base64 and unmarshal JSON into a SessionDescription
-func decode(in string, obj *webrtc.SessionDescription) {
+var (
+	errInvalidBase64 = errors.New("invalid base64")
+	errInvalidJSON   = errors.New("invalid JSON")
+)
+
+// Decode a base64 and unmarshal JSON into a SessionDescription.
+// The base64 is checked first so clients can tell an encoding problem from a malformed description.
+func decode(in string, obj *webrtc.SessionDescription) error {
 	b, err := base64.StdEncoding.DecodeString(in)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("%w: %v", errInvalidBase64, err)
 	}
 
 	if err = json.Unmarshal(b, obj); err != nil {
-		panic(err)
+		return fmt.Errorf("%w: %v", errInvalidJSON, err)
+	}
+	return nil
+}
+
+// sendDecodeError responds to a decode error with a 400 naming the body field that held the description
+func sendDecodeError(c *fiber.Ctx, field string, err error) error {
+	msg := errInvalidJSON.Error()
+	if errors.Is(err, errInvalidBase64) {
+		msg = errInvalidBase64.Error()
+	} else if errors.Is(err, errInvalidProtobuf) {
+		msg = errInvalidProtobuf.Error()
 	}
+	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg, "field": field})
 }
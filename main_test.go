@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media"
+	"github.com/pion/webrtc/v3/pkg/media/ivfreader"
+)
+
+func TestCORSPreflightMaxAge(t *testing.T) {
+	tests := []struct {
+		env, want string
+	}{
+		{"", "86400"},
+		{"600", "600"},
+	}
+	for _, tt := range tests {
+		t.Setenv("CORS_MAX_AGE", tt.env)
+		cfg, err := loadConfig()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req := httptest.NewRequest(fiber.MethodOptions, "/", nil)
+		req.Header.Set(fiber.HeaderOrigin, "http://localhost:5173")
+		req.Header.Set(fiber.HeaderAccessControlRequestMethod, fiber.MethodPost)
+		resp, err := newApp(cfg).Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != fiber.StatusNoContent {
+			t.Errorf("CORS_MAX_AGE=%q: preflight status %d, want 204", tt.env, resp.StatusCode)
+		}
+		if got := resp.Header.Get(fiber.HeaderAccessControlMaxAge); got != tt.want {
+			t.Errorf("CORS_MAX_AGE=%q: Access-Control-Max-Age %q, want %q", tt.env, got, tt.want)
+		}
+	}
+}
+
+func TestCORSPreflightAuthorization(t *testing.T) {
+	t.Setenv("LISTING_REQUIRES_AUTH", "true")
+	t.Setenv("ADMIN_TOKEN", testAdminToken)
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, route := range [][2]string{{fiber.MethodGet, "/getFiles"}, {fiber.MethodPut, "/files/" + uuid.NewString() + "/video"}} {
+		req := httptest.NewRequest(fiber.MethodOptions, route[1], nil)
+		req.Header.Set(fiber.HeaderOrigin, "http://localhost:5173")
+		req.Header.Set(fiber.HeaderAccessControlRequestMethod, route[0])
+		req.Header.Set(fiber.HeaderAccessControlRequestHeaders, "authorization")
+		resp, err := newApp(cfg).Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if allowed := resp.Header.Get(fiber.HeaderAccessControlAllowHeaders); !strings.Contains(allowed, "Authorization") {
+			t.Errorf("preflight of %s %s allows %q, want Authorization among them", route[0], route[1], allowed)
+		}
+	}
+}
+
+func TestLoadConfigServerLimits(t *testing.T) {
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ServerWriteTimeout != 0 {
+		t.Errorf("default write timeout %v, want 0 so streamed responses are not cut off", cfg.ServerWriteTimeout)
+	}
+	if cfg.ServerBodyLimit != fiber.DefaultBodyLimit {
+		t.Errorf("default body limit %d, want Fiber's %d", cfg.ServerBodyLimit, fiber.DefaultBodyLimit)
+	}
+
+	t.Setenv("SERVER_WRITE_TIMEOUT", "0")
+	if _, err := loadConfig(); err != nil {
+		t.Errorf("SERVER_WRITE_TIMEOUT=0: %v", err)
+	}
+	t.Setenv("SERVER_WRITE_TIMEOUT", "-1s")
+	if _, err := loadConfig(); err == nil {
+		t.Error("SERVER_WRITE_TIMEOUT=-1s was accepted")
+	}
+}
+
+func TestUploadWithinDefaultBodyLimit(t *testing.T) {
+	id := newTestSessionDir(t)
+	t.Setenv("ADMIN_TOKEN", testAdminToken)
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A megabyte of video is well past the 64KB signaling needs
+	req := httptest.NewRequest(fiber.MethodPut, "/files/"+id+"/video", bytes.NewReader(make([]byte, 1<<20)))
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer "+testAdminToken)
+	resp, err := newApp(cfg).Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode == fiber.StatusRequestEntityTooLarge {
+		t.Error("a 1MB upload was refused with the default body limit")
+	}
+}
+
+// waitFor polls cond until it holds, failing the test after timeout
+func waitFor(t *testing.T, timeout time.Duration, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(timeout); !cond(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+func TestRecordingTeardownClosesFiles(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.MkdirAll(filesDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	track, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8}, "video", "stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.AddTrack(track); err != nil {
+		t.Fatal(err)
+	}
+	offer, err := client.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gathered := webrtc.GatheringCompletePromise(client)
+	if err := client.SetLocalDescription(offer); err != nil {
+		t.Fatal(err)
+	}
+	<-gathered
+
+	session, server, err := startRecording(context.Background(), cfg, nil, *client.LocalDescription(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sessions.remove(session.id) })
+	if err := client.SetRemoteDescription(*server.LocalDescription()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Keyframes keep coming while the connection is closed under the pipeline
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+	go func() {
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := track.WriteSample(media.Sample{Data: []byte{0x10, 0x02, 0x00, 0x9d, 0x01, 0x2a}, Duration: 10 * time.Millisecond}); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	waitFor(t, 10*time.Second, "the video track", func() bool {
+		session.mu.Lock()
+		defer session.mu.Unlock()
+		return session.videoSSRC != 0
+	})
+	time.Sleep(200 * time.Millisecond)
+	if err := server.Close(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, 10*time.Second, "the teardown", func() bool {
+		session.mu.Lock()
+		defer session.mu.Unlock()
+		return session.meta.EndedAt != nil && session.dirLock == nil
+	})
+
+	file, err := os.Open(recordingPath(session.id, videoFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	r, header, err := ivfreader.NewWith(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var frames uint32
+	for {
+		if _, _, err := r.ParseNextFrame(); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			t.Fatalf("frame %d: %v", frames, err)
+		}
+		frames++
+	}
+	if frames == 0 || header.NumFrames != frames {
+		t.Errorf("header counts %d frames, the file holds %d", header.NumFrames, frames)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// mergeFiles runs fn from the files at first and second into a new file at dst
+func mergeFiles(first, second, dst string, fn func(first, second io.Reader, w io.Writer) error) error {
+	in, err := os.Open(second)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	return transformFile(first, dst, func(r io.Reader, w io.Writer) error {
+		return fn(r, in, w)
+	})
+}
+
+// handleMerge appends the recording targetUUID to the recording :uuid and stores the result as a new session.
+// Only streams present in both recordings are merged.
+func handleMerge(c *fiber.Ctx) error {
+	id := c.Params("uuid")
+	if !isUUID(id) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid session id"})
+	}
+
+	var body struct {
+		TargetUUID string `json:"targetUUID"`
+	}
+	if err := c.BodyParser(&body); err != nil || !isUUID(body.TargetUUID) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "targetUUID must be a session id"})
+	}
+	if body.TargetUUID == id {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot merge a recording with itself"})
+	}
+
+	type mergeStep struct {
+		name     string
+		validate func(string) error
+		merge    func(first, second io.Reader, w io.Writer) error
+	}
+	var steps []mergeStep
+	for _, step := range []mergeStep{
+		{videoFileName, validateIVFFile, MergeIVF},
+		{audioFileName, validateOGGFile, MergeOGG},
+	} {
+		if fileExists(recordingPath(id, step.name)) && fileExists(recordingPath(body.TargetUUID, step.name)) {
+			steps = append(steps, step)
+		}
+	}
+	if len(steps) == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "the recordings have no stream in common"})
+	}
+	for _, step := range steps {
+		for _, src := range []string{id, body.TargetUUID} {
+			if _, err := recordingFile(src, step.name, step.validate); err != nil {
+				return sendError(c, err)
+			}
+		}
+	}
+
+	merged := newRecordingSession(uuid.NewString())
+	if err := os.Mkdir(merged.dir, 0o755); err != nil {
+		return err
+	}
+	for _, step := range steps {
+		err := mergeFiles(recordingPath(id, step.name), recordingPath(body.TargetUUID, step.name), recordingPath(merged.id, step.name), step.merge)
+		if err != nil {
+			os.RemoveAll(merged.dir)
+			if errors.Is(err, errIncompatibleRecordings) {
+				return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()})
+			}
+			return err
+		}
+	}
+	if err := merged.update(func(*sessionMetadata) {}); err != nil {
+		os.RemoveAll(merged.dir)
+		return err
+	}
+	sessions.add(merged)
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"uuid": merged.id})
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	normalizedAudioFileName = "output_normalized.opus"
+	// r128ReferenceLUFS is the loudness R128 gains in Opus comment headers are relative to
+	r128ReferenceLUFS = -23
+	r128TrackGainTag  = "R128_TRACK_GAIN"
+	// loudnessTimeout bounds how long ffmpeg may take to measure one recording
+	loudnessTimeout = 2 * time.Minute
+)
+
+var errFFmpegMissing = errors.New("ffmpeg not found")
+
+// measureLoudness returns the integrated loudness of the audio file at path in LUFS, as measured by ffmpeg's loudnorm filter
+func measureLoudness(ctx context.Context, path string) (float64, error) {
+	ffmpeg, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		return 0, errFFmpegMissing
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, loudnessTimeout)
+	defer cancel()
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, ffmpeg, "-hide_banner", "-nostats", "-i", path, "-af", "loudnorm=print_format=json", "-f", "null", "-")
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return 0, fmt.Errorf("ffmpeg failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	// loudnorm prints its measurements as the last JSON object of the log
+	out := stderr.String()
+	start := strings.LastIndex(out, "{")
+	if start < 0 {
+		return 0, fmt.Errorf("no loudnorm measurements in ffmpeg output")
+	}
+	var stats struct {
+		InputI string `json:"input_i"`
+	}
+	if err := json.Unmarshal([]byte(out[start:strings.LastIndex(out, "}")+1]), &stats); err != nil {
+		return 0, fmt.Errorf("cannot parse loudnorm measurements: %w", err)
+	}
+	lufs, err := strconv.ParseFloat(stats.InputI, 64)
+	if err != nil || math.IsInf(lufs, 0) {
+		return 0, fmt.Errorf("%w: cannot measure loudness of silent or empty audio", errCorruptRecording)
+	}
+	return lufs, nil
+}
+
+// r128Gain returns the Q7.8 gain that brings audio of the given loudness to the R128 reference level
+func r128Gain(lufs float64) int {
+	gain := math.Round((r128ReferenceLUFS - lufs) * 256)
+	return int(math.Max(math.MinInt16, math.Min(math.MaxInt16, gain)))
+}
+
+// setOpusTag returns an OpusTags packet with tag set to value, replacing any previous value of tag
+func setOpusTag(packet []byte, tag, value string) ([]byte, error) {
+	errMalformed := fmt.Errorf("%w: malformed OpusTags header", errCorruptRecording)
+	if !bytes.HasPrefix(packet, []byte("OpusTags")) || len(packet) < 16 {
+		return nil, errMalformed
+	}
+	rest := packet[8:]
+	vendorLen := binary.LittleEndian.Uint32(rest)
+	if uint64(len(rest)) < 8+uint64(vendorLen) {
+		return nil, errMalformed
+	}
+	vendor := rest[4 : 4+vendorLen]
+	rest = rest[4+vendorLen:]
+	count := binary.LittleEndian.Uint32(rest)
+	rest = rest[4:]
+
+	var comments [][]byte
+	for i := uint32(0); i < count; i++ {
+		if len(rest) < 4 {
+			return nil, errMalformed
+		}
+		n := binary.LittleEndian.Uint32(rest)
+		if uint64(len(rest)) < 4+uint64(n) {
+			return nil, errMalformed
+		}
+		comment := rest[4 : 4+n]
+		rest = rest[4+n:]
+		if name, _, _ := strings.Cut(string(comment), "="); strings.EqualFold(name, tag) {
+			continue
+		}
+		comments = append(comments, comment)
+	}
+	comments = append(comments, []byte(tag+"="+value))
+
+	out := append([]byte("OpusTags"), binary.LittleEndian.AppendUint32(nil, vendorLen)...)
+	out = append(out, vendor...)
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(comments)))
+	for _, comment := range comments {
+		out = binary.LittleEndian.AppendUint32(out, uint32(len(comment)))
+		out = append(out, comment...)
+	}
+	// Anything after the comments is kept, the Opus mapping allows binary data there
+	return append(out, rest...), nil
+}
+
+// setOGGTrackGain copies the Ogg Opus stream r to w with R128_TRACK_GAIN set to gain in the comment header.
+// Pages are copied verbatim apart from the comment header page, which must fit in one page.
+func setOGGTrackGain(r io.Reader, w io.Writer, gain int) error {
+	for i := 0; ; i++ {
+		page, err := readOggPage(r)
+		if errors.Is(err, io.EOF) {
+			if i < 2 {
+				return fmt.Errorf("%w: missing Opus headers", errCorruptRecording)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if i == 1 {
+			if page.continued() {
+				return fmt.Errorf("%w: OpusTags header spans several pages", errCorruptRecording)
+			}
+			payload, err := setOpusTag(page.payload, r128TrackGainTag, strconv.Itoa(gain))
+			if err != nil {
+				return err
+			}
+			if page, err = page.withPayload(payload); err != nil {
+				return err
+			}
+		}
+		if _, err := w.Write(page.bytes()); err != nil {
+			return err
+		}
+	}
+}
+
+// handleNormalize measures the loudness of a recording and stores a copy tagged with the R128 track gain
+// that brings it to -23 LUFS. Players that honour the tag apply the gain, the audio itself is unchanged.
+func handleNormalize(c *fiber.Ctx) error {
+	srcPath, err := recordingFile(c.Params("uuid"), audioFileName, validateOGGFile)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	lufs, err := measureLoudness(c.UserContext(), srcPath)
+	if errors.Is(err, errFFmpegMissing) {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "loudness measurement requires ffmpeg"})
+	} else if errors.Is(err, errCorruptRecording) {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()})
+	} else if err != nil {
+		return err
+	}
+	gain := r128Gain(lufs)
+
+	dstPath := recordingPath(c.Params("uuid"), normalizedAudioFileName)
+	err = transformFile(srcPath, dstPath, func(r io.Reader, w io.Writer) error {
+		return setOGGTrackGain(r, w, gain)
+	})
+	if errors.Is(err, errCorruptRecording) {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()})
+	} else if err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{
+		"file":          normalizedAudioFileName,
+		"loudnessLUFS":  lufs,
+		"r128TrackGain": gain,
+	})
+}
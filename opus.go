@@ -0,0 +1,430 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3/pkg/media/oggreader"
+	"github.com/pion/webrtc/v3/pkg/media/oggwriter"
+)
+
+// opusClockRate is the rate of Ogg Opus granule positions, whatever the input sample rate was
+const opusClockRate = 48000
+
+// convertOGGToRawOpus strips the Ogg framing from an Opus recording and writes each Opus
+// packet prefixed with its length as a 4 byte big endian integer.
+// oggwriter stores every RTP payload in its own page, so a page holds exactly one packet.
+func convertOGGToRawOpus(r io.Reader, w io.Writer) error {
+	ogg, _, err := oggreader.NewWith(r)
+	if err != nil {
+		return err
+	}
+
+	lengthPrefix := make([]byte, 4)
+	for {
+		packet, _, err := ogg.ParseNextPage()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// The comment header is part of the Ogg mapping, not audio
+		if bytes.HasPrefix(packet, []byte("OpusTags")) || len(packet) == 0 {
+			continue
+		}
+
+		binary.BigEndian.PutUint32(lengthPrefix, uint32(len(packet)))
+		if _, err := w.Write(lengthPrefix); err != nil {
+			return err
+		}
+		if _, err := w.Write(packet); err != nil {
+			return err
+		}
+	}
+}
+
+// writeOpusPage appends a page payload to an oggwriter, which derives the granule position
+// from the RTP timestamp so the original granule can be passed through as the timestamp.
+// oggwriter only uses the differences between timestamps and treats a timestamp of 1 as unset,
+// so it is shifted by one: a first granule of 1 would otherwise swallow the next increment.
+func writeOpusPage(w *oggwriter.OggWriter, payload []byte, granule uint64) error {
+	return w.WriteRTP(&rtp.Packet{Header: rtp.Header{Timestamp: uint32(granule) + 1}, Payload: payload})
+}
+
+// TrimOGG copies the Opus pages of an Ogg stream between startMs and endMs to w as a new Ogg Opus stream
+func TrimOGG(r io.Reader, w io.Writer, startMs, endMs float64) error {
+	if endMs <= startMs {
+		return fmt.Errorf("end %fms is not after start %fms", endMs, startMs)
+	}
+
+	ogg, header, err := oggreader.NewWith(r)
+	if err != nil {
+		return err
+	}
+	out, err := oggwriter.NewWith(w, header.SampleRate, uint16(header.Channels))
+	if err != nil {
+		return err
+	}
+
+	for {
+		payload, pageHeader, err := ogg.ParseNextPage()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if bytes.HasPrefix(payload, []byte("OpusTags")) || len(payload) == 0 {
+			continue
+		}
+
+		timeMs := float64(pageHeader.GranulePosition) / opusClockRate * 1000
+		if timeMs >= endMs {
+			break
+		}
+		if timeMs < startMs {
+			continue
+		}
+		if err := writeOpusPage(out, payload, pageHeader.GranulePosition); err != nil {
+			return err
+		}
+	}
+	// Closing out would close w as well, which belongs to the caller
+	return nil
+}
+
+// oggSampleDuration is how long the Opus page with granule plays, the page before it ended at
+// lastGranule. After a seek or discontinuity the granule may stand still or go back, which would
+// give the sample no duration, one nominal 20ms frame is used then.
+func oggSampleDuration(granule, lastGranule uint64) time.Duration {
+	if sampleCount := int64(granule) - int64(lastGranule); sampleCount > 0 {
+		return time.Duration(sampleCount) * time.Second / opusClockRate
+	}
+	return oggPageDuration
+}
+
+const oggPageHeaderSize = 27
+
+// oggCRCTable is the lookup table of the Ogg page checksum, a CRC-32 with polynomial 0x04c11db7 that is not bit reflected
+var oggCRCTable = func() (table [256]uint32) {
+	for i := range table {
+		r := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if r&0x80000000 != 0 {
+				r = r<<1 ^ 0x04c11db7
+			} else {
+				r <<= 1
+			}
+		}
+		table[i] = r
+	}
+	return table
+}()
+
+// oggPage is a raw Ogg page, for rewriting pages that oggwriter cannot produce
+type oggPage struct {
+	header  []byte // the fixed 27 byte header followed by the segment table
+	payload []byte
+}
+
+// readOggPage reads the next page of an Ogg stream, io.EOF means the stream ended on a page boundary
+func readOggPage(r io.Reader) (*oggPage, error) {
+	header := make([]byte, oggPageHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, fmt.Errorf("%w: truncated Ogg page header", errCorruptRecording)
+		}
+		return nil, err
+	}
+	if string(header[:4]) != "OggS" {
+		return nil, fmt.Errorf("%w: bad Ogg capture pattern", errCorruptRecording)
+	}
+
+	segments := make([]byte, header[26])
+	if _, err := io.ReadFull(r, segments); err != nil {
+		return nil, fmt.Errorf("%w: truncated Ogg segment table", errCorruptRecording)
+	}
+	size := 0
+	for _, s := range segments {
+		size += int(s)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, fmt.Errorf("%w: truncated Ogg page", errCorruptRecording)
+	}
+	return &oggPage{header: append(header, segments...), payload: payload}, nil
+}
+
+// continued reports whether the last packet of the page carries on in the next page
+func (p *oggPage) continued() bool {
+	segments := p.header[oggPageHeaderSize:]
+	return len(segments) > 0 && segments[len(segments)-1] == 255
+}
+
+// withPayload returns a copy of the page holding payload as its only packet, with the checksum updated
+func (p *oggPage) withPayload(payload []byte) (*oggPage, error) {
+	segments := len(payload)/255 + 1
+	if segments > 255 {
+		return nil, fmt.Errorf("packet of %d bytes does not fit in one Ogg page", len(payload))
+	}
+
+	header := append([]byte{}, p.header[:oggPageHeaderSize]...)
+	header[26] = byte(segments)
+	for i := 0; i < segments-1; i++ {
+		header = append(header, 255)
+	}
+	header = append(header, byte(len(payload)%255))
+
+	page := &oggPage{header: header, payload: payload}
+	binary.LittleEndian.PutUint32(page.header[22:], 0)
+	var crc uint32
+	for _, b := range page.bytes() {
+		crc = crc<<8 ^ oggCRCTable[byte(crc>>24)^b]
+	}
+	binary.LittleEndian.PutUint32(page.header[22:], crc)
+	return page, nil
+}
+
+func (p *oggPage) bytes() []byte {
+	return append(append([]byte{}, p.header...), p.payload...)
+}
+
+// MergeOGG writes the Opus packets of first followed by those of second to w as one Ogg Opus stream.
+// Granule positions of second are shifted to continue after first, using the duration of the
+// last packet of first for the gap between the two and 20ms when first holds a single packet.
+func MergeOGG(first, second io.Reader, w io.Writer) error {
+	oggFirst, headerFirst, err := oggreader.NewWith(first)
+	if err != nil {
+		return err
+	}
+	oggSecond, headerSecond, err := oggreader.NewWith(second)
+	if err != nil {
+		return err
+	}
+	if headerFirst.Channels != headerSecond.Channels || headerFirst.SampleRate != headerSecond.SampleRate {
+		return fmt.Errorf("%w: audio channel counts or sample rates differ", errIncompatibleRecordings)
+	}
+	out, err := oggwriter.NewWith(w, headerFirst.SampleRate, uint16(headerFirst.Channels))
+	if err != nil {
+		return err
+	}
+
+	var (
+		lastGranule uint64
+		step        = uint64(oggPageDuration.Seconds() * opusClockRate)
+		pages       int
+	)
+	for {
+		payload, pageHeader, err := oggFirst.ParseNextPage()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if bytes.HasPrefix(payload, []byte("OpusTags")) || len(payload) == 0 {
+			continue
+		}
+		if pages > 0 && pageHeader.GranulePosition > lastGranule {
+			step = pageHeader.GranulePosition - lastGranule
+		}
+		lastGranule = pageHeader.GranulePosition
+		pages++
+
+		if err := writeOpusPage(out, payload, pageHeader.GranulePosition); err != nil {
+			return err
+		}
+	}
+
+	var offset, firstGranule uint64
+	started := false
+	for {
+		payload, pageHeader, err := oggSecond.ParseNextPage()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if bytes.HasPrefix(payload, []byte("OpusTags")) || len(payload) == 0 {
+			continue
+		}
+		if !started {
+			started = true
+			firstGranule = pageHeader.GranulePosition
+			if pages > 0 {
+				offset = lastGranule + step
+			}
+		}
+
+		if err := writeOpusPage(out, payload, offset+pageHeader.GranulePosition-firstGranule); err != nil {
+			return err
+		}
+	}
+	// Closing out would close w as well, which belongs to the caller
+	return nil
+}
+
+const oggEndOfStream = 0x04
+
+// oggAppender lets an oggwriter.OggWriter continue an Ogg Opus file. oggwriter writes each page in a
+// call of its own, starting with the ID and comment header pages, which the file already has. The
+// audio pages are rewritten into the stream of the file: its serial number, page sequence numbers
+// following its last page and granule positions moved past its last one.
+type oggAppender struct {
+	file          *os.File
+	serial        uint32
+	nextSequence  uint32
+	granuleOffset uint64
+
+	// last is the page written last and offset where it starts, it is marked as the end of the stream on Close
+	last   *oggPage
+	offset int64
+}
+
+func (a *oggAppender) Write(p []byte) (int, error) {
+	page, err := readOggPage(bytes.NewReader(p))
+	if err != nil {
+		return 0, err
+	}
+	if bytes.HasPrefix(page.payload, []byte("OpusHead")) || bytes.HasPrefix(page.payload, []byte("OpusTags")) {
+		return len(p), nil
+	}
+
+	binary.LittleEndian.PutUint64(page.header[6:], binary.LittleEndian.Uint64(page.header[6:])+a.granuleOffset)
+	binary.LittleEndian.PutUint32(page.header[14:], a.serial)
+	binary.LittleEndian.PutUint32(page.header[18:], a.nextSequence)
+	if page, err = page.withPayload(page.payload); err != nil {
+		return 0, err
+	}
+	if a.offset, err = a.file.Seek(0, io.SeekCurrent); err != nil {
+		return 0, err
+	}
+	if _, err := a.file.Write(page.bytes()); err != nil {
+		return 0, err
+	}
+	a.nextSequence++
+	a.last = page
+	return len(p), nil
+}
+
+// Close marks the last page as the end of the stream, which oggwriter only does for files it created itself
+func (a *oggAppender) Close() error {
+	return closeOggFile(a.file, a.last, a.offset)
+}
+
+// oggFile is a new Ogg Opus file written by an oggwriter.OggWriter made with NewWith, it marks the
+// last page as the end of the stream on Close like oggwriter does for the files it creates
+type oggFile struct {
+	file   *os.File
+	last   *oggPage
+	offset int64
+}
+
+func (f *oggFile) Write(p []byte) (int, error) {
+	page, err := readOggPage(bytes.NewReader(p))
+	if err != nil {
+		return 0, err
+	}
+	offset, err := f.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	n, err := f.file.Write(p)
+	if err != nil {
+		return n, err
+	}
+	f.last, f.offset = page, offset
+	return n, nil
+}
+
+func (f *oggFile) Close() error {
+	return closeOggFile(f.file, f.last, f.offset)
+}
+
+// closeOggFile marks last, the page at offset, as the end of the stream and closes file
+func closeOggFile(file *os.File, last *oggPage, offset int64) error {
+	if last != nil {
+		if err := markOggPage(file, last, offset, last.header[5]|oggEndOfStream); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	return file.Close()
+}
+
+// markOggPage rewrites the header type of the page at offset in file
+func markOggPage(file *os.File, page *oggPage, offset int64, headerType byte) error {
+	page.header[5] = headerType
+	page, err := page.withPayload(page.payload)
+	if err != nil {
+		return err
+	}
+	_, err = file.WriteAt(page.bytes(), offset)
+	return err
+}
+
+// AppendOGG writes more packets to the Ogg Opus file, opened for reading and writing, after the ones
+// it holds. A page cut short, as left by a process that stopped while writing, is dropped, and an
+// end of stream mark on the last page is cleared. The appended packets start 20ms after the last one
+// in the file, like MergeOGG leaves between two recordings. The writer closes file, as does a failure.
+func AppendOGG(file *os.File) (*oggwriter.OggWriter, error) {
+	fail := func(err error) (*oggwriter.OggWriter, error) {
+		file.Close()
+		return nil, err
+	}
+
+	first, err := readOggPage(file)
+	if err != nil || !bytes.HasPrefix(first.payload, []byte("OpusHead")) || len(first.payload) < 19 {
+		return fail(fmt.Errorf("%w: no Opus ID header", errCorruptRecording))
+	}
+	appender := &oggAppender{
+		file:         file,
+		serial:       binary.LittleEndian.Uint32(first.header[14:]),
+		nextSequence: binary.LittleEndian.Uint32(first.header[18:]) + 1,
+	}
+
+	var (
+		last        = first
+		lastOffset  int64
+		end         = int64(len(first.header) + len(first.payload))
+		lastGranule uint64
+	)
+	for {
+		page, err := readOggPage(file)
+		if err != nil {
+			break
+		}
+		lastOffset, last = end, page
+		end += int64(len(page.header) + len(page.payload))
+		appender.nextSequence = binary.LittleEndian.Uint32(page.header[18:]) + 1
+		lastGranule = max(lastGranule, binary.LittleEndian.Uint64(page.header[6:]))
+	}
+	if err := file.Truncate(end); err != nil {
+		return fail(err)
+	}
+	if last.header[5]&oggEndOfStream != 0 {
+		if err := markOggPage(file, last, lastOffset, last.header[5]&^oggEndOfStream); err != nil {
+			return fail(err)
+		}
+	}
+	if _, err := file.Seek(end, io.SeekStart); err != nil {
+		return fail(err)
+	}
+	appender.granuleOffset = lastGranule + uint64(oggPageDuration.Seconds()*opusClockRate)
+
+	head := first.payload
+	writer, err := oggwriter.NewWith(appender, binary.LittleEndian.Uint32(head[12:]), uint16(head[9]))
+	if err != nil {
+		return fail(err)
+	}
+	return writer, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3/pkg/media/oggreader"
+	"github.com/pion/webrtc/v3/pkg/media/oggwriter"
+)
+
+// oggStreamWithGranules writes an Ogg Opus stream with one audio page for each of granules, which
+// are set as the pages' granule positions whether they advance or not
+func oggStreamWithGranules(t *testing.T, granules []uint64) []byte {
+	t.Helper()
+
+	var written bytes.Buffer
+	w, err := oggwriter.NewWith(&written, opusClockRate, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range granules {
+		packet := &rtp.Packet{Header: rtp.Header{Timestamp: uint32(960 * i)}, Payload: []byte{0xfc, byte(i)}}
+		if err := w.WriteRTP(packet); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The ID and comment header pages come first and keep their granule of 0
+	var out bytes.Buffer
+	for i := 0; ; i++ {
+		page, err := readOggPage(&written)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i >= 2 {
+			binary.LittleEndian.PutUint64(page.header[6:], granules[i-2])
+			if page, err = page.withPayload(page.payload); err != nil {
+				t.Fatal(err)
+			}
+		}
+		out.Write(page.bytes())
+	}
+	return out.Bytes()
+}
+
+func TestOggSampleDurationDiscontinuity(t *testing.T) {
+	// 20ms, 40ms, a page that stands still, one that goes back and one that continues after it
+	granules := []uint64{960, 2880, 2880, 960, 1920}
+	ogg, _, err := oggreader.NewWith(bytes.NewReader(oggStreamWithGranules(t, granules)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		durations   []time.Duration
+		lastGranule uint64
+	)
+	for {
+		_, header, err := ogg.ParseNextPage()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header.GranulePosition == 0 {
+			// The OpusTags page
+			continue
+		}
+		durations = append(durations, oggSampleDuration(header.GranulePosition, lastGranule))
+		lastGranule = header.GranulePosition
+	}
+
+	want := []time.Duration{
+		20 * time.Millisecond,
+		40 * time.Millisecond,
+		oggPageDuration,
+		oggPageDuration,
+		20 * time.Millisecond,
+	}
+	if !slices.Equal(durations, want) {
+		t.Errorf("sample durations %v, want %v", durations, want)
+	}
+}
+
+func TestOggSampleDuration(t *testing.T) {
+	tests := []struct {
+		granule, lastGranule uint64
+		want                 time.Duration
+	}{
+		{960, 0, 20 * time.Millisecond},
+		{1440, 960, 10 * time.Millisecond},
+		{960, 960, oggPageDuration},
+		{0, 960, oggPageDuration},
+	}
+	for _, tt := range tests {
+		if got := oggSampleDuration(tt.granule, tt.lastGranule); got != tt.want {
+			t.Errorf("oggSampleDuration(%d, %d) = %v, want %v", tt.granule, tt.lastGranule, got, tt.want)
+		}
+	}
+}
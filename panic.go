@@ -0,0 +1,44 @@
+package main
+
+import (
+	"log/slog"
+	"runtime/debug"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/google/uuid"
+)
+
+// panicRequestIDKey is the local under which recoverMiddleware keeps the request id of a request whose handler panicked
+const panicRequestIDKey = "panicRequestID"
+
+// recoverMiddleware turns a panic in a handler into a 500 with the request id, which is logged with
+// the stack trace so the response can be matched with the log. The id is the X-Request-ID of the
+// request, or a new one when the client sent none. Panics in goroutines started by handlers still crash the server.
+func recoverMiddleware() fiber.Handler {
+	recoverPanics := recover.New(recover.Config{
+		EnableStackTrace: true,
+		StackTraceHandler: func(c *fiber.Ctx, e interface{}) {
+			requestID := c.Get(fiber.HeaderXRequestID)
+			if requestID == "" {
+				requestID = uuid.NewString()
+			}
+			c.Locals(panicRequestIDKey, requestID)
+			slog.Error("panic in handler",
+				"requestID", requestID,
+				"method", c.Method(),
+				"path", c.Path(),
+				"panic", e,
+				"stack", string(debug.Stack()),
+			)
+		},
+	})
+	return func(c *fiber.Ctx) error {
+		err := recoverPanics(c)
+		if requestID, ok := c.Locals(panicRequestIDKey).(string); ok {
+			c.Set(fiber.HeaderXRequestID, requestID)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal server error", "requestID": requestID})
+		}
+		return err
+	}
+}
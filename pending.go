@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	sessionStatePending   = "pending"
+	sessionStateRecording = "recording"
+	sessionStateEnded     = "ended"
+)
+
+// claimPending marks a pending session as taken by an offer, false if it is not pending or already claimed
+func (s *recordingSession) claimPending() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.meta.State != sessionStatePending || s.offerClaimed {
+		return false
+	}
+	s.offerClaimed = true
+	return true
+}
+
+// releasePending lets a later offer claim the session again after this one failed
+func (s *recordingSession) releasePending() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.offerClaimed = false
+	s.peerConnection = nil
+	s.meta.State = sessionStatePending
+	return writeSessionMetadata(s.dir, s.meta)
+}
+
+// handleCreateSession registers a session before its offer is sent, so a client can show that it
+// is connecting while it negotiates through POST /sessions/:uuid/offer
+func handleCreateSession(c *fiber.Ctx) error {
+	session := newRecordingSession(uuid.NewString())
+	if err := os.Mkdir(session.dir, 0o755); err != nil {
+		return err
+	}
+	// The lock is held from now on, the offer records under it
+	if _, err := session.lockDir(); err != nil {
+		os.RemoveAll(session.dir)
+		return sendError(c, sessionLockedError(err))
+	}
+	if err := session.update(func(meta *sessionMetadata) { meta.State = sessionStatePending }); err != nil {
+		session.unlockDir()
+		os.RemoveAll(session.dir)
+		return err
+	}
+	sessions.add(session)
+	events.publish("session.created", session.id, fiber.Map{"state": sessionStatePending})
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"id": session.id})
+}
+
+// handleSessionOffer starts recording into a session created by POST /sessions. The offer is sent
+// like to POST / and the answer comes back the same way.
+func handleSessionOffer(cfg Config) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := c.Params("uuid")
+		if !isUUID(id) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid session id"})
+		}
+		session, found := sessions.get(id)
+		if !found {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "session not found"})
+		}
+
+		offer, ok, err := readOffer(c)
+		if !ok {
+			return err
+		}
+		if !session.claimPending() {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "session is not pending"})
+		}
+
+		_, answer, err := NewRecordingSession(c.UserContext(), cfg, session, offer)
+		if err != nil {
+			if releaseErr := session.releasePending(); releaseErr != nil {
+				fmt.Println("Error writing session metadata:", releaseErr)
+			}
+			return sendError(c, sessionLockedError(err))
+		}
+		return respondWithSDP(c, &answer)
+	}
+}
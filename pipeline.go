@@ -0,0 +1,268 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media"
+	"github.com/pion/webrtc/v3/pkg/media/samplebuilder"
+)
+
+// sampleBuilderMaxLate is how many packets a sample may wait for a missing packet before it is dropped
+const sampleBuilderMaxLate = 50
+
+// MediaPipeline consumes the samples of a track once they have been reassembled from RTP packets.
+// codec is the MIME type of the track, e.g. webrtc.MimeTypeVP8.
+type MediaPipeline interface {
+	ProcessSample(sample media.Sample, codec string) error
+	Close() error
+}
+
+// pipelineTaps are the optional ways into and out of a running pipeline besides the track itself
+type pipelineTaps struct {
+	// injector feeds samples that did not come from the peer, they are processed in between the ones of the track
+	injector *sampleInjector
+	// onPacket sees every RTP packet of the track before it is depacketized
+	onPacket func(*rtp.Packet)
+}
+
+// runPipeline reads track until it ends and feeds every complete sample to pipeline, then closes pipeline
+func runPipeline(track *webrtc.TrackRemote, pipeline MediaPipeline, taps pipelineTaps) error {
+	defer func() {
+		if err := pipeline.Close(); err != nil {
+			fmt.Println(err)
+		}
+	}()
+
+	codec := track.Codec()
+	var depacketizer rtp.Depacketizer
+	switch {
+	case strings.EqualFold(codec.MimeType, webrtc.MimeTypeVP8):
+		depacketizer = &codecs.VP8Packet{}
+	case strings.EqualFold(codec.MimeType, webrtc.MimeTypeOpus):
+		depacketizer = &codecs.OpusPacket{}
+	default:
+		return fmt.Errorf("no depacketizer for %s", codec.MimeType)
+	}
+	builder := samplebuilder.New(sampleBuilderMaxLate, depacketizer, codec.ClockRate)
+
+	var injected <-chan media.Sample
+	if taps.injector != nil {
+		injected = taps.injector.samples
+		defer close(taps.injector.done)
+	}
+
+	// The track is read in its own goroutine and fanned out to the sample builder and the packet
+	// tap, a single goroutine writes to the pipeline
+	fanOut := NewPacketFanOut()
+	builderPackets := fanOut.Subscribe()
+	if taps.onPacket != nil {
+		tapPackets := fanOut.Subscribe()
+		go func() {
+			for packet := range tapPackets {
+				taps.onPacket(packet)
+			}
+		}()
+	}
+	readErr := make(chan error, 1)
+	go func() {
+		defer fanOut.Close()
+		var packets packetCounter
+		defer func() {
+			fmt.Printf("Track %s: received %d of %d packets, %d lost\n", track.ID(), packets.received, packets.Expected(), packets.Lost())
+		}()
+		for {
+			packet, _, err := track.ReadRTP()
+			if err != nil {
+				readErr <- err
+				return
+			}
+			packets.Observe(packet.SequenceNumber)
+			fanOut.Publish(packet)
+		}
+	}()
+
+	received := make(chan media.Sample)
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		defer close(received)
+		for packet := range builderPackets {
+			builder.Push(packet)
+			for sample := builder.Pop(); sample != nil; sample = builder.Pop() {
+				select {
+				case received <- *sample:
+				case <-stop:
+					// The other subscribers still get the packets until the track ends
+					for range builderPackets {
+					}
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		var sample media.Sample
+		select {
+		case s, ok := <-received:
+			if !ok {
+				return <-readErr
+			}
+			sample = s
+		case sample = <-injected:
+		}
+		if err := pipeline.ProcessSample(sample, codec.MimeType); err != nil {
+			return err
+		}
+	}
+}
+
+var errPipelineStopped = errors.New("pipeline stopped")
+
+// sampleInjector hands samples that did not come from the peer to a running pipeline
+type sampleInjector struct {
+	samples chan media.Sample
+	done    chan struct{}
+}
+
+func newSampleInjector() *sampleInjector {
+	return &sampleInjector{samples: make(chan media.Sample), done: make(chan struct{})}
+}
+
+// inject blocks until the pipeline took every sample, or fails with errPipelineStopped once the track ended
+func (i *sampleInjector) inject(samples []media.Sample) error {
+	for _, sample := range samples {
+		select {
+		case i.samples <- sample:
+		case <-i.done:
+			return errPipelineStopped
+		}
+	}
+	return nil
+}
+
+// vp8StartOfPartition is a one byte VP8 payload descriptor with only the S bit set
+const vp8StartOfPartition = 0x10
+
+// DiskWriter stores samples with one of pion's media writers, an ivfwriter for VP8 or an oggwriter for Opus
+type DiskWriter struct {
+	writer media.Writer
+}
+
+func NewDiskWriter(writer media.Writer) *DiskWriter {
+	return &DiskWriter{writer: writer}
+}
+
+// ProcessSample hands the sample to the writer as a single RTP packet, which is how the
+// writers expect a complete frame. RTP timestamps are kept so the Ogg granule positions
+// follow the original timing.
+func (d *DiskWriter) ProcessSample(sample media.Sample, codec string) error {
+	packet := &rtp.Packet{Header: rtp.Header{Timestamp: sample.PacketTimestamp, Marker: true}}
+	switch {
+	case strings.EqualFold(codec, webrtc.MimeTypeVP8):
+		packet.Payload = append([]byte{vp8StartOfPartition}, sample.Data...)
+	case strings.EqualFold(codec, webrtc.MimeTypeOpus):
+		packet.Payload = sample.Data
+	default:
+		return fmt.Errorf("cannot write %s samples to disk", codec)
+	}
+	return d.writer.WriteRTP(packet)
+}
+
+func (d *DiskWriter) Close() error {
+	return d.writer.Close()
+}
+
+// NullWriter discards every sample, it stands in for DiskWriter in dry runs
+type NullWriter struct{}
+
+func (NullWriter) ProcessSample(media.Sample, string) error { return nil }
+
+func (NullWriter) Close() error { return nil }
+
+// MultiWriter passes every sample to each of its pipelines in order
+type MultiWriter []MediaPipeline
+
+func NewMultiWriter(pipelines ...MediaPipeline) MultiWriter {
+	return MultiWriter(pipelines)
+}
+
+// ProcessSample stops at the first pipeline that fails, later pipelines do not see the sample
+func (m MultiWriter) ProcessSample(sample media.Sample, codec string) error {
+	for _, p := range m {
+		if err := p.ProcessSample(sample, codec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// trackPipeline is the pipeline of the one track a session records into it. runPipeline of that
+// track closes it, so a sample is never written while the file is being closed. The session
+// teardown stops it: it closes a pipeline that no track took and otherwise waits for runPipeline.
+type trackPipeline struct {
+	MediaPipeline
+
+	mu               sync.Mutex
+	started, stopped bool
+	closeOnce        sync.Once
+	closeErr         error
+	done             chan struct{}
+}
+
+func newTrackPipeline(pipeline MediaPipeline) *trackPipeline {
+	return &trackPipeline{MediaPipeline: pipeline, done: make(chan struct{})}
+}
+
+// start hands the pipeline to a track, it returns false once the session stopped it
+func (t *trackPipeline) start() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.started || t.stopped {
+		return false
+	}
+	t.started = true
+	return true
+}
+
+// Close is called by runPipeline when the track ended, or by stop if none started
+func (t *trackPipeline) Close() error {
+	t.closeOnce.Do(func() {
+		t.closeErr = t.MediaPipeline.Close()
+		close(t.done)
+	})
+	return t.closeErr
+}
+
+// stop is called at the end of the session once the peer connection is closed, which ends the
+// track, and returns when the pipeline is closed
+func (t *trackPipeline) stop() error {
+	t.mu.Lock()
+	started := t.started
+	t.stopped = true
+	t.mu.Unlock()
+
+	if !started {
+		return t.Close()
+	}
+	<-t.done
+	return t.closeErr
+}
+
+// Close closes every pipeline, even when one of them fails
+func (m MultiWriter) Close() error {
+	var errs []error
+	for _, p := range m {
+		if err := p.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
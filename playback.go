@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/pion/webrtc/v3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// playbackSession is one client of /video, which plays a recording back to it
+type playbackSession struct {
+	// id is sent as X-Session-Id with the answer and lets POST /sessions/:uuid/dtmf find the audio track
+	id             string
+	peerConnection PeerConnectionInterface
+	// audioTrack is nil when there is no audio to play
+	audioTrack *opusDTMFTrack
+}
+
+// NewPlaybackSession answers offer with a peer connection from newConnection that plays the files at
+// videoPath and audioPath, either of which may be missing, once ICE connects. The connection closes
+// itself when ICE fails or closes, errors close it straight away.
+func NewPlaybackSession(ctx context.Context, cfg Config, newConnection func() (PeerConnectionInterface, error), videoPath, audioPath string, labels trackLabels, offer webrtc.SessionDescription) (*playbackSession, webrtc.SessionDescription, error) {
+	_, createSpan := tracer.Start(ctx, "peerconnection.create")
+	peerConnection, err := newConnection()
+	endSpan(createSpan, err)
+	if err != nil {
+		return nil, webrtc.SessionDescription{}, err
+	}
+
+	iceConnectedCtx, iceConnectedCtxCancel := context.WithCancel(context.Background())
+	_, playbackSpan := tracer.Start(ctx, "playback.session")
+	session := &playbackSession{id: uuid.NewString(), peerConnection: peerConnection}
+
+	// The connection has to outlive the request to stream the files,
+	// it is only closed here if we fail before answering
+	fail := func(err error) (*playbackSession, webrtc.SessionDescription, error) {
+		playbackSpan.End()
+		iceConnectedCtxCancel()
+		playbacks.remove(session.id)
+		if cErr := peerConnection.Close(); cErr != nil {
+			fmt.Printf("cannot close peerConnection: %v\n", cErr)
+		}
+		return nil, webrtc.SessionDescription{}, err
+	}
+
+	if session.audioTrack, err = setupMediaTracks(cfg, peerConnection, videoPath, audioPath, labels, iceConnectedCtx); err != nil {
+		return fail(err)
+	}
+	if session.audioTrack != nil {
+		playbacks.add(session.id, session.audioTrack)
+	}
+
+	peerConnection.OnICEConnectionStateChange(func(connectionState webrtc.ICEConnectionState) {
+		fmt.Printf("Connection State has changed %s \n", connectionState.String())
+		playbackSpan.SetAttributes(attribute.String("ice.state", connectionState.String()))
+		playbackSpan.AddEvent("ice.state", trace.WithAttributes(attribute.String("ice.state", connectionState.String())))
+		switch connectionState {
+		case webrtc.ICEConnectionStateConnected:
+			iceConnectedCtxCancel()
+		case webrtc.ICEConnectionStateFailed, webrtc.ICEConnectionStateClosed:
+			playbackSpan.End()
+			iceConnectedCtxCancel()
+			playbacks.remove(session.id)
+			if cErr := peerConnection.Close(); cErr != nil {
+				fmt.Printf("cannot close peerConnection: %v\n", cErr)
+			}
+		}
+	})
+
+	if err := peerConnection.SetRemoteDescription(offer); err != nil {
+		return fail(err)
+	}
+	answer, err := peerConnection.CreateAnswer(nil)
+	if err != nil {
+		return fail(err)
+	}
+	gatherComplete := gatheringComplete(peerConnection)
+	if err := peerConnection.SetLocalDescription(answer); err != nil {
+		return fail(err)
+	}
+
+	_, gatherSpan := tracer.Start(ctx, "ice.gather")
+	<-gatherComplete
+	gatherSpan.End()
+	if desc := localDescription(cfg, peerConnection); desc != nil {
+		answer = *desc
+	}
+	return session, answer, nil
+}
+
+// NewRecordingSession answers offer with a peer connection that records into a new session, or
+// into resumed when it continues an unfinished one, see startRecording
+func NewRecordingSession(ctx context.Context, cfg Config, resumed *recordingSession, offer webrtc.SessionDescription) (*recordingSession, webrtc.SessionDescription, error) {
+	session, _, err := startRecording(ctx, cfg, resumed, offer, nil)
+	if err != nil {
+		return nil, webrtc.SessionDescription{}, err
+	}
+	answer := webrtc.SessionDescription{}
+	if desc := session.localDescription(cfg); desc != nil {
+		answer = *desc
+	}
+	return session, answer, nil
+}
+
+// handleVideo plays output.ivf and output.opus back to the client that posted the offer. The peer
+// connection comes from newConnection so a TestConnection can stand in for it.
+func handleVideo(cfg Config, newConnection func() (PeerConnectionInterface, error)) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		// A protobuf body only holds the offer, the tracks keep their default labels
+		var (
+			body map[string]interface{}
+			base string
+		)
+		protobufBody := isProtobuf(c)
+		if !protobufBody {
+			if err := c.BodyParser(&body); err != nil {
+				return err
+			}
+			var okBase bool
+			if base, okBase = body["base"].(string); !okBase {
+				return c.SendString("Parameter 'base' not found or not a string")
+			}
+		}
+		labels, err := parseTrackLabels(body)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+		}
+
+		offer := webrtc.SessionDescription{}
+		_, decodeSpan := tracer.Start(c.UserContext(), "sdp.decode")
+		field := "base"
+		if protobufBody {
+			field = "body"
+			err = decodeProtobuf(c.Body(), &offer)
+		} else {
+			err = decode(base, &offer)
+		}
+		endSpan(decodeSpan, err)
+		if err != nil {
+			return sendDecodeError(c, field, err)
+		}
+
+		session, answer, err := NewPlaybackSession(c.UserContext(), cfg, newConnection, videoFileName, audioFileName, labels, offer)
+		if err != nil {
+			return err
+		}
+		c.Set("X-Session-Id", session.id)
+		return respondWithSDP(c, &answer)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"embed"
+	"html/template"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// The player decodes the IVF stream in the browser with WebCodecs and plays the
+// Ogg/Opus file through an <audio> element, using the audio clock to keep both in sync.
+//
+//go:embed player.html
+var playerFS embed.FS
+
+// playerTemplate is player.html, which takes a playerPage. html/template quotes the values for the
+// script they are used in.
+var playerTemplate = template.Must(template.ParseFS(playerFS, "player.html"))
+
+// playerPage are the values player.html is rendered with
+type playerPage struct {
+	UUID          string
+	VideoEndpoint string
+	AudioEndpoint string
+}
+
+func handlePlayer(c *fiber.Ctx) error {
+	id := c.Params("uuid")
+	if !isUUID(id) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid session id"})
+	}
+	if !fileExists(recordingPath(id, "")) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "recording not found"})
+	}
+
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+	return playerTemplate.Execute(c.Response().BodyWriter(), playerPage{
+		UUID:          id,
+		VideoEndpoint: "/files/" + id + "/video",
+		AudioEndpoint: "/files/" + id + "/audio",
+	})
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pion/webrtc/v3/pkg/media/ivfreader"
+	"github.com/pion/webrtc/v3/pkg/media/oggreader"
+)
+
+type videoProbe struct {
+	Codec  string `json:"codec"`
+	Width  uint16 `json:"width"`
+	Height uint16 `json:"height"`
+}
+
+type audioProbe struct {
+	Codec      string `json:"codec"`
+	SampleRate uint32 `json:"sampleRate"`
+	Channels   uint8  `json:"channels"`
+}
+
+// probeIVF reads the stream info from the 32 byte header of the IVF file at path
+func probeIVF(path string) (*videoProbe, error) {
+	if err := validateIVFFile(path); err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	ivf, header, err := ivfreader.NewWith(file)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errCorruptRecording, err)
+	}
+	width, height := ivfVideoSize(ivf, header)
+	return &videoProbe{Codec: ivfCodecName(header.FourCC), Width: width, Height: height}, nil
+}
+
+// ivfVideoSize returns the size of the video in an IVF stream read up to its first frame. pion's
+// ivfwriter always writes 640x480 into the header, so VP8 is measured from its first keyframe and
+// only other codecs, or VP8 without a keyframe, take the size of the header.
+func ivfVideoSize(ivf *ivfreader.IVFReader, header *ivfreader.IVFFileHeader) (width, height uint16) {
+	if header.FourCC == fourCCVP8 {
+		for {
+			frame, _, err := ivf.ParseNextFrame()
+			if err != nil {
+				break
+			}
+			if width, height, ok := vp8FrameSize(frame); ok {
+				return width, height
+			}
+		}
+	}
+	return header.Width, header.Height
+}
+
+// probeOGG reads the stream info from the OpusHead page at the start of the Ogg file at path
+func probeOGG(path string) (*audioProbe, error) {
+	if err := validateOGGFile(path); err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	_, header, err := oggreader.NewWith(file)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errCorruptRecording, err)
+	}
+	return &audioProbe{Codec: "opus", SampleRate: header.SampleRate, Channels: header.Channels}, nil
+}
+
+// handleProbe describes the streams of a recording from the file headers alone.
+// A stream whose file does not exist is left out of the response.
+func handleProbe(c *fiber.Ctx) error {
+	id := c.Params("uuid")
+	if !isUUID(id) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid session id"})
+	}
+
+	var (
+		result struct {
+			Video *videoProbe `json:"video,omitempty"`
+			Audio *audioProbe `json:"audio,omitempty"`
+		}
+		err error
+	)
+	if path := recordingPath(id, videoFileName); fileExists(path) {
+		if result.Video, err = probeIVF(path); err != nil {
+			return probeError(c, path, err)
+		}
+	}
+	if path := recordingPath(id, audioFileName); fileExists(path) {
+		if result.Audio, err = probeOGG(path); err != nil {
+			return probeError(c, path, err)
+		}
+	}
+	if result.Video == nil && result.Audio == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "recording not found"})
+	}
+	return c.JSON(result)
+}
+
+func probeError(c *fiber.Ctx, path string, err error) error {
+	if !errors.Is(err, errCorruptRecording) {
+		return err
+	}
+	fmt.Printf("Cannot probe %s: %v\n", path, err)
+	return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": errCorruptRecording.Error()})
+}
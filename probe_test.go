@@ -0,0 +1,54 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3/pkg/media/ivfwriter"
+)
+
+func TestProbeIVFSize(t *testing.T) {
+	dir := t.TempDir()
+
+	// ivfwriter puts 640x480 in the header, the keyframe is 1280x720
+	vp8 := filepath.Join(dir, "vp8.ivf")
+	w, err := ivfwriter.New(vp8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyframe := []byte{0x10, 0x02, 0x00, 0x9d, 0x01, 0x2a, 0x00, 0x05, 0xd0, 0x02}
+	if err := w.WriteRTP(&rtp.Packet{Header: rtp.Header{Marker: true}, Payload: append([]byte{0x10}, keyframe...)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	vp9 := filepath.Join(dir, "vp9.ivf")
+	writeTestIVF(t, vp9, fourCCVP9)
+
+	tests := []struct {
+		path, codec   string
+		width, height uint16
+	}{
+		{vp8, "VP8", 1280, 720},
+		{vp9, "VP9", 640, 480},
+	}
+	for _, tt := range tests {
+		probe, err := probeIVF(tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if probe.Codec != tt.codec || probe.Width != tt.width || probe.Height != tt.height {
+			t.Errorf("probe of %s %+v, want %s %dx%d", filepath.Base(tt.path), *probe, tt.codec, tt.width, tt.height)
+		}
+		info, err := extractIVFInfo(tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Width != tt.width || info.Height != tt.height {
+			t.Errorf("video info of %s is %dx%d, want %dx%d", filepath.Base(tt.path), info.Width, info.Height, tt.width, tt.height)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pion/webrtc/v3"
+)
+
+// recordingQuality selects the codec parameters a recording peer connection answers with
+type recordingQuality string
+
+const (
+	qualityLow    recordingQuality = "low"
+	qualityMedium recordingQuality = "medium"
+	qualityHigh   recordingQuality = "high"
+)
+
+// qualityPreset holds the fmtp parameters the answer sets for a quality. Opus senders keep to the
+// maxaveragebitrate of the answer. The VP8 clock rate is fixed at 90 kHz by RFC 7741, the frame
+// rate and the frame size in macroblocks, max-fr and max-fs, are what limits VP8 instead.
+type qualityPreset struct {
+	opusFmtp string
+	vp8Fmtp  string
+}
+
+// fmtpFor returns the parameters of preset for the codec of an a=rtpmap encoding such as opus/48000/2
+func (p qualityPreset) fmtpFor(encoding string) string {
+	name, _, _ := strings.Cut(encoding, "/")
+	switch strings.ToLower(name) {
+	case "opus":
+		return p.opusFmtp
+	case "vp8":
+		return p.vp8Fmtp
+	}
+	return ""
+}
+
+var qualityPresets = map[recordingQuality]qualityPreset{
+	qualityLow:    {opusFmtp: "maxaveragebitrate=16000", vp8Fmtp: "max-fr=15;max-fs=1200"},
+	qualityMedium: {opusFmtp: "maxaveragebitrate=32000", vp8Fmtp: "max-fr=30;max-fs=3600"},
+	qualityHigh:   {opusFmtp: "maxaveragebitrate=96000"},
+}
+
+// parseRecordingQuality checks that s names a preset, an empty s lets the client's encoders decide
+func parseRecordingQuality(s string) (recordingQuality, error) {
+	q := recordingQuality(s)
+	if _, ok := qualityPresets[q]; !ok && q != "" {
+		return "", fmt.Errorf("quality must be low, medium or high, got %q", s)
+	}
+	return q, nil
+}
+
+// mergeFmtp sets the parameters of extra in the fmtp parameters params, replacing those of the same name
+func mergeFmtp(params, extra string) string {
+	var merged []string
+	names := map[string]bool{}
+	for _, param := range strings.Split(extra, ";") {
+		name, _, _ := strings.Cut(param, "=")
+		names[name] = true
+	}
+	for _, param := range strings.Split(params, ";") {
+		if name, _, _ := strings.Cut(param, "="); param != "" && !names[name] {
+			merged = append(merged, param)
+		}
+	}
+	return strings.Join(append(merged, extra), ";")
+}
+
+// applyQualityPreset sets the fmtp parameters of preset in an SDP. pion answers with the parameters
+// of the offer and rejects a local description changed after CreateAnswer, so the parameters are
+// only set in the copy the client gets.
+func applyQualityPreset(sdp string, preset qualityPreset) string {
+	lines := strings.SplitAfter(sdp, "\n")
+	// extra holds the parameters per payload type, done the payload types that got them
+	extra := map[string]string{}
+	done := map[string]bool{}
+	for _, line := range lines {
+		if rtpmap, ok := strings.CutPrefix(strings.TrimSpace(line), "a=rtpmap:"); ok {
+			if pt, encoding, ok := strings.Cut(rtpmap, " "); ok && preset.fmtpFor(encoding) != "" {
+				extra[pt] = preset.fmtpFor(encoding)
+			}
+		}
+	}
+	if len(extra) == 0 {
+		return sdp
+	}
+
+	out := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if fmtp, ok := strings.CutPrefix(strings.TrimSpace(line), "a=fmtp:"); ok {
+			pt, params, _ := strings.Cut(fmtp, " ")
+			if e, ok := extra[pt]; ok {
+				line = "a=fmtp:" + pt + " " + mergeFmtp(params, e) + "\r\n"
+				done[pt] = true
+			}
+		}
+		out = append(out, line)
+	}
+	for i := 0; i < len(out); i++ {
+		rtpmap, ok := strings.CutPrefix(strings.TrimSpace(out[i]), "a=rtpmap:")
+		if !ok {
+			continue
+		}
+		if pt, _, _ := strings.Cut(rtpmap, " "); extra[pt] != "" && !done[pt] {
+			out = append(out[:i+1], append([]string{"a=fmtp:" + pt + " " + extra[pt] + "\r\n"}, out[i+1:]...)...)
+			done[pt] = true
+		}
+	}
+	return strings.Join(out, "")
+}
+
+// localDescription returns the local description of the session for the client, with the
+// candidates ICE_CANDIDATE_TYPES allows and the codec parameters of its quality preset. Below
+// 48 kHz AUDIO_SAMPLE_RATE becomes the Opus maxplaybackrate, which RFC 7587 has senders encode for,
+// and MAX_VIDEO_FPS the VP8 max-fr.
+func (s *recordingSession) localDescription(cfg Config) *webrtc.SessionDescription {
+	desc := localDescription(cfg, s.peerConnection)
+	s.mu.Lock()
+	preset := qualityPresets[s.meta.Quality]
+	s.mu.Unlock()
+	if cfg.AudioSampleRate != 0 && cfg.AudioSampleRate < opusClockRate {
+		preset.opusFmtp = mergeFmtp(preset.opusFmtp, fmt.Sprintf("maxplaybackrate=%d", cfg.AudioSampleRate))
+	}
+	if cfg.MaxVideoFPS > 0 {
+		preset.vp8Fmtp = capFrameRate(preset.vp8Fmtp, cfg.MaxVideoFPS)
+	}
+	if desc == nil || preset == (qualityPreset{}) {
+		return desc
+	}
+	withPreset := *desc
+	withPreset.SDP = applyQualityPreset(desc.SDP, preset)
+	return &withPreset
+}
+
+// requestQuality returns the quality field of a POST / body, or RECORDING_QUALITY when it is left
+// out. Protobuf offers have no such field.
+func requestQuality(c *fiber.Ctx, cfg Config) (recordingQuality, error) {
+	if isProtobuf(c) {
+		return cfg.RecordingQuality, nil
+	}
+	var body struct {
+		Quality string `json:"quality"`
+	}
+	if err := c.BodyParser(&body); err != nil || body.Quality == "" {
+		return cfg.RecordingQuality, nil
+	}
+	return parseRecordingQuality(body.Quality)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+)
+
+const (
+	// readinessTimeout bounds one loopback connection of the readiness probe
+	readinessTimeout = 30 * time.Second
+	// readinessRetryInterval is the wait before a failed readiness probe is run again
+	readinessRetryInterval = 10 * time.Second
+)
+
+// ready is set once readinessProbe succeeded or the first recording session connected over ICE
+var ready atomic.Bool
+
+// readinessProbe connects two in-process peer connections over loopback, sends one RTP packet
+// from one to the other and marks the server as ready once it arrives
+func readinessProbe() error {
+	m := &webrtc.MediaEngine{}
+	if err := m.RegisterDefaultCodecs(); err != nil {
+		return err
+	}
+	settings := webrtc.SettingEngine{}
+	settings.SetIncludeLoopbackCandidate(true)
+	api := webrtc.NewAPI(webrtc.WithMediaEngine(m), webrtc.WithSettingEngine(settings))
+
+	sender, err := api.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		return err
+	}
+	defer sender.Close()
+	receiver, err := api.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		return err
+	}
+	defer receiver.Close()
+
+	track, err := webrtc.NewTrackLocalStaticRTP(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8}, "probe", "probe")
+	if err != nil {
+		return err
+	}
+	if _, err := sender.AddTrack(track); err != nil {
+		return err
+	}
+
+	received := make(chan struct{})
+	receiver.OnTrack(func(remote *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		if _, _, err := remote.ReadRTP(); err == nil {
+			close(received)
+		}
+	})
+
+	if err := connectPeers(sender, receiver); err != nil {
+		return err
+	}
+
+	// The track only carries packets once the connection is up, until then writes are dropped
+	timeout := time.After(readinessTimeout)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	packet := &rtp.Packet{Header: rtp.Header{Version: 2, PayloadType: 96, Marker: true}, Payload: vp8BlackKeyFrame}
+	for {
+		select {
+		case <-received:
+			ready.Store(true)
+			return nil
+		case <-timeout:
+			return errors.New("no RTP packet arrived over the loopback connection")
+		case <-ticker.C:
+			packet.SequenceNumber++
+			if err := track.WriteRTP(packet); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// connectPeers negotiates a connection between two in-process peer connections. Both sides gather
+// completely, so one offer and one answer is all the signaling needed.
+func connectPeers(offerer, answerer *webrtc.PeerConnection) error {
+	offer, err := offerer.CreateOffer(nil)
+	if err != nil {
+		return err
+	}
+	offererGathered := webrtc.GatheringCompletePromise(offerer)
+	if err := offerer.SetLocalDescription(offer); err != nil {
+		return err
+	}
+	<-offererGathered
+	if err := answerer.SetRemoteDescription(*offerer.LocalDescription()); err != nil {
+		return err
+	}
+	answer, err := answerer.CreateAnswer(nil)
+	if err != nil {
+		return err
+	}
+	answererGathered := webrtc.GatheringCompletePromise(answerer)
+	if err := answerer.SetLocalDescription(answer); err != nil {
+		return err
+	}
+	<-answererGathered
+	return offerer.SetRemoteDescription(*answerer.LocalDescription())
+}
+
+// runReadinessProbe retries readinessProbe until it succeeds or a recording session made the server ready
+func runReadinessProbe() {
+	for !ready.Load() {
+		err := readinessProbe()
+		if err == nil {
+			fmt.Println("Readiness probe succeeded, WebRTC is working")
+			return
+		}
+		fmt.Printf("Readiness probe failed, retrying in %s: %v\n", readinessRetryInterval, err)
+		time.Sleep(readinessRetryInterval)
+	}
+}
+
+// handleReady responds with 503 until the first ICE session was established, that of a client
+// recording or, so a server without clients yet gets ready too, that of the loopback readiness probe
+func handleReady(c *fiber.Ctx) error {
+	if !ready.Load() {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"ready": false})
+	}
+	return c.JSON(fiber.Map{"ready": true})
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestHandleReady(t *testing.T) {
+	was := ready.Load()
+	t.Cleanup(func() { ready.Store(was) })
+
+	app := fiber.New()
+	app.Get("/ready", handleReady)
+	for _, tt := range []struct {
+		ready bool
+		want  int
+	}{{false, fiber.StatusServiceUnavailable}, {true, fiber.StatusOK}} {
+		ready.Store(tt.ready)
+		resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/ready", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tt.want {
+			t.Errorf("ready %v: status %d, want %d", tt.ready, resp.StatusCode, tt.want)
+		}
+	}
+}
+
+func TestReadinessProbe(t *testing.T) {
+	was := ready.Load()
+	t.Cleanup(func() { ready.Store(was) })
+
+	ready.Store(false)
+	if err := readinessProbe(); err != nil {
+		t.Fatal(err)
+	}
+	if !ready.Load() {
+		t.Error("the server is not ready after the loopback probe succeeded")
+	}
+}
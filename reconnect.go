@@ -0,0 +1,61 @@
+package main
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+// requestReconnect returns the session id a POST / body asks to resume recording into, empty for a new session
+func requestReconnect(c *fiber.Ctx) string {
+	if isProtobuf(c) {
+		return ""
+	}
+	var body struct {
+		Reconnect string `json:"reconnect"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return ""
+	}
+	return body.Reconnect
+}
+
+// claimReconnect takes the session id for an offer that resumes its recording. Only a session that
+// session.json still has as recording and that is not being recorded can be resumed, typically one
+// left behind by a server that stopped while the client was connected. Uploaded, merged and trimmed
+// recordings have no state and are never resumed.
+func claimReconnect(cfg Config, id string) (*recordingSession, error) {
+	if !isUUID(id) {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "invalid session id")
+	}
+	if cfg.VideoSegmentDuration > 0 || cfg.AudioSegmentDuration > 0 {
+		return nil, fiber.NewError(fiber.StatusConflict, "segmented recordings cannot be resumed")
+	}
+	session, ok := sessions.get(id)
+	if !ok {
+		return nil, fiber.NewError(fiber.StatusNotFound, "session not found")
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	switch {
+	case session.meta.State == sessionStatePending:
+		return nil, fiber.NewError(fiber.StatusConflict, "session is pending, its offer goes to /sessions/"+id+"/offer")
+	case session.meta.State != sessionStateRecording || session.meta.EndedAt != nil:
+		return nil, fiber.NewError(fiber.StatusConflict, "session is not a recording that can be resumed")
+	case session.peerConnection != nil || session.offerClaimed:
+		return nil, fiber.NewError(fiber.StatusConflict, "session is live")
+	}
+	session.offerClaimed = true
+	session.resume = true
+	return session, nil
+}
+
+// releaseReconnect lets a later offer resume the session again after this one failed
+func (s *recordingSession) releaseReconnect() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.offerClaimed = false
+	s.resume = false
+	s.peerConnection = nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestClaimReconnect(t *testing.T) {
+	ended := time.Now().UTC()
+	tests := []struct {
+		name string
+		meta sessionMetadata
+		want int
+	}{
+		{"left recording", sessionMetadata{State: sessionStateRecording}, fiber.StatusOK},
+		{"ended", sessionMetadata{State: sessionStateEnded, EndedAt: &ended}, fiber.StatusConflict},
+		{"pending", sessionMetadata{State: sessionStatePending}, fiber.StatusConflict},
+		{"uploaded", sessionMetadata{}, fiber.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := newTestSessionDir(t)
+			session := newRecordingSession(id)
+			session.meta = tt.meta
+			sessions.add(session)
+			t.Cleanup(func() { sessions.remove(id) })
+
+			claimed, err := claimReconnect(Config{}, id)
+			if tt.want == fiber.StatusOK {
+				if err != nil || claimed != session {
+					t.Fatalf("claimReconnect: %v", err)
+				}
+				if _, err := claimReconnect(Config{}, id); err == nil {
+					t.Error("a claimed session was claimed again")
+				}
+				return
+			}
+			var fiberErr *fiber.Error
+			if !errors.As(err, &fiberErr) || fiberErr.Code != tt.want {
+				t.Errorf("claimReconnect: %v, want status %d", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// recoverOrphanedFiles moves output.ivf and output.opus left in workDir by a session that never
+// finished, e.g. because the server crashed, to storageDir/recovered-<timestamp>/ so the next
+// session does not overwrite them
+func recoverOrphanedFiles(workDir, storageDir string) error {
+	var orphans []os.FileInfo
+	for _, name := range []string{videoFileName, audioFileName} {
+		info, err := os.Stat(filepath.Join(workDir, name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		orphans = append(orphans, info)
+	}
+	if len(orphans) == 0 {
+		return nil
+	}
+
+	dst := filepath.Join(storageDir, "recovered-"+time.Now().UTC().Format("20060102T150405Z"))
+	if err := os.MkdirAll(dst, 0o755); err != nil {
+		return err
+	}
+	for _, info := range orphans {
+		if err := os.Rename(filepath.Join(workDir, info.Name()), filepath.Join(dst, info.Name())); err != nil {
+			return err
+		}
+		fmt.Printf("Warning: recovered orphaned %s (%d bytes) to %s\n", info.Name(), info.Size(), dst)
+	}
+	return nil
+}
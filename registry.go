@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// sessionRegistry holds every session known to the server, live recordings as well as
+// recordings found in the storage directory
+type sessionRegistry struct {
+	mu       sync.RWMutex
+	sessions map[string]*recordingSession
+}
+
+var sessions = &sessionRegistry{sessions: map[string]*recordingSession{}}
+
+func (r *sessionRegistry) add(s *recordingSession) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.sessions[s.id] = s
+}
+
+func (r *sessionRegistry) remove(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.sessions, id)
+}
+
+func (r *sessionRegistry) get(id string) (*recordingSession, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	s, ok := r.sessions[id]
+	return s, ok
+}
+
+// ids returns the ids of all registered sessions in sorted order
+func (r *sessionRegistry) ids() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ids := make([]string, 0, len(r.sessions))
+	for id := range r.sessions {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// addFromDisk registers the recording stored in the session directory id, unless the session is already known
+func (r *sessionRegistry) addFromDisk(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.sessions[id]; ok {
+		return nil
+	}
+	s, err := loadRecordingSession(id)
+	if err != nil {
+		return err
+	}
+	r.sessions[id] = s
+	return nil
+}
+
+// loadRecordingSession restores a session from its directory, a missing session.json leaves the metadata empty
+func loadRecordingSession(id string) (*recordingSession, error) {
+	s := newRecordingSession(id)
+	s.meta = sessionMetadata{ID: id}
+
+	b, err := os.ReadFile(filepath.Join(s.dir, sessionFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &s.meta); err != nil {
+		return nil, fmt.Errorf("cannot parse %s of session %s: %w", sessionFileName, id, err)
+	}
+	return s, nil
+}
+
+// loadSessions registers every session directory found in dir
+func loadSessions(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || !isUUID(entry.Name()) {
+			continue
+		}
+		if err := sessions.addFromDisk(entry.Name()); err != nil {
+			fmt.Printf("Skipping session %s: %v\n", entry.Name(), err)
+		}
+	}
+	return nil
+}
+
+// watchSessions keeps the registry in sync with session directories created or deleted in dir
+// by something other than this server, e.g. an operator cleaning up old recordings
+func watchSessions(dir string) (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := watcher.Add(dir); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				id := filepath.Base(event.Name)
+				if !isUUID(id) {
+					continue
+				}
+
+				switch {
+				case event.Has(fsnotify.Create):
+					if info, err := os.Stat(event.Name); err != nil || !info.IsDir() {
+						continue
+					}
+					if err := sessions.addFromDisk(id); err != nil {
+						fmt.Printf("Cannot register session %s: %v\n", id, err)
+					}
+				case event.Has(fsnotify.Remove), event.Has(fsnotify.Rename):
+					fmt.Printf("Session directory %s was removed, dropping it from the registry\n", id)
+					sessions.remove(id)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				fmt.Printf("Session directory watcher error: %v\n", err)
+			}
+		}
+	}()
+	return watcher, nil
+}
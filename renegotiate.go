@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media"
+)
+
+// extraTrackFileName names the file of the n-th track of a kind, n > 0, the first track of each kind
+// is stored as output.ivf or output.opus
+func extraTrackFileName(kind webrtc.RTPCodecType, n int) string {
+	if kind == webrtc.RTPCodecTypeVideo {
+		return fmt.Sprintf("output_%d.ivf", n)
+	}
+	return fmt.Sprintf("output_audio_%d.opus", n)
+}
+
+// addAudioTrack lists name in audioTracks of session.json once the recording of an audio track
+// started, a resumed session already lists the files it appends to
+func (s *recordingSession) addAudioTrack(name string) {
+	if err := s.update(func(meta *sessionMetadata) {
+		if !slices.Contains(meta.AudioTracks, name) {
+			meta.AudioTracks = append(meta.AudioTracks, name)
+		}
+	}); err != nil {
+		fmt.Println("Error writing session metadata:", err)
+	}
+}
+
+// recordExtraTrack saves a track added after the first one of its kind until the track ends, such
+// as the system audio Chrome sends next to the microphone when sharing the desktop
+func recordExtraTrack(cfg Config, session *recordingSession, track *webrtc.TrackRemote, n int) error {
+	name := extraTrackFileName(track.Kind(), n)
+	fmt.Printf("Session %s: got additional %s track %q, saving to disk as %s\n", session.id, track.Codec().MimeType, track.ID(), name)
+
+	if cfg.DryRun {
+		return runPipeline(track, NullWriter{}, pipelineTaps{})
+	}
+	var (
+		writer media.Writer
+		err    error
+	)
+	if track.Kind() == webrtc.RTPCodecTypeVideo {
+		writer, err = session.createIVF(name)
+	} else {
+		writer, err = session.createOGG(name, cfg.AudioSampleRate, 2)
+	}
+	if err != nil {
+		return err
+	}
+	if track.Kind() == webrtc.RTPCodecTypeAudio {
+		session.addAudioTrack(name)
+	}
+	return runPipeline(track, NewDiskWriter(writer), pipelineTaps{})
+}
+
+// iceUfrag returns the first ICE username fragment of an SDP, session level or in a media section
+func iceUfrag(sdp string) string {
+	for _, line := range strings.Split(sdp, "\n") {
+		if ufrag, ok := strings.CutPrefix(strings.TrimSpace(line), "a=ice-ufrag:"); ok {
+			return ufrag
+		}
+	}
+	return ""
+}
+
+// handleRenegotiate applies a new offer to a live session and responds with the answer, encoded like
+// the answer of POST /. The offer may add tracks, such as a screen share, or change codecs without
+// setting up a new connection.
+//
+// An offer with a new ice-ufrag is an ICE restart requested by the client. Applying the offer
+// is all it takes for the server to restart ICE as well, CreateOffer with ICERestart is only for
+// restarts started by the offering side, which the server is not in this exchange.
+func handleRenegotiate(cfg Config) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := c.Params("uuid")
+		if !isUUID(id) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid session id"})
+		}
+
+		var body struct {
+			Param string `json:"param"`
+		}
+		if err := c.BodyParser(&body); err != nil || body.Param == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "param is required"})
+		}
+		offer := webrtc.SessionDescription{}
+		if err := decode(body.Param, &offer); err != nil {
+			return sendDecodeError(c, "param", err)
+		}
+		if offer.Type != webrtc.SDPTypeOffer {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "param is not an offer", "field": "param"})
+		}
+
+		session, ok := sessions.get(id)
+		if !ok {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "session not found"})
+		}
+		pc := session.peerConnection
+		if pc == nil || pc.ConnectionState() == webrtc.PeerConnectionStateClosed {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "session is not live"})
+		}
+
+		iceRestart := false
+		if current := pc.RemoteDescription(); current != nil {
+			before, after := iceUfrag(current.SDP), iceUfrag(offer.SDP)
+			iceRestart = before != "" && after != "" && before != after
+		}
+
+		if err := pc.SetRemoteDescription(offer); err != nil {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+		}
+		answer, err := pc.CreateAnswer(nil)
+		if err != nil {
+			return err
+		}
+		gatherComplete := webrtc.GatheringCompletePromise(pc)
+		if err := pc.SetLocalDescription(answer); err != nil {
+			return err
+		}
+		// An ICE restart gathers new candidates, which the answer has to carry
+		<-gatherComplete
+
+		if iceRestart {
+			fmt.Printf("Session %s: ICE restarted by renegotiation\n", session.id)
+		} else {
+			fmt.Printf("Session %s: renegotiated\n", session.id)
+		}
+		return respondWithSDP(c, session.localDescription(cfg))
+	}
+}
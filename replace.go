@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pion/webrtc/v3"
+)
+
+// derivedFileNames are the files generated from the video of a recording, removed when the video is
+// replaced so they are generated again
+var derivedFileNames = []string{"thumbnail.png", timelineFileName, "chapters.json"}
+
+// expectedVideoCodec returns the codec a replacement video must have, the one recorded in
+// session.json or else the one of the current file. It is empty when neither tells.
+func expectedVideoCodec(session *recordingSession) string {
+	session.mu.Lock()
+	codec := session.meta.VideoCodec
+	session.mu.Unlock()
+	if codec != "" {
+		return codec
+	}
+	if probe, err := probeIVF(recordingPath(session.id, videoFileName)); err == nil {
+		return probe.Codec
+	}
+	return ""
+}
+
+// handleReplaceVideo replaces output.ivf of a recording with the IVF file uploaded as the video
+// field, keeping the audio and the metadata. The new file must have the codec of the one it replaces.
+// It overwrites a recording, so it takes ADMIN_TOKEN as a bearer token like the /admin endpoints.
+func handleReplaceVideo(c *fiber.Ctx) error {
+	id := c.Params("uuid")
+	if !isUUID(id) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid session id"})
+	}
+	header, err := c.FormFile("video")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "video file is required"})
+	}
+
+	session, ok := sessions.get(id)
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "session not found"})
+	}
+	if session.peerConnection != nil && session.peerConnection.ConnectionState() != webrtc.PeerConnectionStateClosed {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "session is still recording"})
+	}
+
+	// The upload is checked next to the recording before it takes its place
+	tmp := recordingPath(id, videoFileName+".upload")
+	if err := c.SaveFile(header, tmp); err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	probe, err := probeIVF(tmp)
+	if errors.Is(err, errCorruptRecording) {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()})
+	} else if err != nil {
+		return err
+	}
+	if expected := expectedVideoCodec(session); expected != "" && probe.Codec != expected {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": fmt.Sprintf("%v: cannot replace %s video with %s video", errIncompatibleRecordings, expected, probe.Codec)})
+	}
+
+	if err := os.Rename(tmp, recordingPath(id, videoFileName)); err != nil {
+		return err
+	}
+	for _, name := range derivedFileNames {
+		if err := os.Remove(recordingPath(id, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			fmt.Printf("Session %s: cannot remove %s: %v\n", id, name, err)
+		}
+	}
+
+	now := time.Now().UTC()
+	if err := session.update(func(meta *sessionMetadata) {
+		meta.VideoCodec = probe.Codec
+		meta.VideoReplacedAt = &now
+	}); err != nil {
+		return err
+	}
+	// The replacement is the intended recording now, GET /files/:uuid/verify checks against it
+	if fileExists(recordingPath(id, videoFileName+checksumSuffix)) {
+		if err := session.writeChecksum(videoFileName); err != nil {
+			return err
+		}
+	}
+	return c.JSON(fiber.Map{"videoReplacedAt": now})
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pion/webrtc/v3/pkg/media/ivfreader"
+	"github.com/pion/webrtc/v3/pkg/media/oggreader"
+)
+
+// ReprocessingPlugin is a step run over the stored files of a recording.
+// A path is empty when the recording has no file of that kind.
+type ReprocessingPlugin interface {
+	Process(videoPath, audioPath string) error
+}
+
+// reprocessingPlugins are the steps that can be requested by name from POST /sessions/:uuid/reprocess
+var reprocessingPlugins = map[string]ReprocessingPlugin{
+	"frameCount": FrameCountValidator{},
+}
+
+// FrameCountValidator checks that the IVF frame count in the header, when one was written, matches
+// the frames in the file, that the video codec is one we can play back and that the audio is a readable Opus stream.
+type FrameCountValidator struct{}
+
+func (FrameCountValidator) Process(videoPath, audioPath string) error {
+	if videoPath != "" {
+		if err := validateIVFFrames(videoPath); err != nil {
+			return err
+		}
+	}
+	if audioPath != "" {
+		if err := validateOpusPages(audioPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ivfwriterFrameCountPlaceholder is the frame count pion's ivfwriter declares until it is closed
+const ivfwriterFrameCountPlaceholder = 900
+
+func validateIVFFrames(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	ivf, header, err := ivfreader.NewWith(file)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errCorruptRecording, err)
+	}
+	if _, err := FourCCToMimeType(header.FourCC); err != nil {
+		return fmt.Errorf("%w: unexpected video codec %s", errCorruptRecording, header.FourCC)
+	}
+
+	var frames uint32
+	for {
+		if _, _, err := ivf.ParseNextFrame(); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return fmt.Errorf("%w: frame %d: %v", errCorruptRecording, frames, err)
+		}
+		frames++
+	}
+	// ivfwriter only writes the frame count on Close, so a recording that is live or whose server
+	// crashed declares its placeholder, other writers may leave 0. Only a written count can be wrong.
+	if header.NumFrames != 0 && header.NumFrames != ivfwriterFrameCountPlaceholder && frames != header.NumFrames {
+		return fmt.Errorf("%w: IVF header declares %d frames but file contains %d", errCorruptRecording, header.NumFrames, frames)
+	}
+	return nil
+}
+
+func validateOpusPages(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	ogg, header, err := oggreader.NewWith(file)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errCorruptRecording, err)
+	}
+	if header.Channels == 0 {
+		return fmt.Errorf("%w: Opus header declares no channels", errCorruptRecording)
+	}
+
+	var pages int
+	for {
+		if _, _, err := ogg.ParseNextPage(); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("%w: page %d: %v", errCorruptRecording, pages, err)
+		}
+		pages++
+	}
+}
+
+// handleReprocess runs the requested plugin over the stored files of a recording
+func handleReprocess(c *fiber.Ctx) error {
+	id := c.Params("uuid")
+	if !isUUID(id) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid session id"})
+	}
+
+	var body struct {
+		Plugin string `json:"plugin"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid body"})
+		}
+	}
+	if body.Plugin == "" {
+		body.Plugin = "frameCount"
+	}
+	plugin, ok := reprocessingPlugins[body.Plugin]
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "unknown plugin " + body.Plugin})
+	}
+
+	videoPath, audioPath := recordingPath(id, videoFileName), recordingPath(id, audioFileName)
+	if !fileExists(videoPath) {
+		videoPath = ""
+	}
+	if !fileExists(audioPath) {
+		audioPath = ""
+	}
+	if videoPath == "" && audioPath == "" {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "recording not found"})
+	}
+
+	if err := plugin.Process(videoPath, audioPath); err != nil {
+		if !errors.Is(err, errCorruptRecording) {
+			return err
+		}
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"plugin": body.Plugin, "ok": false, "error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"plugin": body.Plugin, "ok": true})
+}
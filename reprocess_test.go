@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pion/webrtc/v3/pkg/media/ivfwriter"
+)
+
+func TestValidateIVFFrames(t *testing.T) {
+	path := filepath.Join(t.TempDir(), videoFileName)
+	w, err := ivfwriter.New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeVP8Frames(t, w, 0, 3)
+
+	// Still being written, the header declares ivfwriter's placeholder count
+	if err := validateIVFFrames(path); err != nil {
+		t.Errorf("live recording: %v", err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateIVFFrames(path); err != nil {
+		t.Errorf("closed recording: %v", err)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		declared uint32
+		corrupt  bool
+	}{
+		{0, false},
+		{5, true},
+	} {
+		binary.LittleEndian.PutUint32(b[24:], tc.declared)
+		if err := os.WriteFile(path, b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := validateIVFFrames(path); errors.Is(err, errCorruptRecording) != tc.corrupt {
+			t.Errorf("header declaring %d of 3 frames: %v, want corrupt %v", tc.declared, err, tc.corrupt)
+		}
+	}
+}
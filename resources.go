@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v3/pkg/media/ivfwriter"
+	"github.com/pion/webrtc/v3/pkg/media/oggwriter"
+)
+
+// fileLeakGrace is how long after teardown the files of a session are checked. Tracks added by
+// renegotiation stop, and close their files, only once the peer connection is closed.
+const fileLeakGrace = 5 * time.Second
+
+// ResourceTracker keeps the files a recording session opens, so the ones still open after the
+// session ended are logged. A writer left open leaks its file descriptor until the process runs out
+// of them, the log points at it long before.
+type ResourceTracker struct {
+	mu    sync.Mutex
+	files []*os.File
+}
+
+// Create is os.Create for a file of the session
+func (t *ResourceTracker) Create(name string) (*os.File, error) {
+	return t.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o666)
+}
+
+// OpenFile is os.OpenFile for a file of the session
+func (t *ResourceTracker) OpenFile(name string, flag int, perm os.FileMode) (*os.File, error) {
+	file, err := os.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Forget the files closed so far, a segmented recording opens a new file every segment
+	t.files = append(stillOpen(t.files), file)
+	return file, nil
+}
+
+// opened returns the files opened so far that are not known to be closed
+func (t *ResourceTracker) opened() []*os.File {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return slices.Clone(t.files)
+}
+
+// stillOpen returns the files of files that were not closed. Stat is how an os.File tells, it fails
+// with os.ErrClosed once the file is closed.
+func stillOpen(files []*os.File) []*os.File {
+	var open []*os.File
+	for _, file := range files {
+		if _, err := file.Stat(); !errors.Is(err, os.ErrClosed) {
+			open = append(open, file)
+		}
+	}
+	return open
+}
+
+// checkFilesClosed logs an error for each file the session opened that is still open fileLeakGrace
+// from now. Only files opened before the call are checked, a session resumed in the meantime opens
+// new ones.
+func (s *recordingSession) checkFilesClosed() {
+	files := s.files.opened()
+	time.AfterFunc(fileLeakGrace, func() {
+		for _, file := range stillOpen(files) {
+			slog.Error("file still open after the session ended", "session", s.id, "file", file.Name())
+		}
+	})
+}
+
+// createIVF starts the IVF recording name of the session
+func (s *recordingSession) createIVF(name string) (*ivfwriter.IVFWriter, error) {
+	file, err := s.files.Create(recordingPath(s.id, name))
+	if err != nil {
+		return nil, err
+	}
+	writer, err := ivfwriter.NewWith(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return writer, nil
+}
+
+// createOGG starts the Ogg Opus recording name of the session
+func (s *recordingSession) createOGG(name string, sampleRate uint32, channels uint16) (*oggwriter.OggWriter, error) {
+	file, err := s.files.Create(recordingPath(s.id, name))
+	if err != nil {
+		return nil, err
+	}
+	writer, err := oggwriter.NewWith(&oggFile{file: file}, sampleRate, channels)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return writer, nil
+}
+
+// appendIVF continues the IVF recording name of the session, see AppendIVF
+func (s *recordingSession) appendIVF(name string) (*ivfwriter.IVFWriter, int, error) {
+	file, err := s.files.OpenFile(recordingPath(s.id, name), os.O_RDWR, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+	return AppendIVF(file)
+}
+
+// appendOGG continues the Ogg Opus recording name of the session, see AppendOGG
+func (s *recordingSession) appendOGG(name string) (*oggwriter.OggWriter, error) {
+	file, err := s.files.OpenFile(recordingPath(s.id, name), os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	return AppendOGG(file)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/webrtc/v3"
+)
+
+const (
+	// rtcpReportTimeout is how long after streaming started the client has to send its first report
+	rtcpReportTimeout = 10 * time.Second
+	// maxSenderReportSkew is how far the NTP time of a sender report may be off the server clock
+	maxSenderReportSkew = 5 * time.Second
+	// ntpEpochOffset is the number of seconds between the NTP epoch, 1900, and the Unix epoch
+	ntpEpochOffset = 2208988800
+)
+
+// ntpTime converts a 64-bit NTP timestamp, seconds since 1900 in 32.32 fixed point
+func ntpTime(ntp uint64) time.Time {
+	seconds := int64(ntp>>32) - ntpEpochOffset
+	nanos := int64((ntp & 0xffffffff) * uint64(time.Second) >> 32)
+	return time.Unix(seconds, nanos)
+}
+
+// RTCPMonitor watches the RTCP a client sends back for a track played to it. A client that
+// receives media reports on it, with receiver reports or, if it sends media too, sender reports.
+// Without any report the media most likely only flows one way.
+type RTCPMonitor struct {
+	track string
+	// onGoodbye is called once the client sent a BYE, i.e. hung up
+	onGoodbye func()
+	// onReception, when set, is given the fraction lost of every reception report
+	onReception func(fractionLost uint8)
+	// onPictureLoss, when set, is called for every PLI or FIR, the client asking for a keyframe
+	onPictureLoss func()
+
+	mu      sync.Mutex
+	reports int
+}
+
+func NewRTCPMonitor(track string, onGoodbye func()) *RTCPMonitor {
+	return &RTCPMonitor{track: track, onGoodbye: onGoodbye}
+}
+
+// Observe checks the packets of one RTCP compound packet that arrived at the given time and
+// tells if one of them was a BYE
+func (m *RTCPMonitor) Observe(packets []rtcp.Packet, arrival time.Time) (goodbye bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, packet := range packets {
+		switch p := packet.(type) {
+		case *rtcp.Goodbye:
+			logGoodbye(m.track, p)
+			goodbye = true
+		case *rtcp.SenderReport:
+			m.reports++
+			// The NTP time is the wall clock of the client when it sent the report
+			if skew := arrival.Sub(ntpTime(p.NTPTime)); skew > maxSenderReportSkew || skew < -maxSenderReportSkew {
+				fmt.Printf("Track %s: sender report from SSRC %d is %s off the server clock\n", m.track, p.SSRC, skew.Round(time.Millisecond))
+			}
+			m.observeReceptions(p.Reports)
+		case *rtcp.ReceiverReport:
+			m.reports++
+			m.observeReceptions(p.Reports)
+		case *rtcp.PictureLossIndication, *rtcp.FullIntraRequest:
+			if m.onPictureLoss != nil {
+				m.onPictureLoss()
+			}
+		}
+	}
+	return goodbye
+}
+
+func (m *RTCPMonitor) observeReceptions(reports []rtcp.ReceptionReport) {
+	if m.onReception == nil {
+		return
+	}
+	for _, report := range reports {
+		m.onReception(report.FractionLost)
+	}
+}
+
+// Run reads the RTCP of sender until it is stopped and warns once if no report arrived within
+// rtcpReportTimeout after started is done and the sender was not stopped in the meantime
+func (m *RTCPMonitor) Run(sender *webrtc.RTPSender, started context.Context) {
+	stopped := make(chan struct{})
+	defer close(stopped)
+	go func() {
+		select {
+		case <-started.Done():
+		case <-stopped:
+			return
+		}
+		timer := time.NewTimer(rtcpReportTimeout)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-stopped:
+			return
+		}
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if m.reports == 0 {
+			fmt.Printf("Warning: track %s got no RTCP report within %s of streaming, media may only flow one way\n", m.track, rtcpReportTimeout)
+		}
+	}()
+
+	for {
+		packets, _, err := sender.ReadRTCP()
+		if err != nil {
+			return
+		}
+		if m.Observe(packets, time.Now()) && m.onGoodbye != nil {
+			m.onGoodbye()
+			return
+		}
+	}
+}
+
+func logGoodbye(track string, bye *rtcp.Goodbye) {
+	fmt.Printf("Track %s: RTCP BYE for SSRCs %v, reason %q\n", track, bye.Sources, bye.Reason)
+}
+
+// watchGoodbye reads the RTCP the client sends along with a track it publishes and calls onGoodbye
+// when it sends a BYE. Clients send one when they hang up, which ends the session in seconds
+// instead of waiting for ICE to time out.
+func watchGoodbye(receiver *webrtc.RTPReceiver, track string, onGoodbye func()) {
+	for {
+		packets, _, err := receiver.ReadRTCP()
+		if err != nil {
+			return
+		}
+		for _, packet := range packets {
+			if bye, ok := packet.(*rtcp.Goodbye); ok {
+				logGoodbye(track, bye)
+				onGoodbye()
+				return
+			}
+		}
+	}
+}
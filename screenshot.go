@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"os"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media/ivfreader"
+	"golang.org/x/image/vp8"
+)
+
+// maxScreenshotInterval is the longest interval POST /sessions/:uuid/screenshot/schedule accepts, in seconds
+const maxScreenshotInterval = 3600
+
+var errNoKeyframe = errors.New("recording has no keyframe yet")
+
+// latestVP8Keyframe decodes the last keyframe of an IVF file that may still be being written,
+// a frame cut off at the end of the file is ignored
+func latestVP8Keyframe(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	ivf, header, err := ivfreader.NewWith(file)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errCorruptRecording, err)
+	}
+	if header.FourCC != fourCCVP8 {
+		return nil, fmt.Errorf("cannot decode %s video, only VP8", header.FourCC)
+	}
+
+	var keyframe []byte
+	for {
+		// The writer may be halfway through the last frame, ivfreader reports it as incomplete
+		frame, _, err := ivf.ParseNextFrame()
+		if err != nil {
+			break
+		}
+		if isIVFKeyFrame(header.FourCC, frame) {
+			keyframe = frame
+		}
+	}
+	if keyframe == nil {
+		return nil, errNoKeyframe
+	}
+
+	decoder := vp8.NewDecoder()
+	decoder.Init(bytes.NewReader(keyframe), len(keyframe))
+	if _, err := decoder.DecodeFrameHeader(); err != nil {
+		return nil, fmt.Errorf("%w: %v", errCorruptRecording, err)
+	}
+	img, err := decoder.DecodeFrame()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errCorruptRecording, err)
+	}
+	return img, nil
+}
+
+// currentVideoFile is the video file the session is recording into, the latest segment of a segmented recording
+func (s *recordingSession) currentVideoFile() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if n := len(s.meta.VideoSegments); n > 0 {
+		return s.meta.VideoSegments[n-1].File
+	}
+	return videoFileName
+}
+
+// captureScreenshot saves the latest keyframe of the recording as thumbnail_<timestamp>.jpg and returns its name
+func (s *recordingSession) captureScreenshot(at time.Time) (string, error) {
+	img, err := latestVP8Keyframe(recordingPath(s.id, s.currentVideoFile()))
+	if err != nil {
+		return "", err
+	}
+
+	name := "thumbnail_" + at.UTC().Format("20060102T150405Z") + ".jpg"
+	out, err := os.Create(recordingPath(s.id, name))
+	if err != nil {
+		return "", err
+	}
+	if err := jpeg.Encode(out, img, nil); err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		return "", err
+	}
+	return name, out.Close()
+}
+
+// scheduleScreenshots replaces the screenshot schedule of the session with one every interval, 0 only stops the current one
+func (s *recordingSession) scheduleScreenshots(interval time.Duration) {
+	s.mu.Lock()
+	if s.stopScreenshots != nil {
+		close(s.stopScreenshots)
+		s.stopScreenshots = nil
+	}
+	if interval == 0 {
+		s.mu.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	s.stopScreenshots = stop
+	s.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-ticker.C:
+				name, err := s.captureScreenshot(now)
+				if err != nil {
+					fmt.Printf("Session %s: cannot capture screenshot: %v\n", s.id, err)
+					continue
+				}
+				events.publish("thumbnail.captured", s.id, fiber.Map{"file": name})
+			}
+		}
+	}()
+}
+
+// handleScheduleScreenshots saves a thumbnail of a live recording every intervalSeconds until the
+// session closes, each one is announced on GET /events as thumbnail.captured. Scheduling again
+// replaces the interval, 0 stops taking screenshots.
+func handleScheduleScreenshots(c *fiber.Ctx) error {
+	id := c.Params("uuid")
+	if !isUUID(id) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid session id"})
+	}
+
+	var body struct {
+		IntervalSeconds *int `json:"intervalSeconds"`
+	}
+	if err := c.BodyParser(&body); err != nil || body.IntervalSeconds == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "intervalSeconds is required"})
+	}
+	if *body.IntervalSeconds < 0 || *body.IntervalSeconds > maxScreenshotInterval {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("intervalSeconds must be between 0 and %d", maxScreenshotInterval)})
+	}
+
+	session, ok := sessions.get(id)
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "session not found"})
+	}
+	if session.peerConnection == nil || session.peerConnection.ConnectionState() == webrtc.PeerConnectionStateClosed {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "session is not live"})
+	}
+
+	session.scheduleScreenshots(time.Duration(*body.IntervalSeconds) * time.Second)
+	return c.JSON(fiber.Map{"intervalSeconds": *body.IntervalSeconds})
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media"
+)
+
+// segmentKeyframeRetry is how often, in recording time, a keyframe is asked for again while a video
+// segment waits for one to start the next
+const segmentKeyframeRetry = time.Second
+
+// mediaSegment is one file of a recording split by duration, listed in session.json
+type mediaSegment struct {
+	File    string `json:"file"`
+	StartMs int64  `json:"startMs"`
+	EndMs   int64  `json:"endMs"`
+}
+
+// segmentedWriter is a DiskWriter that moves on to a new file once the current one holds duration
+// worth of samples. A new file only starts on a sample accepted by isBoundary, for video a keyframe,
+// so that every segment can be played on its own. Time is taken from the sample durations.
+type segmentedWriter struct {
+	duration   time.Duration
+	create     func(index int) (string, media.Writer, error)
+	isBoundary func(media.Sample) bool
+	// publish is called with all segments so far whenever one is started or finished
+	publish func([]mediaSegment)
+	// requestBoundary, if set, asks the sender for a sample that isBoundary accepts once a segment
+	// is due, and every segmentKeyframeRetry until one arrives
+	requestBoundary func()
+
+	mu           sync.Mutex
+	current      *DiskWriter
+	segments     []mediaSegment
+	elapsed      time.Duration
+	segmentStart time.Duration
+	// requested is set once the boundary of the current segment was asked for, at requestedAt
+	requested   bool
+	requestedAt time.Duration
+	closed      bool
+}
+
+// newSegmentedWriter opens the first segment straight away so a file that cannot be created fails the session early
+func newSegmentedWriter(duration time.Duration, create func(index int) (string, media.Writer, error), isBoundary func(media.Sample) bool, publish func([]mediaSegment)) (*segmentedWriter, error) {
+	w := &segmentedWriter{duration: duration, create: create, isBoundary: isBoundary, publish: publish}
+	if err := w.openSegment(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *segmentedWriter) openSegment() error {
+	name, writer, err := w.create(len(w.segments))
+	if err != nil {
+		return err
+	}
+	w.current = NewDiskWriter(writer)
+	w.segmentStart = w.elapsed
+	w.requested = false
+	w.segments = append(w.segments, mediaSegment{File: name, StartMs: w.elapsed.Milliseconds(), EndMs: w.elapsed.Milliseconds()})
+	w.publish(append([]mediaSegment(nil), w.segments...))
+	return nil
+}
+
+// finishSegment closes the current file and records where it ended
+func (w *segmentedWriter) finishSegment() error {
+	w.segments[len(w.segments)-1].EndMs = w.elapsed.Milliseconds()
+	return w.current.Close()
+}
+
+func (w *segmentedWriter) ProcessSample(sample media.Sample, codec string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return errPipelineStopped
+	}
+	if w.elapsed-w.segmentStart >= w.duration {
+		if w.isBoundary(sample) {
+			if err := w.finishSegment(); err != nil {
+				return fmt.Errorf("cannot close segment %s: %w", w.segments[len(w.segments)-1].File, err)
+			}
+			if err := w.openSegment(); err != nil {
+				return err
+			}
+		} else if w.requestBoundary != nil && (!w.requested || w.elapsed-w.requestedAt >= segmentKeyframeRetry) {
+			w.requested, w.requestedAt = true, w.elapsed
+			w.requestBoundary()
+		}
+	}
+
+	w.elapsed += sample.Duration
+	return w.current.ProcessSample(sample, codec)
+}
+
+func (w *segmentedWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	err := w.finishSegment()
+	w.publish(append([]mediaSegment(nil), w.segments...))
+	return err
+}
+
+// videoSegmentFileName names the index-th video segment, the first one keeps the usual output.ivf
+func videoSegmentFileName(index int) string {
+	if index == 0 {
+		return videoFileName
+	}
+	return fmt.Sprintf("output_video_%03d.ivf", index)
+}
+
+// newVideoSegmentWriter splits the VP8 recording of session into files of about duration each,
+// listed in session.json as videoSegments. Browsers only send keyframes when asked, so one is
+// requested with a PLI when a segment is due.
+func newVideoSegmentWriter(session *recordingSession, duration time.Duration) (*segmentedWriter, error) {
+	w, err := newSegmentedWriter(duration,
+		func(index int) (string, media.Writer, error) {
+			name := videoSegmentFileName(index)
+			w, err := session.createIVF(name)
+			return name, w, err
+		},
+		func(sample media.Sample) bool { return isIVFKeyFrame(fourCCVP8, sample.Data) },
+		func(segments []mediaSegment) {
+			if err := session.update(func(meta *sessionMetadata) { meta.VideoSegments = segments }); err != nil {
+				fmt.Println("Error writing session metadata:", err)
+			}
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	w.requestBoundary = func() {
+		if err := session.requestKeyframe(); err != nil && !errors.Is(err, errNoVideoTrack) {
+			fmt.Printf("Session %s: cannot request a keyframe for the next segment: %v\n", session.id, err)
+		}
+	}
+	return w, nil
+}
+
+// audioSegmentFileName names the index-th audio segment, the first one keeps the usual output.opus
+func audioSegmentFileName(index int) string {
+	if index == 0 {
+		return audioFileName
+	}
+	return fmt.Sprintf("output_audio_%03d.opus", index)
+}
+
+// newAudioSegmentWriter splits the Opus recording of session into files of about duration each,
+// listed in session.json as audioSegments. Each file is a complete Ogg Opus stream with its own
+// ID and comment headers, oggwriter writes them when a file is opened.
+func newAudioSegmentWriter(session *recordingSession, duration time.Duration, sampleRate uint32) (*segmentedWriter, error) {
+	return newSegmentedWriter(duration,
+		func(index int) (string, media.Writer, error) {
+			name := audioSegmentFileName(index)
+			w, err := session.createOGG(name, sampleRate, 2)
+			return name, w, err
+		},
+		// Every Opus packet can be decoded on its own
+		func(media.Sample) bool { return true },
+		func(segments []mediaSegment) {
+			if err := session.update(func(meta *sessionMetadata) { meta.AudioSegments = segments }); err != nil {
+				fmt.Println("Error writing session metadata:", err)
+			}
+		},
+	)
+}
+
+// sessionSegments returns copies of the video and audio segments listed in session.json of session
+func (s *recordingSession) sessionSegments() (video, audio []mediaSegment) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]mediaSegment{}, s.meta.VideoSegments...), append([]mediaSegment{}, s.meta.AudioSegments...)
+}
+
+// handleSegments lists the segments of a recording split by VIDEO_SEGMENT_DURATION or
+// AUDIO_SEGMENT_DURATION, a recording that was not split has none
+func handleSegments(c *fiber.Ctx) error {
+	session, err := statusSession(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+	video, audio := session.sessionSegments()
+	return c.JSON(fiber.Map{"video": video, "audio": audio})
+}
+
+// handleSegmentFile serves the segment of kind at the :index route parameter, counted from 0 in the
+// order session.json lists them. Segments are downloads, so they are served with GET rather than
+// POST /files/:uuid/segment/:index, and under /segment/video/ and /segment/audio/ since video and
+// audio are split apart and their segments are numbered on their own.
+func handleSegmentFile(kind webrtc.RTPCodecType) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		session, err := statusSession(c)
+		if err != nil {
+			return sendError(c, err)
+		}
+		index, err := strconv.Atoi(c.Params("index"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid segment index"})
+		}
+
+		video, audio := session.sessionSegments()
+		segments, contentType, validate := audio, "audio/ogg", validateOGGFile
+		if kind == webrtc.RTPCodecTypeVideo {
+			segments, contentType, validate = video, "video/x-ivf", validateIVFFile
+		}
+		if index < 0 || index >= len(segments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "segment not found"})
+		}
+		return serveRecordingFile(c, segments[index].File, contentType, validate)
+	}
+}
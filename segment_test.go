@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media"
+)
+
+// discardWriter is a media.Writer that drops what it is given
+type discardWriter struct{}
+
+func (discardWriter) WriteRTP(*rtp.Packet) error { return nil }
+func (discardWriter) Close() error               { return nil }
+
+func TestSegmentedWriterRequestsKeyframe(t *testing.T) {
+	var requests []time.Duration
+	var elapsed time.Duration
+	w, err := newSegmentedWriter(time.Second,
+		func(index int) (string, media.Writer, error) {
+			return fmt.Sprintf("segment %d", index), discardWriter{}, nil
+		},
+		func(sample media.Sample) bool { return isIVFKeyFrame(fourCCVP8, sample.Data) },
+		func([]mediaSegment) {},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.requestBoundary = func() { requests = append(requests, elapsed) }
+
+	keyframe, interframe := []byte{0x00}, []byte{0x01}
+	frames := append([][]byte{keyframe}, make([][]byte, 29)...)
+	for i := 1; i < len(frames); i++ {
+		frames[i] = interframe
+	}
+	// Only the keyframe asked for at 2s arrives, half a second later
+	frames[25] = keyframe
+
+	for _, frame := range frames {
+		if err := w.ProcessSample(media.Sample{Data: frame, Duration: 100 * time.Millisecond}, "video/VP8"); err != nil {
+			t.Fatal(err)
+		}
+		elapsed += 100 * time.Millisecond
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []time.Duration{time.Second, 2 * time.Second}; !slices.Equal(requests, want) {
+		t.Errorf("keyframes requested at %v, want at %v", requests, want)
+	}
+	if len(w.segments) != 2 || w.segments[1].StartMs != 2500 {
+		t.Errorf("segments %+v, want the second one to start at the keyframe at 2500ms", w.segments)
+	}
+}
+
+func TestHandleSegmentFile(t *testing.T) {
+	id := newTestSessionDir(t)
+	writeTestOGG(t, recordingPath(id, audioSegmentFileName(1)))
+	session := newRecordingSession(id)
+	session.meta.AudioSegments = []mediaSegment{
+		{File: audioSegmentFileName(0), EndMs: 1000},
+		{File: audioSegmentFileName(1), StartMs: 1000, EndMs: 2000},
+	}
+	sessions.add(session)
+	t.Cleanup(func() { sessions.remove(id) })
+
+	app := fiber.New()
+	app.Get("/files/:uuid/segment/video/:index", handleSegmentFile(webrtc.RTPCodecTypeVideo))
+	app.Get("/files/:uuid/segment/audio/:index", handleSegmentFile(webrtc.RTPCodecTypeAudio))
+
+	for _, tc := range []struct {
+		path string
+		want int
+	}{
+		{"/segment/audio/1", fiber.StatusOK},
+		{"/segment/audio/2", fiber.StatusNotFound},
+		{"/segment/audio/-1", fiber.StatusNotFound},
+		{"/segment/audio/first", fiber.StatusBadRequest},
+		// Video segments are numbered on their own, the recording has none
+		{"/segment/video/0", fiber.StatusNotFound},
+	} {
+		resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/files/"+id+tc.path, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tc.want {
+			t.Errorf("GET %s: status %d, want %d", tc.path, resp.StatusCode, tc.want)
+		}
+		if tc.want == fiber.StatusOK {
+			if ct := resp.Header.Get(fiber.HeaderContentType); ct != "audio/ogg" {
+				t.Errorf("GET %s: Content-Type %q, want audio/ogg", tc.path, ct)
+			}
+		}
+	}
+}
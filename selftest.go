@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pion/ice/v2"
+	"github.com/pion/logging"
+	"github.com/pion/rtp"
+	"github.com/pion/transport/v2/vnet"
+	"github.com/pion/webrtc/v3"
+)
+
+const (
+	// selfTestPackets is how many VP8 packets GET /admin/test/webrtc sends
+	selfTestPackets = 100
+	// selfTestTimeout bounds the whole self-test, from connecting to the last packet arriving
+	selfTestTimeout = 5 * time.Second
+)
+
+// selfTestMu runs one self-test at a time, each one sets up two peer connections
+var selfTestMu sync.Mutex
+
+type selfTestResult struct {
+	Success     bool    `json:"success"`
+	PacketsLost int     `json:"packetsLost"`
+	RTTMs       float64 `json:"rttMs"`
+	Error       string  `json:"error,omitempty"`
+}
+
+// selfTestNet connects two virtual networks through a vnet router, traffic between them never leaves the process
+func selfTestNet() (*vnet.Router, *vnet.Net, *vnet.Net, error) {
+	router, err := vnet.NewRouter(&vnet.RouterConfig{CIDR: "10.0.0.0/24", LoggerFactory: logging.NewDefaultLoggerFactory()})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var nets []*vnet.Net
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2"} {
+		n, err := vnet.NewNet(&vnet.NetConfig{StaticIPs: []string{ip}})
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if err := router.AddNet(n); err != nil {
+			return nil, nil, nil, err
+		}
+		nets = append(nets, n)
+	}
+	if err := router.Start(); err != nil {
+		return nil, nil, nil, err
+	}
+	return router, nets[0], nets[1], nil
+}
+
+// webrtcSelfTest connects two peer connections over vnet, sends selfTestPackets VP8 packets from
+// one to the other and counts those that arrive within selfTestTimeout. Unlike the readiness probe
+// it leaves out the host network, it checks the WebRTC stack itself: ICE, DTLS and SRTP.
+func webrtcSelfTest() (selfTestResult, error) {
+	result := selfTestResult{PacketsLost: selfTestPackets}
+	deadline := time.After(selfTestTimeout)
+
+	router, senderNet, receiverNet, err := selfTestNet()
+	if err != nil {
+		return result, err
+	}
+	defer router.Stop()
+
+	newPeer := func(n *vnet.Net) (*webrtc.PeerConnection, error) {
+		m := &webrtc.MediaEngine{}
+		if err := m.RegisterDefaultCodecs(); err != nil {
+			return nil, err
+		}
+		settings := webrtc.SettingEngine{}
+		settings.SetNet(n)
+		// vnet has no multicast, host candidates carry their virtual address
+		settings.SetICEMulticastDNSMode(ice.MulticastDNSModeDisabled)
+		return webrtc.NewAPI(webrtc.WithMediaEngine(m), webrtc.WithSettingEngine(settings)).NewPeerConnection(webrtc.Configuration{})
+	}
+	sender, err := newPeer(senderNet)
+	if err != nil {
+		return result, err
+	}
+	defer sender.Close()
+	receiver, err := newPeer(receiverNet)
+	if err != nil {
+		return result, err
+	}
+	defer receiver.Close()
+
+	track, err := webrtc.NewTrackLocalStaticRTP(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8}, "selftest", "selftest")
+	if err != nil {
+		return result, err
+	}
+	if _, err := sender.AddTrack(track); err != nil {
+		return result, err
+	}
+
+	connected := make(chan struct{})
+	var connectedOnce sync.Once
+	sender.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		if state == webrtc.PeerConnectionStateConnected {
+			connectedOnce.Do(func() { close(connected) })
+		}
+	})
+	// OnTrack fires on the first packet, which ReadRTP still returns, so every packet is counted
+	arrived := make(chan uint16, selfTestPackets)
+	receiver.OnTrack(func(remote *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		for {
+			packet, _, err := remote.ReadRTP()
+			if err != nil {
+				return
+			}
+			arrived <- packet.SequenceNumber
+		}
+	})
+
+	if err := connectPeers(sender, receiver); err != nil {
+		return result, err
+	}
+	select {
+	case <-connected:
+	case <-deadline:
+		return result, errors.New("peer connections did not connect")
+	}
+
+	for i := 0; i < selfTestPackets; i++ {
+		packet := &rtp.Packet{Header: rtp.Header{Version: 2, PayloadType: 96, SequenceNumber: uint16(i), Timestamp: uint32(i) * 3000, Marker: true}, Payload: vp8BlackKeyFrame}
+		if err := track.WriteRTP(packet); err != nil {
+			return result, err
+		}
+	}
+
+	received := map[uint16]bool{}
+	for len(received) < selfTestPackets {
+		select {
+		case seq := <-arrived:
+			received[seq] = true
+		case <-deadline:
+			result.PacketsLost = selfTestPackets - len(received)
+			return result, errors.New("not every packet arrived in time")
+		}
+	}
+	result.PacketsLost = 0
+	if pair, ok := selectedCandidatePair(sender.GetStats()); ok {
+		result.RTTMs = pair.RTTMs
+	}
+	result.Success = true
+	return result, nil
+}
+
+// handleWebRTCSelfTest runs webrtcSelfTest for monitoring scripts, a failed test is a 503. It is
+// served under /admin as every run sets up two peer connections.
+func handleWebRTCSelfTest(c *fiber.Ctx) error {
+	selfTestMu.Lock()
+	result, err := webrtcSelfTest()
+	selfTestMu.Unlock()
+
+	if err != nil {
+		result.Error = err.Error()
+		return c.Status(fiber.StatusServiceUnavailable).JSON(result)
+	}
+	return c.JSON(result)
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media"
+)
+
+const sessionFileName = "session.json"
+
+// TeardownReason describes why a recording session ended
+type TeardownReason string
+
+const (
+	// TeardownClientDisconnected means the connection was closed after being up, without a failure
+	TeardownClientDisconnected TeardownReason = "ClientDisconnected"
+	// TeardownNetworkFailure means the connection dropped and ICE gave up on it
+	TeardownNetworkFailure TeardownReason = "NetworkFailure"
+	// TeardownServerInitiated means the server closed the connection itself
+	TeardownServerInitiated TeardownReason = "ServerInitiated"
+	// TeardownTimeout means ICE never managed to connect
+	TeardownTimeout TeardownReason = "Timeout"
+)
+
+// sessionMetadata is persisted as session.json in the session directory
+type sessionMetadata struct {
+	ID             string         `json:"id"`
+	CreatedAt      time.Time      `json:"createdAt"`
+	EndedAt        *time.Time     `json:"endedAt,omitempty"`
+	TeardownReason TeardownReason `json:"teardownReason,omitempty"`
+	ICEStates      []string       `json:"iceStates,omitempty"`
+	// State is pending for sessions created by POST /sessions until their offer arrives, then recording and ended
+	State string `json:"state,omitempty"`
+
+	ObservedVideoFPS float64           `json:"observedVideoFPS,omitempty"`
+	ICESelectedPair  *iceCandidatePair `json:"iceSelectedPair,omitempty"`
+	VideoSegments    []mediaSegment    `json:"videoSegments,omitempty"`
+	AudioSegments    []mediaSegment    `json:"audioSegments,omitempty"`
+	// AudioTracks are the files of the audio tracks recorded, output.opus for the first one
+	AudioTracks []string `json:"audioTracks,omitempty"`
+	// VideoError and AudioError hold why the recording of that kind failed, the other kind keeps recording
+	VideoError string `json:"videoError,omitempty"`
+	AudioError string `json:"audioError,omitempty"`
+	// KeyframeRequests are the times POST /sessions/:uuid/keyframe asked the client for a keyframe
+	KeyframeRequests []time.Time `json:"keyframeRequests,omitempty"`
+	// WebM is the file written by POST /files/:uuid/export/webm
+	WebM string `json:"webm,omitempty"`
+	// Quality is the recording quality preset the session was answered with
+	Quality recordingQuality `json:"quality,omitempty"`
+	// VideoCodec is the codec of output.ivf, as named by GET /files/:uuid/probe
+	VideoCodec string `json:"videoCodec,omitempty"`
+	// VideoReplacedAt is when PUT /files/:uuid/video last replaced output.ivf
+	VideoReplacedAt *time.Time `json:"videoReplacedAt,omitempty"`
+	// Labels are set by clients with PATCH /files/:uuid/metadata
+	Labels map[string]string `json:"labels,omitempty"`
+	// Checksums are the SHA-256 of the recording files by name, as in their .sha256 files
+	Checksums map[string]string `json:"checksums,omitempty"`
+}
+
+// recordingSession tracks the state of one recording and keeps session.json up to date
+type recordingSession struct {
+	id  string
+	dir string
+	// peerConnection is only set for sessions recorded by this process
+	peerConnection *webrtc.PeerConnection
+
+	mu              sync.Mutex
+	meta            sessionMetadata
+	iceStates       []webrtc.ICEConnectionState
+	serverInitiated bool
+	// videoInjector is set while a video track is being recorded
+	videoInjector *sampleInjector
+	trackCounts   map[webrtc.RTPCodecType]int
+	forwarders    map[webrtc.RTPCodecType]*RTPForwarder
+	// videoSSRC is the SSRC of the video track while it is being recorded
+	videoSSRC uint32
+	// offerClaimed is set once an offer started recording into a pending session, or resuming one with reconnect
+	offerClaimed bool
+	// resume is set for a session resumed by POST / with reconnect, its recordings are appended to
+	resume bool
+	// audioSSRC is the SSRC of the audio track while it is being recorded
+	audioSSRC uint32
+	// codecConfig is the last one set by PATCH /sessions/:uuid/codecConfig, stopKeyframes ends its FIR loop
+	codecConfig   codecConfig
+	stopKeyframes chan struct{}
+	// signaling holds the next message for GET /sessions/:uuid/signaling, iceRestarting is set from
+	// offering an ICE restart until ICE connects again
+	signaling     chan string
+	iceRestarting bool
+	// dirLock is the open .lock file while the session holds the lock of its directory
+	dirLock *os.File
+	// files are the files the session opened, checked for leaks once it ended
+	files ResourceTracker
+	// stopScreenshots ends the schedule of POST /sessions/:uuid/screenshot/schedule
+	stopScreenshots chan struct{}
+
+	// videoStats and audioStats are written to codec_stats.json when the session ends
+	videoStats, audioStats codecCounters
+}
+
+func newRecordingSession(id string) *recordingSession {
+	return &recordingSession{
+		id:        id,
+		dir:       filepath.Join(filesDir, id),
+		signaling: make(chan string, 1),
+		meta: sessionMetadata{
+			ID:        id,
+			CreatedAt: time.Now().UTC(),
+		},
+	}
+}
+
+// update applies fn to the metadata and writes the result to session.json
+func (s *recordingSession) update(fn func(meta *sessionMetadata)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fn(&s.meta)
+	return writeSessionMetadata(s.dir, s.meta)
+}
+
+// recordICEState appends the state to the history used to work out the teardown reason
+func (s *recordingSession) recordICEState(state webrtc.ICEConnectionState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.iceStates = append(s.iceStates, state)
+}
+
+// markServerInitiated records that the server is about to close the connection on its own accord
+func (s *recordingSession) markServerInitiated() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.serverInitiated = true
+}
+
+// nextTrackIndex counts the tracks of kind received so far and returns the index of the new one, starting from 0
+func (s *recordingSession) nextTrackIndex(kind webrtc.RTPCodecType) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.trackCounts == nil {
+		s.trackCounts = map[webrtc.RTPCodecType]int{}
+	}
+	n := s.trackCounts[kind]
+	s.trackCounts[kind]++
+	return n
+}
+
+func (s *recordingSession) setVideoInjector(injector *sampleInjector) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.videoInjector = injector
+}
+
+// injectVideo writes samples into the video recording as if they had been received from the peer
+func (s *recordingSession) injectVideo(samples []media.Sample) error {
+	s.mu.Lock()
+	injector := s.videoInjector
+	s.mu.Unlock()
+
+	if injector == nil {
+		return errPipelineStopped
+	}
+	return injector.inject(samples)
+}
+
+// setForwarders replaces the RTP forwarders of the session, closing the previous ones. nil stops forwarding.
+func (s *recordingSession) setForwarders(forwarders map[webrtc.RTPCodecType]*RTPForwarder) {
+	s.mu.Lock()
+	previous := s.forwarders
+	s.forwarders = forwarders
+	s.mu.Unlock()
+
+	for _, f := range previous {
+		if err := f.Close(); err != nil {
+			fmt.Println(err)
+		}
+	}
+}
+
+// forwarder returns the packet tap that hands the packets of a track of kind to the current forwarder, if any
+func (s *recordingSession) forwarder(kind webrtc.RTPCodecType) func(*rtp.Packet) {
+	var (
+		last   *RTPForwarder
+		logged bool
+	)
+	return func(packet *rtp.Packet) {
+		s.mu.Lock()
+		f := s.forwarders[kind]
+		s.mu.Unlock()
+
+		if f == nil {
+			return
+		}
+		if f != last {
+			last, logged = f, false
+		}
+		forwardPacket(f, packet, &logged)
+	}
+}
+
+// end stores the teardown reason and end time. Only the first call has an effect,
+// later calls return false so callers can skip tearing down twice.
+func (s *recordingSession) end() (TeardownReason, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.meta.EndedAt != nil {
+		return s.meta.TeardownReason, false, nil
+	}
+
+	now := time.Now().UTC()
+	s.meta.EndedAt = &now
+	s.meta.TeardownReason = teardownReasonFor(s.iceStates, s.serverInitiated)
+	s.meta.State = sessionStateEnded
+	s.meta.ICEStates = make([]string, 0, len(s.iceStates))
+	for _, state := range s.iceStates {
+		s.meta.ICEStates = append(s.meta.ICEStates, state.String())
+	}
+	return s.meta.TeardownReason, true, writeSessionMetadata(s.dir, s.meta)
+}
+
+// teardownReasonFor derives the teardown reason from the ICE states a session went through:
+// a session that never connected timed out, Connected→Closed is a voluntary disconnect and
+// Connected→Disconnected→Failed (or any other failure after connecting) is a network failure.
+func teardownReasonFor(states []webrtc.ICEConnectionState, serverInitiated bool) TeardownReason {
+	if serverInitiated {
+		return TeardownServerInitiated
+	}
+
+	connected := false
+	for _, state := range states {
+		if state == webrtc.ICEConnectionStateConnected || state == webrtc.ICEConnectionStateCompleted {
+			connected = true
+		}
+	}
+	if !connected {
+		return TeardownTimeout
+	}
+
+	if len(states) > 0 && states[len(states)-1] == webrtc.ICEConnectionStateClosed {
+		for _, state := range states {
+			if state == webrtc.ICEConnectionStateFailed {
+				return TeardownNetworkFailure
+			}
+		}
+		return TeardownClientDisconnected
+	}
+	return TeardownNetworkFailure
+}
+
+// writeSessionMetadata replaces session.json in dir, going through a temporary file so readers never see a partial write
+func writeSessionMetadata(dir string, meta sessionMetadata) error {
+	b, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(dir, sessionFileName+".tmp")
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, sessionFileName)); err != nil {
+		return fmt.Errorf("cannot replace %s: %w", sessionFileName, err)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative signaling.proto
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pion/webrtc/v3"
+	"google.golang.org/protobuf/proto"
+)
+
+// protobufContentType selects the binary signaling encoding, a SessionDescription message from
+// signaling.proto as the whole body instead of base64 JSON in a form field
+const protobufContentType = "application/x-protobuf"
+
+var errInvalidProtobuf = errors.New("invalid protobuf")
+
+// isProtobuf tells if the request body is a protobuf SessionDescription
+func isProtobuf(c *fiber.Ctx) bool {
+	mediaType, _, _ := strings.Cut(c.Get(fiber.HeaderContentType), ";")
+	return strings.EqualFold(strings.TrimSpace(mediaType), protobufContentType)
+}
+
+// decodeProtobuf unmarshals a protobuf SessionDescription into obj
+func decodeProtobuf(in []byte, obj *webrtc.SessionDescription) error {
+	var msg SessionDescription
+	if err := proto.Unmarshal(in, &msg); err != nil {
+		return fmt.Errorf("%w: %v", errInvalidProtobuf, err)
+	}
+	if _, ok := SdpType_name[int32(msg.Type)]; !ok || msg.Type == SdpType_SDP_TYPE_UNSPECIFIED {
+		return fmt.Errorf("%w: unknown SDP type %d", errInvalidProtobuf, msg.Type)
+	}
+	obj.Type = webrtc.SDPType(msg.Type)
+	obj.SDP = msg.Sdp
+	return nil
+}
+
+// encodeProtobuf marshals obj as a protobuf SessionDescription
+func encodeProtobuf(obj *webrtc.SessionDescription) ([]byte, error) {
+	return proto.Marshal(&SessionDescription{Type: SdpType(obj.Type), Sdp: obj.SDP})
+}
+
+// respondWithSDP sends a session description in the encoding the request asked for: protobuf when
+// the offer came as protobuf, {"answer":"<base64>"} for Accept: application/json and the plain
+// base64 string otherwise
+func respondWithSDP(c *fiber.Ctx, sdp *webrtc.SessionDescription) error {
+	if isProtobuf(c) {
+		b, err := encodeProtobuf(sdp)
+		if err != nil {
+			return err
+		}
+		c.Set(fiber.HeaderContentType, protobufContentType)
+		return c.Send(b)
+	}
+	if c.Accepts(fiber.MIMETextPlain, fiber.MIMEApplicationJSON) == fiber.MIMEApplicationJSON {
+		return c.JSON(fiber.Map{"answer": encode(sdp)})
+	}
+	return c.SendString(encode(sdp))
+}
@@ -0,0 +1,224 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.34.2
+// 	protoc        (unknown)
+// source: signaling.proto
+
+package main
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// SdpType mirrors webrtc.SDPType, the values match so they convert directly
+type SdpType int32
+
+const (
+	SdpType_SDP_TYPE_UNSPECIFIED SdpType = 0
+	SdpType_SDP_TYPE_OFFER       SdpType = 1
+	SdpType_SDP_TYPE_PRANSWER    SdpType = 2
+	SdpType_SDP_TYPE_ANSWER      SdpType = 3
+	SdpType_SDP_TYPE_ROLLBACK    SdpType = 4
+)
+
+// Enum value maps for SdpType.
+var (
+	SdpType_name = map[int32]string{
+		0: "SDP_TYPE_UNSPECIFIED",
+		1: "SDP_TYPE_OFFER",
+		2: "SDP_TYPE_PRANSWER",
+		3: "SDP_TYPE_ANSWER",
+		4: "SDP_TYPE_ROLLBACK",
+	}
+	SdpType_value = map[string]int32{
+		"SDP_TYPE_UNSPECIFIED": 0,
+		"SDP_TYPE_OFFER":       1,
+		"SDP_TYPE_PRANSWER":    2,
+		"SDP_TYPE_ANSWER":      3,
+		"SDP_TYPE_ROLLBACK":    4,
+	}
+)
+
+func (x SdpType) Enum() *SdpType {
+	p := new(SdpType)
+	*p = x
+	return p
+}
+
+func (x SdpType) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (SdpType) Descriptor() protoreflect.EnumDescriptor {
+	return file_signaling_proto_enumTypes[0].Descriptor()
+}
+
+func (SdpType) Type() protoreflect.EnumType {
+	return &file_signaling_proto_enumTypes[0]
+}
+
+func (x SdpType) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use SdpType.Descriptor instead.
+func (SdpType) EnumDescriptor() ([]byte, []int) {
+	return file_signaling_proto_rawDescGZIP(), []int{0}
+}
+
+// SessionDescription mirrors webrtc.SessionDescription. It is the body of POST / and POST /video
+// and of their answers when sent as application/x-protobuf.
+type SessionDescription struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Type SdpType `protobuf:"varint,1,opt,name=type,proto3,enum=webrtcpost.SdpType" json:"type,omitempty"`
+	Sdp  string  `protobuf:"bytes,2,opt,name=sdp,proto3" json:"sdp,omitempty"`
+}
+
+func (x *SessionDescription) Reset() {
+	*x = SessionDescription{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_signaling_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SessionDescription) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SessionDescription) ProtoMessage() {}
+
+func (x *SessionDescription) ProtoReflect() protoreflect.Message {
+	mi := &file_signaling_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SessionDescription.ProtoReflect.Descriptor instead.
+func (*SessionDescription) Descriptor() ([]byte, []int) {
+	return file_signaling_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *SessionDescription) GetType() SdpType {
+	if x != nil {
+		return x.Type
+	}
+	return SdpType_SDP_TYPE_UNSPECIFIED
+}
+
+func (x *SessionDescription) GetSdp() string {
+	if x != nil {
+		return x.Sdp
+	}
+	return ""
+}
+
+var File_signaling_proto protoreflect.FileDescriptor
+
+var file_signaling_proto_rawDesc = []byte{
+	0x0a, 0x0f, 0x73, 0x69, 0x67, 0x6e, 0x61, 0x6c, 0x69, 0x6e, 0x67, 0x2e, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x12, 0x0a, 0x77, 0x65, 0x62, 0x72, 0x74, 0x63, 0x70, 0x6f, 0x73, 0x74, 0x22, 0x4f, 0x0a,
+	0x12, 0x53, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x44, 0x65, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74,
+	0x69, 0x6f, 0x6e, 0x12, 0x27, 0x0a, 0x04, 0x74, 0x79, 0x70, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x0e, 0x32, 0x13, 0x2e, 0x77, 0x65, 0x62, 0x72, 0x74, 0x63, 0x70, 0x6f, 0x73, 0x74, 0x2e, 0x53,
+	0x64, 0x70, 0x54, 0x79, 0x70, 0x65, 0x52, 0x04, 0x74, 0x79, 0x70, 0x65, 0x12, 0x10, 0x0a, 0x03,
+	0x73, 0x64, 0x70, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x73, 0x64, 0x70, 0x2a, 0x7a,
+	0x0a, 0x07, 0x53, 0x64, 0x70, 0x54, 0x79, 0x70, 0x65, 0x12, 0x18, 0x0a, 0x14, 0x53, 0x44, 0x50,
+	0x5f, 0x54, 0x59, 0x50, 0x45, 0x5f, 0x55, 0x4e, 0x53, 0x50, 0x45, 0x43, 0x49, 0x46, 0x49, 0x45,
+	0x44, 0x10, 0x00, 0x12, 0x12, 0x0a, 0x0e, 0x53, 0x44, 0x50, 0x5f, 0x54, 0x59, 0x50, 0x45, 0x5f,
+	0x4f, 0x46, 0x46, 0x45, 0x52, 0x10, 0x01, 0x12, 0x15, 0x0a, 0x11, 0x53, 0x44, 0x50, 0x5f, 0x54,
+	0x59, 0x50, 0x45, 0x5f, 0x50, 0x52, 0x41, 0x4e, 0x53, 0x57, 0x45, 0x52, 0x10, 0x02, 0x12, 0x13,
+	0x0a, 0x0f, 0x53, 0x44, 0x50, 0x5f, 0x54, 0x59, 0x50, 0x45, 0x5f, 0x41, 0x4e, 0x53, 0x57, 0x45,
+	0x52, 0x10, 0x03, 0x12, 0x15, 0x0a, 0x11, 0x53, 0x44, 0x50, 0x5f, 0x54, 0x59, 0x50, 0x45, 0x5f,
+	0x52, 0x4f, 0x4c, 0x4c, 0x42, 0x41, 0x43, 0x4b, 0x10, 0x04, 0x42, 0x29, 0x5a, 0x27, 0x67, 0x69,
+	0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x73, 0x61, 0x68, 0x69, 0x6c, 0x70, 0x61,
+	0x77, 0x61, 0x72, 0x35, 0x38, 0x2f, 0x77, 0x65, 0x62, 0x72, 0x74, 0x63, 0x50, 0x6f, 0x73, 0x74,
+	0x3b, 0x6d, 0x61, 0x69, 0x6e, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_signaling_proto_rawDescOnce sync.Once
+	file_signaling_proto_rawDescData = file_signaling_proto_rawDesc
+)
+
+func file_signaling_proto_rawDescGZIP() []byte {
+	file_signaling_proto_rawDescOnce.Do(func() {
+		file_signaling_proto_rawDescData = protoimpl.X.CompressGZIP(file_signaling_proto_rawDescData)
+	})
+	return file_signaling_proto_rawDescData
+}
+
+var file_signaling_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_signaling_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_signaling_proto_goTypes = []any{
+	(SdpType)(0),               // 0: webrtcpost.SdpType
+	(*SessionDescription)(nil), // 1: webrtcpost.SessionDescription
+}
+var file_signaling_proto_depIdxs = []int32{
+	0, // 0: webrtcpost.SessionDescription.type:type_name -> webrtcpost.SdpType
+	1, // [1:1] is the sub-list for method output_type
+	1, // [1:1] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
+}
+
+func init() { file_signaling_proto_init() }
+func file_signaling_proto_init() {
+	if File_signaling_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_signaling_proto_msgTypes[0].Exporter = func(v any, i int) any {
+			switch v := v.(*SessionDescription); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_signaling_proto_rawDesc,
+			NumEnums:      1,
+			NumMessages:   1,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_signaling_proto_goTypes,
+		DependencyIndexes: file_signaling_proto_depIdxs,
+		EnumInfos:         file_signaling_proto_enumTypes,
+		MessageInfos:      file_signaling_proto_msgTypes,
+	}.Build()
+	File_signaling_proto = out.File
+	file_signaling_proto_rawDesc = nil
+	file_signaling_proto_goTypes = nil
+	file_signaling_proto_depIdxs = nil
+}
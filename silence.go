@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pion/webrtc/v3/pkg/media/oggreader"
+)
+
+const silenceFileName = "silence_segments.json"
+
+// maxOpusFrameSamples is the longest Opus packet, 120ms, in samples per channel at 48 kHz
+const maxOpusFrameSamples = 5760
+
+// errNoOpusDecoder is returned by builds without the opus tag, which have no Opus decoder, so the
+// default build answers 501 on the routes that decode audio. The tag needs cgo and libopus, see
+// make build-opus.
+var errNoOpusDecoder = errors.New("decoding Opus needs a server built with -tags opus against libopus")
+
+// pcmDecoder decodes one Opus packet into interleaved 16 bit samples and returns the samples per channel
+type pcmDecoder interface {
+	Decode(packet []byte, pcm []int16) (int, error)
+}
+
+type silenceSegment struct {
+	StartMs int64 `json:"startMs"`
+	EndMs   int64 `json:"endMs"`
+}
+
+// silenceCache is silence_segments.json, the threshold tells whether the segments are still the ones asked for
+type silenceCache struct {
+	ThresholdDB float64          `json:"thresholdDb"`
+	Segments    []silenceSegment `json:"segments"`
+}
+
+// pcmLevel is the RMS level of samples in dB relative to full scale, -Inf for digital silence
+func pcmLevel(samples []int16) float64 {
+	var sum float64
+	for _, s := range samples {
+		sum += float64(s) * float64(s)
+	}
+	return 20 * math.Log10(math.Sqrt(sum/float64(len(samples)))/math.MaxInt16)
+}
+
+// DetectSilence decodes an Ogg Opus recording and returns the stretches whose level stays below
+// thresholdDB. Each packet is judged as a whole, so segments are as precise as the 20ms frames
+// browsers send. Gaps in the recording, such as those left by DTX, count as silence.
+func DetectSilence(r io.Reader, thresholdDB float64) ([]silenceSegment, error) {
+	ogg, header, err := oggreader.NewWith(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errCorruptRecording, err)
+	}
+	channels := int(header.Channels)
+	decoder, err := newPCMDecoder(opusClockRate, channels)
+	if err != nil {
+		return nil, err
+	}
+
+	segments := []silenceSegment{}
+	var (
+		pcm     = make([]int16, maxOpusFrameSamples*channels)
+		silent  *silenceSegment
+		endedAt int64
+	)
+	mark := func(startMs, endMs int64, quiet bool) {
+		switch {
+		case quiet && silent == nil:
+			silent = &silenceSegment{StartMs: startMs, EndMs: endMs}
+		case quiet:
+			silent.EndMs = endMs
+		case silent != nil:
+			segments = append(segments, *silent)
+			silent = nil
+		}
+	}
+	for {
+		payload, pageHeader, err := ogg.ParseNextPage()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%w: %v", errCorruptRecording, err)
+		}
+		if bytes.HasPrefix(payload, []byte("OpusTags")) || len(payload) == 0 {
+			continue
+		}
+
+		n, err := decoder.Decode(payload, pcm)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errCorruptRecording, err)
+		}
+		// oggwriter sets the granule of a page to the time its packet starts at
+		startMs := int64(pageHeader.GranulePosition * 1000 / opusClockRate)
+		endMs := startMs + int64(n)*1000/opusClockRate
+		if startMs > endedAt {
+			mark(endedAt, startMs, true)
+		}
+		mark(startMs, endMs, n == 0 || pcmLevel(pcm[:n*channels]) < thresholdDB)
+		endedAt = max(endedAt, endMs)
+	}
+	mark(0, 0, false)
+	return segments, nil
+}
+
+// handleSilence returns the silent stretches of the audio recording, below SILENCE_THRESHOLD_DB.
+// The result is kept in silence_segments.json until the recording or the threshold changes.
+// Decoding the audio needs a build with -tags opus, other builds answer 501 Not Implemented.
+func handleSilence(cfg Config) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		path, err := recordingFile(c.Params("uuid"), audioFileName, validateOGGFile)
+		if err != nil {
+			return sendError(c, err)
+		}
+		cachePath := recordingPath(c.Params("uuid"), silenceFileName)
+
+		if audio, err := os.Stat(path); err == nil {
+			if cached, err := os.Stat(cachePath); err == nil && !cached.ModTime().Before(audio.ModTime()) {
+				var cache silenceCache
+				if b, err := os.ReadFile(cachePath); err == nil && json.Unmarshal(b, &cache) == nil && cache.ThresholdDB == cfg.SilenceThresholdDB {
+					return c.JSON(cache.Segments)
+				}
+			}
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		segments, err := DetectSilence(file, cfg.SilenceThresholdDB)
+		if errors.Is(err, errNoOpusDecoder) {
+			return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": err.Error()})
+		} else if errors.Is(err, errCorruptRecording) {
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()})
+		} else if err != nil {
+			return err
+		}
+
+		b, err := json.MarshalIndent(silenceCache{ThresholdDB: cfg.SilenceThresholdDB, Segments: segments}, "", "  ")
+		if err == nil {
+			err = os.WriteFile(cachePath, b, 0o644)
+		}
+		if err != nil {
+			fmt.Println("Error writing silence segments:", err)
+		}
+		return c.JSON(segments)
+	}
+}
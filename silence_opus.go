@@ -0,0 +1,14 @@
+//go:build opus
+
+package main
+
+import "github.com/hraban/opus"
+
+// newPCMDecoder uses libopus through cgo. Build with -tags opus,nolibopusfile unless libopusfile is installed as well.
+func newPCMDecoder(sampleRate, channels int) (pcmDecoder, error) {
+	decoder, err := opus.NewDecoder(sampleRate, channels)
+	if err != nil {
+		return nil, err
+	}
+	return decoder, nil
+}
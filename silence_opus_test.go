@@ -0,0 +1,36 @@
+//go:build opus
+
+package main
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+
+	"github.com/sahilpawar58/webrtcPost/testutil"
+)
+
+func TestDetectSilenceSineWave(t *testing.T) {
+	ogg, err := testutil.GenerateOpusSineWave(440, 1000, opusClockRate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The sine wave is at half of full scale, about -9 dBFS
+	tests := []struct {
+		thresholdDB float64
+		want        []silenceSegment
+	}{
+		{-40, []silenceSegment{}},
+		{-3, []silenceSegment{{StartMs: 0, EndMs: 1000}}},
+	}
+	for _, tt := range tests {
+		segments, err := DetectSilence(bytes.NewReader(ogg), tt.thresholdDB)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(segments, tt.want) {
+			t.Errorf("silence below %v dBFS %v, want %v", tt.thresholdDB, segments, tt.want)
+		}
+	}
+}
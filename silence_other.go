@@ -0,0 +1,8 @@
+//go:build !opus
+
+package main
+
+// newPCMDecoder has no Opus decoder without the opus tag, DetectSilence and transcripts fail with errNoOpusDecoder
+func newPCMDecoder(int, int) (pcmDecoder, error) {
+	return nil, errNoOpusDecoder
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pion/webrtc/v3"
+)
+
+// simulatedVideoCodecs are the videoCodec values POST /admin/simulate/offer understands
+var simulatedVideoCodecs = map[string]string{
+	"VP8":  webrtc.MimeTypeVP8,
+	"VP9":  webrtc.MimeTypeVP9,
+	"H264": webrtc.MimeTypeH264,
+	"AV1":  webrtc.MimeTypeAV1,
+}
+
+// simulatedOffer creates the offer of a browser sending video in videoMimeType, no video when empty,
+// and Opus audio when audio is set. The peer connection is closed again, so the offer is only good
+// for exercising signaling.
+func simulatedOffer(cfg Config, videoMimeType string, audio bool) (*webrtc.SessionDescription, error) {
+	// Register only the codecs to offer, like a browser told which codec to use
+	m := &webrtc.MediaEngine{}
+	var kinds []webrtc.RTPCodecType
+	if audio {
+		if err := m.RegisterCodec(webrtc.RTPCodecParameters{
+			RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus, ClockRate: 48000, Channels: 2, SDPFmtpLine: "minptime=10;useinbandfec=1"},
+			PayloadType:        111,
+		}, webrtc.RTPCodecTypeAudio); err != nil {
+			return nil, err
+		}
+		kinds = append(kinds, webrtc.RTPCodecTypeAudio)
+	}
+	if videoMimeType != "" {
+		fmtp := ""
+		if videoMimeType == webrtc.MimeTypeH264 {
+			fmtp = "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42e01f"
+		}
+		if err := m.RegisterCodec(webrtc.RTPCodecParameters{
+			RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: videoMimeType, ClockRate: 90000, SDPFmtpLine: fmtp},
+			PayloadType:        96,
+		}, webrtc.RTPCodecTypeVideo); err != nil {
+			return nil, err
+		}
+		kinds = append(kinds, webrtc.RTPCodecTypeVideo)
+	}
+
+	pc, err := webrtc.NewAPI(webrtc.WithMediaEngine(m)).NewPeerConnection(peerConnectionConfig(cfg))
+	if err != nil {
+		return nil, err
+	}
+	defer pc.Close()
+	for _, kind := range kinds {
+		if _, err := pc.AddTransceiverFromKind(kind, webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionSendonly}); err != nil {
+			return nil, err
+		}
+	}
+
+	offer, err := pc.CreateOffer(nil)
+	if err != nil {
+		return nil, err
+	}
+	gatherComplete := webrtc.GatheringCompletePromise(pc)
+	if err := pc.SetLocalDescription(offer); err != nil {
+		return nil, err
+	}
+	<-gatherComplete
+	return pc.LocalDescription(), nil
+}
+
+// handleSimulateOffer responds with a synthetic offer encoded like the param of POST /, so tests can
+// drive the recording endpoint without a browser. ?videoCodec= is VP8, VP9, H264, AV1 or none and
+// ?audioEnabled= turns the Opus track on or off.
+func handleSimulateOffer(cfg Config) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		videoCodec := strings.ToUpper(c.Query("videoCodec", "VP8"))
+		videoMimeType, ok := simulatedVideoCodecs[videoCodec]
+		if !ok && videoCodec != "NONE" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "videoCodec must be VP8, VP9, H264, AV1 or none"})
+		}
+		audio := c.QueryBool("audioEnabled", true)
+		if videoMimeType == "" && !audio {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "the offer needs video or audio"})
+		}
+
+		offer, err := simulatedOffer(cfg, videoMimeType, audio)
+		if err != nil {
+			return err
+		}
+		return c.SendString(encode(offer))
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media"
+)
+
+// FrameRateTracker computes the frame rate of a video track over a sliding window.
+// A new frame starts whenever the RTP timestamp changes. It is a MediaPipeline stage
+// so it can be placed next to the DiskWriter of the track.
+type FrameRateTracker struct {
+	window time.Duration
+
+	mu            sync.Mutex
+	arrivals      []time.Time
+	lastTimestamp uint32
+	seenPacket    bool
+}
+
+func NewFrameRateTracker(window time.Duration) *FrameRateTracker {
+	return &FrameRateTracker{window: window}
+}
+
+// Observe records a packet with the given RTP timestamp that arrived at the given time
+func (t *FrameRateTracker) Observe(timestamp uint32, arrival time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.seenPacket && timestamp == t.lastTimestamp {
+		return
+	}
+	t.seenPacket = true
+	t.lastTimestamp = timestamp
+	t.arrivals = append(t.arrivals, arrival)
+
+	// Drop the frames that fell out of the window
+	cutoff := arrival.Add(-t.window)
+	i := 0
+	for i < len(t.arrivals) && t.arrivals[i].Before(cutoff) {
+		i++
+	}
+	t.arrivals = t.arrivals[i:]
+}
+
+func (t *FrameRateTracker) ProcessSample(sample media.Sample, _ string) error {
+	t.Observe(sample.PacketTimestamp, time.Now())
+	return nil
+}
+
+func (t *FrameRateTracker) Close() error { return nil }
+
+// FPS returns the frame rate over the window, rounded to two decimals, or 0 before two frames arrived
+func (t *FrameRateTracker) FPS() float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.arrivals) < 2 {
+		return 0
+	}
+	span := t.arrivals[len(t.arrivals)-1].Sub(t.arrivals[0]).Seconds()
+	if span <= 0 {
+		return 0
+	}
+	return math.Round(float64(len(t.arrivals)-1)/span*100) / 100
+}
+
+// iceCandidatePair describes the candidate pair ICE selected for media
+type iceCandidatePair struct {
+	LocalCandidateType  string  `json:"localCandidateType"`
+	RemoteCandidateType string  `json:"remoteCandidateType"`
+	RTTMs               float64 `json:"rttMs"`
+}
+
+// selectedCandidatePair finds the nominated candidate pair in a stats report
+func selectedCandidatePair(report webrtc.StatsReport) (*iceCandidatePair, bool) {
+	for _, stats := range report {
+		pairStats, ok := stats.(webrtc.ICECandidatePairStats)
+		if !ok || !pairStats.Nominated {
+			continue
+		}
+
+		pair := &iceCandidatePair{RTTMs: math.Round(pairStats.CurrentRoundTripTime * 1000)}
+		if local, ok := report[pairStats.LocalCandidateID].(webrtc.ICECandidateStats); ok {
+			pair.LocalCandidateType = local.CandidateType.String()
+		}
+		if remote, ok := report[pairStats.RemoteCandidateID].(webrtc.ICECandidateStats); ok {
+			pair.RemoteCandidateType = remote.CandidateType.String()
+		}
+		return pair, true
+	}
+	return nil, false
+}
+
+// RolloverCounter extends 16 bit RTP sequence numbers to 64 bits so they keep increasing across
+// the wrap-around from 65535 to 0. A jump of more than half the sequence number space backwards,
+// such as 65535→0, is a rollover, smaller backward jumps are reordered packets.
+type RolloverCounter struct {
+	highest uint64
+	started bool
+}
+
+// Extend returns the extended sequence number of seq. The first packet is counted in cycle 1 rather
+// than 0, so that packets reordered from before it still get a sequence number below it.
+func (r *RolloverCounter) Extend(seq uint16) uint64 {
+	if !r.started {
+		r.started = true
+		r.highest = 1<<16 | uint64(seq)
+		return r.highest
+	}
+
+	// The distance to the highest sequence number so far, the shorter way round the 16 bit circle
+	delta := int64(int16(seq - uint16(r.highest)))
+	ext := uint64(int64(r.highest) + delta)
+	if ext > r.highest {
+		r.highest = ext
+	}
+	return ext
+}
+
+// Highest returns the highest extended sequence number seen
+func (r *RolloverCounter) Highest() uint64 {
+	return r.highest
+}
+
+// packetCounter counts the packets received on a track and how many of the expected ones are missing
+type packetCounter struct {
+	seq      RolloverCounter
+	first    uint64
+	received uint64
+}
+
+func (c *packetCounter) Observe(seq uint16) {
+	ext := c.seq.Extend(seq)
+	if c.received == 0 || ext < c.first {
+		c.first = ext
+	}
+	c.received++
+}
+
+// Expected returns the number of packets between the first and the highest sequence number seen
+func (c *packetCounter) Expected() uint64 {
+	if c.received == 0 {
+		return 0
+	}
+	return c.seq.Highest() - c.first + 1
+}
+
+// Lost returns how many expected packets never arrived, duplicates can make it negative
+func (c *packetCounter) Lost() int64 {
+	return int64(c.Expected()) - int64(c.received)
+}
+
+// oneWayDelaySamples is how many of the latest packets OneWayDelayTracker keeps the delay of
+const oneWayDelaySamples = 4096
+
+// OneWayDelayTracker computes the median one-way delay of RTP packets carrying the abs-send-time
+// header extension. The extension holds the sender's NTP time, so the delays only mean something
+// when the clocks of the sender and the server are synchronized. Otherwise the median still shows
+// how the delay changes, offset by the difference between the clocks.
+type OneWayDelayTracker struct {
+	mu     sync.Mutex
+	delays []time.Duration
+	next   int
+}
+
+func NewOneWayDelayTracker() *OneWayDelayTracker {
+	return &OneWayDelayTracker{}
+}
+
+// Observe records the delay of a packet that arrived at the given time, extensionID is the
+// negotiated id of abs-send-time. Packets without the extension are ignored.
+func (t *OneWayDelayTracker) Observe(packet *rtp.Packet, extensionID uint8, arrival time.Time) {
+	if extensionID == 0 {
+		return
+	}
+	raw := packet.GetExtension(extensionID)
+	if raw == nil {
+		return
+	}
+	var ext rtp.AbsSendTimeExtension
+	if err := ext.Unmarshal(raw); err != nil {
+		return
+	}
+	delay := arrival.Sub(ext.Estimate(arrival))
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.delays) < oneWayDelaySamples {
+		t.delays = append(t.delays, delay)
+		return
+	}
+	t.delays[t.next] = delay
+	t.next = (t.next + 1) % oneWayDelaySamples
+}
+
+// Median returns the median delay of the latest packets, false if none carried abs-send-time
+func (t *OneWayDelayTracker) Median() (time.Duration, bool) {
+	t.mu.Lock()
+	sorted := append([]time.Duration(nil), t.delays...)
+	t.mu.Unlock()
+
+	if len(sorted) == 0 {
+		return 0, false
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[len(sorted)/2], true
+}
+
+// headerExtensionID returns the id negotiated for the header extension with the given URI, 0 if it was not negotiated
+func headerExtensionID(receiver *webrtc.RTPReceiver, uri string) uint8 {
+	for _, ext := range receiver.GetParameters().HeaderExtensions {
+		if ext.URI == uri {
+			return uint8(ext.ID)
+		}
+	}
+	return 0
+}
+
+// watchSelectedCandidatePair logs every change of the candidate pair ICE sends over and appends it
+// to events.jsonl as ice.selectedPairChanged. A mobile client switching between WiFi and cellular
+// shows up as a new pair, usually of other candidate types.
+func watchSelectedCandidatePair(pc *webrtc.PeerConnection, session *recordingSession) {
+	pc.SCTP().Transport().ICETransport().OnSelectedCandidatePairChange(func(pair *webrtc.ICECandidatePair) {
+		if pair == nil || pair.Local == nil || pair.Remote == nil {
+			return
+		}
+		local := fmt.Sprintf("%s %s:%d", pair.Local.Typ, pair.Local.Address, pair.Local.Port)
+		remote := fmt.Sprintf("%s %s:%d", pair.Remote.Typ, pair.Remote.Address, pair.Remote.Port)
+		slog.Info("ICE selected candidate pair changed", "session", session.id, "local", local, "remote", remote, "protocol", pair.Local.Protocol.String())
+		session.logEvent("ice.selectedPairChanged", fiber.Map{
+			"localCandidateType":  pair.Local.Typ.String(),
+			"remoteCandidateType": pair.Remote.Typ.String(),
+			"local":               local,
+			"remote":              remote,
+			"protocol":            pair.Local.Protocol.String(),
+		})
+	})
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRolloverCounterWrap(t *testing.T) {
+	const cycle = 1 << 16
+	tests := []struct {
+		name string
+		seqs []uint16
+		// ext are the extended sequence numbers of seqs, lost the packets missing from the first to the highest
+		ext  []uint64
+		lost int64
+	}{
+		{
+			name: "in order",
+			seqs: []uint16{65534, 65535, 0, 1},
+			ext:  []uint64{cycle + 65534, cycle + 65535, 2 * cycle, 2*cycle + 1},
+		},
+		{
+			name: "gap at the wrap",
+			seqs: []uint16{65534, 0, 1},
+			ext:  []uint64{cycle + 65534, 2 * cycle, 2*cycle + 1},
+			lost: 1,
+		},
+		{
+			name: "gap after the wrap",
+			seqs: []uint16{65534, 65535, 1},
+			ext:  []uint64{cycle + 65534, cycle + 65535, 2*cycle + 1},
+			lost: 1,
+		},
+		{
+			name: "reordered across the wrap",
+			seqs: []uint16{65535, 0, 65534, 1},
+			ext:  []uint64{cycle + 65535, 2 * cycle, cycle + 65534, 2*cycle + 1},
+		},
+		{
+			name: "first packet after the wrap",
+			seqs: []uint16{0, 65535, 1},
+			ext:  []uint64{cycle, cycle - 1, cycle + 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				r       RolloverCounter
+				counter packetCounter
+				ext     []uint64
+			)
+			for _, seq := range tt.seqs {
+				ext = append(ext, r.Extend(seq))
+				counter.Observe(seq)
+			}
+			if !slices.Equal(ext, tt.ext) {
+				t.Errorf("extended %v to %v, want %v", tt.seqs, ext, tt.ext)
+			}
+			if want := slices.Max(tt.ext); r.Highest() != want {
+				t.Errorf("highest %d, want %d", r.Highest(), want)
+			}
+			if lost := counter.Lost(); lost != tt.lost {
+				t.Errorf("lost %d packets of %v, want %d", lost, tt.seqs, tt.lost)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// errETagMismatch means session.json changed since the client read it
+var errETagMismatch = errors.New("session.json changed, read it again and retry")
+
+// sessionETag is the quoted MD5 of the contents of session.json
+func sessionETag(b []byte) string {
+	sum := md5.Sum(b)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// readSessionFile returns session.json of the session with its ETag, s.mu must be held
+func (s *recordingSession) readSessionFile() ([]byte, string, error) {
+	b, err := os.ReadFile(filepath.Join(s.dir, sessionFileName))
+	if err != nil {
+		return nil, "", err
+	}
+	return b, sessionETag(b), nil
+}
+
+// updateIfMatch applies fn like update, but only while session.json still has the ETag etag.
+// It returns the ETag of the new session.json.
+func (s *recordingSession) updateIfMatch(etag string, fn func(meta *sessionMetadata)) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, current, err := s.readSessionFile()
+	if err != nil {
+		return "", err
+	}
+	if current != etag {
+		return "", errETagMismatch
+	}
+	fn(&s.meta)
+	if err := writeSessionMetadata(s.dir, s.meta); err != nil {
+		return "", err
+	}
+	_, updated, err := s.readSessionFile()
+	return updated, err
+}
+
+// statusSession returns the session of the :uuid route parameter for the routes that work from session.json
+func statusSession(c *fiber.Ctx) (*recordingSession, error) {
+	id := c.Params("uuid")
+	if !isUUID(id) {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "invalid session id")
+	}
+	session, ok := sessions.get(id)
+	if !ok {
+		return nil, fiber.NewError(fiber.StatusNotFound, "session not found")
+	}
+	return session, nil
+}
+
+// handleStatus returns session.json with its ETag, which PATCH /files/:uuid/metadata takes in If-Match
+func handleStatus(c *fiber.Ctx) error {
+	session, err := statusSession(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	session.mu.Lock()
+	b, etag, err := session.readSessionFile()
+	session.mu.Unlock()
+	if errors.Is(err, os.ErrNotExist) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "session has no session.json"})
+	} else if err != nil {
+		return err
+	}
+
+	c.Set(fiber.HeaderETag, etag)
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	return c.Send(b)
+}
+
+// handleUpdateMetadata sets the labels of a session from a JSON object of strings, null removes a
+// label. The If-Match header must hold the ETag of GET /files/:uuid/status, the update is refused
+// with 412 when session.json changed in the meantime so that no update is lost.
+func handleUpdateMetadata(c *fiber.Ctx) error {
+	session, err := statusSession(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+	etag := c.Get(fiber.HeaderIfMatch)
+	if etag == "" {
+		return c.Status(fiber.StatusPreconditionRequired).JSON(fiber.Map{"error": "If-Match with the ETag of GET /files/:uuid/status is required"})
+	}
+
+	var labels map[string]*string
+	if err := json.Unmarshal(c.Body(), &labels); err != nil || len(labels) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "body must be a JSON object of labels"})
+	}
+
+	updated, err := session.updateIfMatch(etag, func(meta *sessionMetadata) {
+		if meta.Labels == nil {
+			meta.Labels = map[string]string{}
+		}
+		for name, value := range labels {
+			if value == nil {
+				delete(meta.Labels, name)
+			} else {
+				meta.Labels[name] = *value
+			}
+		}
+	})
+	if errors.Is(err, errETagMismatch) {
+		return c.Status(fiber.StatusPreconditionFailed).JSON(fiber.Map{"error": err.Error()})
+	} else if errors.Is(err, os.ErrNotExist) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "session has no session.json"})
+	} else if err != nil {
+		return err
+	}
+
+	session.mu.Lock()
+	current := session.meta.Labels
+	session.mu.Unlock()
+	c.Set(fiber.HeaderETag, updated)
+	return c.JSON(fiber.Map{"labels": current})
+}
@@ -0,0 +1,3 @@
+// Package testutil generates the media the tests record and play back, so they need no fixture
+// files or external tools. The Opus encoder uses libopus and is only built with -tags opus.
+package testutil
@@ -0,0 +1,71 @@
+//go:build opus
+
+package testutil
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+
+	"github.com/hraban/opus"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3/pkg/media/oggwriter"
+)
+
+const (
+	// opusFrameMs is the length of each packet, the 20ms browsers send
+	opusFrameMs = 20
+	// opusClockRate is the RTP clock rate of Opus, whatever rate it was sampled at
+	opusClockRate = 48000
+	// maxOpusPacketSize is the buffer libopus recommends for one encoded packet
+	maxOpusPacketSize = 4000
+)
+
+// GenerateOpusSineWave encodes durationMs of a mono sine wave of frequency Hz at half of full scale,
+// sampled at sampleRate, and returns it as an Ogg Opus file with a 20ms packet on each page. The
+// duration is rounded up to whole packets and sampleRate must be one Opus takes: 8000, 12000,
+// 16000, 24000 or 48000.
+func GenerateOpusSineWave(frequency, durationMs, sampleRate int) ([]byte, error) {
+	if frequency <= 0 || durationMs <= 0 {
+		return nil, fmt.Errorf("frequency %d Hz and duration %dms must be positive", frequency, durationMs)
+	}
+	encoder, err := opus.NewEncoder(sampleRate, 1, opus.AppAudio)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	ogg, err := oggwriter.NewWith(&out, uint32(sampleRate), 1)
+	if err != nil {
+		return nil, err
+	}
+
+	frameSamples := sampleRate * opusFrameMs / 1000
+	pcm := make([]int16, frameSamples)
+	packet := make([]byte, maxOpusPacketSize)
+	for frame := 0; frame*opusFrameMs < durationMs; frame++ {
+		for i := range pcm {
+			t := float64(frame*frameSamples+i) / float64(sampleRate)
+			pcm[i] = int16(math.MaxInt16 / 2 * math.Sin(2*math.Pi*float64(frequency)*t))
+		}
+		n, err := encoder.Encode(pcm, packet)
+		if err != nil {
+			return nil, err
+		}
+
+		// oggwriter derives the granule of each page from the RTP timestamps
+		if err := ogg.WriteRTP(&rtp.Packet{
+			Header: rtp.Header{
+				SequenceNumber: uint16(frame),
+				Timestamp:      uint32(frame * opusClockRate * opusFrameMs / 1000),
+			},
+			Payload: packet[:n],
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if err := ogg.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,57 @@
+//go:build opus
+
+package testutil
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/pion/webrtc/v3/pkg/media/oggreader"
+)
+
+func TestGenerateOpusSineWave(t *testing.T) {
+	ogg, err := GenerateOpusSineWave(440, 1000, 48000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, header, err := oggreader.NewWith(bytes.NewReader(ogg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Channels != 1 || header.SampleRate != 48000 {
+		t.Errorf("OpusHead of %d channels at %d Hz, want mono at 48000 Hz", header.Channels, header.SampleRate)
+	}
+
+	var packets int
+	var lastGranule uint64
+	for {
+		payload, pageHeader, err := r.ParseNextPage()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.HasPrefix(payload, []byte("OpusTags")) {
+			continue
+		}
+		if packets > 0 && pageHeader.GranulePosition-lastGranule != 960 {
+			t.Errorf("page %d starts %d samples after the one before, want 960", packets, pageHeader.GranulePosition-lastGranule)
+		}
+		lastGranule = pageHeader.GranulePosition
+		packets++
+	}
+	if packets != 50 {
+		t.Errorf("got %d packets, want 50 of 20ms", packets)
+	}
+
+	if _, err := GenerateOpusSineWave(440, 0, 48000); err == nil {
+		t.Error("a sine wave of 0ms was generated")
+	}
+	if _, err := GenerateOpusSineWave(440, 100, 44100); err == nil {
+		t.Error("a sine wave at 44100 Hz, which Opus does not take, was generated")
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pion/webrtc/v3/pkg/media/ivfreader"
+)
+
+const timelineFileName = "timeline.json"
+
+type timelineKeyframe struct {
+	FrameIndex int   `json:"frameIndex"`
+	TimeMs     int64 `json:"timeMs"`
+}
+
+type timeline struct {
+	Keyframes []timelineKeyframe `json:"keyframes"`
+}
+
+// scanTimeline lists the keyframes of the IVF file at path with their position in the recording
+func scanTimeline(path string) (*timeline, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	ivf, header, err := ivfreader.NewWith(file)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errCorruptRecording, err)
+	}
+	if header.TimebaseDenominator == 0 {
+		return nil, fmt.Errorf("%w: zero timebase denominator", errCorruptRecording)
+	}
+
+	t := &timeline{Keyframes: []timelineKeyframe{}}
+	for index := 0; ; index++ {
+		frame, frameHeader, err := ivf.ParseNextFrame()
+		if errors.Is(err, io.EOF) {
+			return t, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: frame %d: %v", errCorruptRecording, index, err)
+		}
+		if isIVFKeyFrame(header.FourCC, frame) {
+			t.Keyframes = append(t.Keyframes, timelineKeyframe{
+				FrameIndex: index,
+				TimeMs:     int64(frameHeader.Timestamp * 1000 * uint64(header.TimebaseNumerator) / uint64(header.TimebaseDenominator)),
+			})
+		}
+	}
+}
+
+// cachedTimeline returns timeline.json of the session when it is newer than the video it was made from
+func cachedTimeline(id string, video os.FileInfo) (*timeline, bool) {
+	cache, err := os.Stat(recordingPath(id, timelineFileName))
+	if err != nil || cache.ModTime().Before(video.ModTime()) {
+		return nil, false
+	}
+	b, err := os.ReadFile(recordingPath(id, timelineFileName))
+	if err != nil {
+		return nil, false
+	}
+	var t timeline
+	if err := json.Unmarshal(b, &t); err != nil {
+		return nil, false
+	}
+	return &t, true
+}
+
+// handleTimeline lists the keyframes of the video recording, the seek points of an editor.
+// The result is cached in timeline.json until the video changes.
+func handleTimeline(c *fiber.Ctx) error {
+	id := c.Params("uuid")
+	path, err := recordingFile(id, videoFileName, validateIVFFile)
+	if err != nil {
+		return sendError(c, err)
+	}
+	video, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if t, ok := cachedTimeline(id, video); ok {
+		return c.JSON(t)
+	}
+
+	t, err := scanTimeline(path)
+	if err != nil {
+		if errors.Is(err, errCorruptRecording) {
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()})
+		}
+		return err
+	}
+	b, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(recordingPath(id, timelineFileName), b, 0o644); err != nil {
+		fmt.Printf("Cannot cache timeline of session %s: %v\n", id, err)
+	}
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	return c.Send(b)
+}
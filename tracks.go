@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media"
+)
+
+// mimeTypeRTX is the codec of RTP retransmission streams, RFC 4588
+const mimeTypeRTX = "video/rtx"
+
+// discardTrack reads and drops the packets of track until it ends
+func discardTrack(track *webrtc.TrackRemote) {
+	for {
+		if _, _, err := track.ReadRTP(); err != nil {
+			return
+		}
+	}
+}
+
+// trackEnded tells if err is how a track read ends once the peer stopped sending or the connection closed
+func trackEnded(err error) bool {
+	return err == nil || errors.Is(err, io.EOF)
+}
+
+// saveVideoTrack records the first VP8 track of session into writer until the track ends. The
+// track can take injected samples, gets keyframes requested and reports its frame rate while it
+// is recorded. ivfwriter drops frames until the first keyframe, which shows in the keyframe count.
+func saveVideoTrack(ctx context.Context, session *recordingSession, writer MediaPipeline, track *webrtc.TrackRemote, taps pipelineTaps) error {
+	_, span := tracer.Start(ctx, "track.video")
+
+	// Keep the observed frame rate in session.json up to date while recording
+	frameRate := NewFrameRateTracker(5 * time.Second)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if fps := frameRate.FPS(); fps > 0 {
+					if err := session.update(func(meta *sessionMetadata) { meta.ObservedVideoFPS = fps }); err != nil {
+						fmt.Println("Error writing session metadata:", err)
+					}
+				}
+			}
+		}
+	}()
+
+	taps.injector = newSampleInjector()
+	session.setVideoInjector(taps.injector)
+	session.setVideoSSRC(uint32(track.SSRC()))
+	defer session.setVideoSSRC(0)
+	defer session.setVideoInjector(nil)
+
+	keyframes := codecFrameCounter{&session.videoStats, func(sample media.Sample) bool { return isIVFKeyFrame(fourCCVP8, sample.Data) }}
+	first := &firstSampleLogger{session: session, event: "video.firstFrame"}
+	err := runPipeline(track, NewMultiWriter(writer, frameRate, keyframes, first), taps)
+	if trackEnded(err) {
+		err = nil
+	}
+	endSpan(span, err)
+	return err
+}
+
+// saveAudioTrack records the first Opus track of session into writer until the track ends
+func saveAudioTrack(ctx context.Context, session *recordingSession, writer MediaPipeline, track *webrtc.TrackRemote, taps pipelineTaps) error {
+	_, span := tracer.Start(ctx, "track.audio")
+
+	session.setAudioSSRC(uint32(track.SSRC()))
+	defer session.setAudioSSRC(0)
+
+	// oggwriter writes every sample as a page of its own
+	pages := codecFrameCounter{&session.audioStats, func(media.Sample) bool { return true }}
+	first := &firstSampleLogger{session: session, event: "audio.firstFrame"}
+	err := runPipeline(track, NewMultiWriter(writer, pages, first), taps)
+	if trackEnded(err) {
+		err = nil
+	}
+	endSpan(span, err)
+	return err
+}
+
+// recordTrackError logs that the recording of a track failed and keeps the error in session.json,
+// the tracks of the other kind are not affected
+func (s *recordingSession) recordTrackError(kind webrtc.RTPCodecType, err error) {
+	fmt.Printf("Session %s: %s recording failed: %v\n", s.id, kind, err)
+	events.publish("session.error", s.id, fiber.Map{"kind": kind.String(), "error": err.Error()})
+	if updateErr := s.update(func(meta *sessionMetadata) {
+		if kind == webrtc.RTPCodecTypeVideo {
+			meta.VideoError = err.Error()
+		} else {
+			meta.AudioError = err.Error()
+		}
+	}); updateErr != nil {
+		fmt.Println("Error writing session metadata:", updateErr)
+	}
+}
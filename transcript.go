@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pion/webrtc/v3/pkg/media/oggreader"
+)
+
+const (
+	transcriptFileName = "transcript.json"
+	// transcriptSampleRate is the rate Whisper works at, audio of any other rate is resampled by it first
+	transcriptSampleRate    = 16000
+	openAITranscriptionsURL = "https://api.openai.com/v1/audio/transcriptions"
+	// transcriptTimeout bounds the upload of the audio and the transcription of a long recording
+	transcriptTimeout = 5 * time.Minute
+)
+
+var errNoTranscriber = errors.New("transcription needs WHISPER_URL or OPENAI_API_KEY")
+
+// decodeOpusPCM decodes an Ogg Opus recording to mono 16 bit samples at sampleRate. Gaps in the
+// recording, such as those left by DTX, are filled with silence so that times in the PCM match the recording.
+func decodeOpusPCM(r io.Reader, sampleRate int) ([]int16, error) {
+	ogg, _, err := oggreader.NewWith(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errCorruptRecording, err)
+	}
+	// libopus mixes stereo down when asked for one channel
+	decoder, err := newPCMDecoder(sampleRate, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		samples []int16
+		frame   = make([]int16, maxOpusFrameSamples*sampleRate/opusClockRate)
+	)
+	for {
+		payload, pageHeader, err := ogg.ParseNextPage()
+		if errors.Is(err, io.EOF) {
+			return samples, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("%w: %v", errCorruptRecording, err)
+		}
+		if bytes.HasPrefix(payload, []byte("OpusTags")) || len(payload) == 0 {
+			continue
+		}
+
+		n, err := decoder.Decode(payload, frame)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errCorruptRecording, err)
+		}
+		// oggwriter sets the granule of a page to the time its packet starts at
+		if start := int(pageHeader.GranulePosition * uint64(sampleRate) / opusClockRate); start > len(samples) {
+			samples = append(samples, make([]int16, start-len(samples))...)
+		}
+		samples = append(samples, frame[:n]...)
+	}
+}
+
+// writeWAV writes mono 16 bit samples as a WAV file
+func writeWAV(w io.Writer, samples []int16, sampleRate int) error {
+	size := uint32(len(samples) * 2)
+	header := make([]byte, 44)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], 36+size)
+	copy(header[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(header[16:], 16)
+	binary.LittleEndian.PutUint16(header[20:], 1) // PCM
+	binary.LittleEndian.PutUint16(header[22:], 1) // mono
+	binary.LittleEndian.PutUint32(header[24:], uint32(sampleRate))
+	binary.LittleEndian.PutUint32(header[28:], uint32(sampleRate*2))
+	binary.LittleEndian.PutUint16(header[32:], 2)
+	binary.LittleEndian.PutUint16(header[34:], 16)
+	copy(header[36:], "data")
+	binary.LittleEndian.PutUint32(header[40:], size)
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.LittleEndian, samples)
+}
+
+// transcribe sends a WAV file to the local Whisper server at WHISPER_URL, or to the OpenAI API when
+// only OPENAI_API_KEY is set, and returns the JSON response. Both take the same multipart form, the
+// whisper.cpp server ignores the model field. An empty language lets Whisper detect it.
+func transcribe(cfg Config, wav []byte, language string) ([]byte, error) {
+	url := cfg.WhisperURL
+	if url == "" {
+		if cfg.OpenAIAPIKey == "" {
+			return nil, errNoTranscriber
+		}
+		url = openAITranscriptionsURL
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	file, err := form.CreateFormFile("file", "audio.wav")
+	if err == nil {
+		_, err = file.Write(wav)
+	}
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]string{"model": "whisper-1", "response_format": "json"}
+	if language != "" {
+		fields["language"] = language
+	}
+	for name, value := range fields {
+		if err := form.WriteField(name, value); err != nil {
+			return nil, err
+		}
+	}
+	if err := form.Close(); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(fiber.HeaderContentType, form.FormDataContentType())
+	if cfg.WhisperURL == "" {
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+cfg.OpenAIAPIKey)
+	}
+	resp, err := (&http.Client{Timeout: transcriptTimeout}).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("transcription failed with %s: %s", resp.Status, bytes.TrimSpace(b))
+	}
+	if !json.Valid(b) {
+		return nil, fmt.Errorf("transcription returned no JSON")
+	}
+	return b, nil
+}
+
+// handleTranscript transcribes output.opus of a session with Whisper and stores the response as
+// transcript.json, ?language=en skips the language detection. Whisper is sent PCM decoded from
+// the recording, which needs a build with -tags opus, other builds answer 501 Not Implemented.
+func handleTranscript(cfg Config) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		path, err := recordingFile(c.Params("uuid"), audioFileName, validateOGGFile)
+		if err != nil {
+			return sendError(c, err)
+		}
+		if cfg.WhisperURL == "" && cfg.OpenAIAPIKey == "" {
+			return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": errNoTranscriber.Error()})
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		samples, err := decodeOpusPCM(file, transcriptSampleRate)
+		if errors.Is(err, errNoOpusDecoder) {
+			return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": err.Error()})
+		} else if errors.Is(err, errCorruptRecording) {
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()})
+		} else if err != nil {
+			return err
+		}
+
+		var wav bytes.Buffer
+		if err := writeWAV(&wav, samples, transcriptSampleRate); err != nil {
+			return err
+		}
+		transcript, err := transcribe(cfg, wav.Bytes(), c.Query("language"))
+		if err != nil {
+			return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"error": err.Error()})
+		}
+		if err := os.WriteFile(recordingPath(c.Params("uuid"), transcriptFileName), transcript, 0o644); err != nil {
+			return err
+		}
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		return c.Send(transcript)
+	}
+}
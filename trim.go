@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pion/webrtc/v3/pkg/media/ivfreader"
+)
+
+const (
+	trimmedVideoFileName = "output_trimmed.ivf"
+	trimmedAudioFileName = "output_trimmed.opus"
+)
+
+// transformFile runs fn from the file at src into a new file at dst, removing dst again if fn fails
+func transformFile(src, dst string, fn func(r io.Reader, w io.Writer) error) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if err := fn(in, out); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
+
+// ivfFrameRate returns the frame rate declared by the timebase of the IVF file at path
+func ivfFrameRate(path string) (float64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	_, header, err := ivfreader.NewWith(file)
+	if err != nil {
+		return 0, err
+	}
+	if header.TimebaseNumerator == 0 {
+		return 0, fmt.Errorf("%w: zero timebase numerator", errCorruptRecording)
+	}
+	return float64(header.TimebaseDenominator) / float64(header.TimebaseNumerator), nil
+}
+
+// handleTrim writes copies of the recording cut down to the startMs-endMs range of the request body
+func handleTrim(c *fiber.Ctx) error {
+	id := c.Params("uuid")
+	if !isUUID(id) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid session id"})
+	}
+
+	var body struct {
+		StartMs *float64 `json:"startMs"`
+		EndMs   *float64 `json:"endMs"`
+	}
+	if err := c.BodyParser(&body); err != nil || body.StartMs == nil || body.EndMs == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "startMs and endMs are required"})
+	}
+	if *body.StartMs < 0 || *body.EndMs <= *body.StartMs {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "endMs must be after startMs and startMs must not be negative"})
+	}
+	startMs, endMs := *body.StartMs, *body.EndMs
+
+	videoPath, audioPath := recordingPath(id, videoFileName), recordingPath(id, audioFileName)
+	haveVideo, haveAudio := fileExists(videoPath), fileExists(audioPath)
+	if !haveVideo && !haveAudio {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "recording not found"})
+	}
+
+	result := fiber.Map{}
+	if haveVideo {
+		frameRate, err := ivfFrameRate(videoPath)
+		if err != nil {
+			return err
+		}
+		if err := transformFile(videoPath, recordingPath(id, trimmedVideoFileName), func(r io.Reader, w io.Writer) error {
+			return TrimIVF(r, w, startMs, endMs, frameRate)
+		}); err != nil {
+			return err
+		}
+		result["video"] = trimmedVideoFileName
+	}
+	if haveAudio {
+		if err := transformFile(audioPath, recordingPath(id, trimmedAudioFileName), func(r io.Reader, w io.Writer) error {
+			return TrimOGG(r, w, startMs, endMs)
+		}); err != nil {
+			return err
+		}
+		result["audio"] = trimmedAudioFileName
+	}
+
+	return c.JSON(result)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// turnUser is the user id in generated TURN credentials
+const turnUser = "webrtcpost"
+
+const (
+	// iceFailedTimeout is how long ICE stays disconnected before it gives up on the connection
+	iceFailedTimeout = 25 * time.Second
+	// iceKeepaliveInterval is how often ICE sends a binding request on an idle connection
+	iceKeepaliveInterval = 2 * time.Second
+)
+
+// GenerateTURNCredentials creates credentials for the TURN REST API scheme (draft-uberti-behave-turn-rest):
+// the username is the expiry unix timestamp and a user id, the password is base64(HMAC-SHA1(secret, username)).
+// The TURN server validates them with the same shared secret and rejects them once the timestamp has passed.
+func GenerateTURNCredentials(secret string, ttlSeconds int) (username, password string) {
+	expiry := time.Now().Add(time.Duration(ttlSeconds) * time.Second).Unix()
+	username = fmt.Sprintf("%d:%s", expiry, turnUser)
+
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write([]byte(username))
+	password = base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	return username, password
+}
+
+// iceServers returns the STUN and TURN servers for a new session, with fresh TURN credentials when a secret is configured
+func iceServers(cfg Config) []webrtc.ICEServer {
+	var servers []webrtc.ICEServer
+	if len(cfg.STUNURLs) > 0 {
+		servers = append(servers, webrtc.ICEServer{URLs: cfg.STUNURLs})
+	}
+	if len(cfg.TURNURLs) == 0 {
+		return servers
+	}
+
+	username, password := cfg.TURNUsername, cfg.TURNPassword
+	if cfg.TURNSecret != "" {
+		username, password = GenerateTURNCredentials(cfg.TURNSecret, cfg.TURNCredentialTTL)
+	}
+	return append(servers, webrtc.ICEServer{
+		URLs:       cfg.TURNURLs,
+		Username:   username,
+		Credential: password,
+	})
+}
+
+// peerConnectionConfig is the configuration shared by the recording and the playback peer connections
+func peerConnectionConfig(cfg Config) webrtc.Configuration {
+	return webrtc.Configuration{
+		ICEServers:         iceServers(cfg),
+		ICETransportPolicy: cfg.ICETransportPolicy,
+	}
+}
+
+// settingEngine holds the transport settings of the recording and playback peer connections. pion v3
+// packetizes outgoing RTP and fragments DTLS at a fixed 1200 bytes, ICE_MTU sizes the buffer incoming
+// packets are read into, which larger packets would not fit.
+func settingEngine(cfg Config) webrtc.SettingEngine {
+	s := webrtc.SettingEngine{}
+	// pion reports a connection disconnected after 5s without traffic, too soon for mobile clients
+	// on flaky networks. SetICETimeouts sets all three, the other two keep pion's defaults.
+	if cfg.ICEDisconnectedTimeout > 0 {
+		s.SetICETimeouts(time.Duration(cfg.ICEDisconnectedTimeout)*time.Second, iceFailedTimeout, iceKeepaliveInterval)
+	}
+	if cfg.ICEMTU > 0 {
+		s.SetReceiveMTU(uint(cfg.ICEMTU))
+	}
+	// Keeps the addresses of e.g. a management network out of the candidates sent to clients
+	if len(cfg.ICEInterfaces) > 0 {
+		s.SetInterfaceFilter(func(name string) bool { return slices.Contains(cfg.ICEInterfaces, name) })
+	}
+	return s
+}
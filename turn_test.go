@@ -0,0 +1,104 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+func TestGenerateTURNCredentials(t *testing.T) {
+	before := time.Now().Unix()
+	username, password := GenerateTURNCredentials("s3cret", 3600)
+	after := time.Now().Unix()
+
+	timestamp, user, ok := strings.Cut(username, ":")
+	if !ok || user != turnUser {
+		t.Fatalf("username %q, want <expiry>:%s", username, turnUser)
+	}
+	expiry, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		t.Fatalf("username %q: %v", username, err)
+	}
+	if expiry < before+3600 || expiry > after+3600 {
+		t.Errorf("expiry %d, want one hour after %d", expiry, before)
+	}
+
+	// The TURN server recomputes the password from the username with the shared secret
+	mac := hmac.New(sha1.New, []byte("s3cret"))
+	mac.Write([]byte(username))
+	if want := base64.StdEncoding.EncodeToString(mac.Sum(nil)); password != want {
+		t.Errorf("password %q, want %q", password, want)
+	}
+
+	if _, other := GenerateTURNCredentials("other", 3600); other == password {
+		t.Error("a different secret gave the same password")
+	}
+}
+
+func TestICEServersTURNCredentials(t *testing.T) {
+	cfg := Config{
+		STUNURLs:     []string{"stun:stun.example.com:3478"},
+		TURNURLs:     []string{"turn:turn.example.com:3478"},
+		TURNUsername: "static",
+		TURNPassword: "static-pass",
+	}
+
+	servers := iceServers(cfg)
+	if len(servers) != 2 {
+		t.Fatalf("got %d ICE servers, want STUN and TURN", len(servers))
+	}
+	if turn := servers[1]; turn.Username != "static" || turn.Credential != "static-pass" {
+		t.Errorf("without TURN_SECRET got %q/%v, want the static credentials", turn.Username, turn.Credential)
+	}
+
+	cfg.TURNSecret, cfg.TURNCredentialTTL = "s3cret", 60
+	turn := iceServers(cfg)[1]
+	if !strings.HasSuffix(turn.Username, ":"+turnUser) || turn.Credential == "static-pass" {
+		t.Errorf("with TURN_SECRET got %q/%v, want generated credentials", turn.Username, turn.Credential)
+	}
+}
+
+func TestICEServersWithoutTURN(t *testing.T) {
+	if servers := iceServers(Config{TURNSecret: "s3cret"}); len(servers) != 0 {
+		t.Errorf("got %v without STUN or TURN URLs, want none", servers)
+	}
+}
+
+// receiveMTU reads the receive MTU set on s, SettingEngine has no getter for it
+func receiveMTU(s webrtc.SettingEngine) uint {
+	return uint(reflect.ValueOf(s).FieldByName("receiveMTU").Uint())
+}
+
+func TestSettingEngineMTU(t *testing.T) {
+	if mtu := receiveMTU(settingEngine(Config{})); mtu != 0 {
+		t.Errorf("without ICE_MTU the receive MTU is %d, want 0 for pion's default", mtu)
+	}
+	if mtu := receiveMTU(settingEngine(Config{ICEMTU: 1500})); mtu != 1500 {
+		t.Errorf("receive MTU %d, want the ICE_MTU of 1500", mtu)
+	}
+}
+
+func TestLoadConfigICEMTU(t *testing.T) {
+	t.Setenv("ICE_MTU", "9000")
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mtu := receiveMTU(settingEngine(cfg)); mtu != 9000 {
+		t.Errorf("receive MTU %d, want the ICE_MTU of 9000", mtu)
+	}
+
+	for _, v := range []string{"1199", "65536", "big"} {
+		t.Setenv("ICE_MTU", v)
+		if _, err := loadConfig(); err == nil {
+			t.Errorf("ICE_MTU=%s was accepted", v)
+		}
+	}
+}
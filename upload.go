@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// uploadedRecording holds the form files of one recording in a batch upload, either may be missing
+type uploadedRecording struct {
+	index        int
+	video, audio *multipart.FileHeader
+}
+
+// batchUploadRecordings groups the files of a batch upload form by the N of their video_<N> and
+// audio_<N> field names, in the order of N
+func batchUploadRecordings(form *multipart.Form, maxFiles int) ([]uploadedRecording, error) {
+	count := 0
+	byIndex := map[int]*uploadedRecording{}
+	for field, files := range form.File {
+		kind, n, ok := strings.Cut(field, "_")
+		index, err := strconv.Atoi(n)
+		if !ok || err != nil || index < 0 || (kind != "video" && kind != "audio") {
+			return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("unexpected file field %q, expected video_<N> or audio_<N>", field))
+		}
+		if len(files) != 1 {
+			return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("field %q must hold exactly one file", field))
+		}
+		count++
+
+		recording, ok := byIndex[index]
+		if !ok {
+			recording = &uploadedRecording{index: index}
+			byIndex[index] = recording
+		}
+		if kind == "video" {
+			recording.video = files[0]
+		} else {
+			recording.audio = files[0]
+		}
+	}
+	if count == 0 {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "no files uploaded")
+	}
+	if count > maxFiles {
+		return nil, fiber.NewError(fiber.StatusRequestEntityTooLarge, fmt.Sprintf("at most %d files can be uploaded at once", maxFiles))
+	}
+
+	recordings := make([]uploadedRecording, 0, len(byIndex))
+	for _, recording := range byIndex {
+		recordings = append(recordings, *recording)
+	}
+	sort.Slice(recordings, func(i, j int) bool { return recordings[i].index < recordings[j].index })
+	return recordings, nil
+}
+
+// uploadMagic are the signatures of the uploaded media types that http.DetectContentType does not know
+var uploadMagic = []struct{ magic, contentType string }{
+	{"DKIF", "video/x-ivf"},
+	{"OggS\x00", "audio/ogg"},
+}
+
+// detectUploadType sniffs the content type of an uploaded file from its first 512 bytes, whatever
+// content type the client sent for it
+func detectUploadType(header *multipart.FileHeader) (string, error) {
+	file, err := header.Open()
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	head = head[:n]
+	for _, m := range uploadMagic {
+		if bytes.HasPrefix(head, []byte(m.magic)) {
+			return m.contentType, nil
+		}
+	}
+	return http.DetectContentType(head), nil
+}
+
+// saveUploadedRecording stores the files of recording in a new session directory and returns the session
+func saveUploadedRecording(c *fiber.Ctx, recording uploadedRecording) (*recordingSession, error) {
+	session := newRecordingSession(uuid.NewString())
+	if err := os.Mkdir(session.dir, 0o755); err != nil {
+		return nil, err
+	}
+	for _, file := range []struct {
+		header      *multipart.FileHeader
+		name        string
+		contentType string
+		validate    func(string) error
+	}{
+		{recording.video, videoFileName, "video/x-ivf", validateIVFFile},
+		{recording.audio, audioFileName, "audio/ogg", validateOGGFile},
+	} {
+		if file.header == nil {
+			continue
+		}
+		detected, err := detectUploadType(file.header)
+		if err != nil {
+			os.RemoveAll(session.dir)
+			return nil, err
+		}
+		if detected != file.contentType {
+			os.RemoveAll(session.dir)
+			return nil, fiber.NewError(fiber.StatusUnsupportedMediaType, fmt.Sprintf("%s: detected %s, expected %s", file.header.Filename, detected, file.contentType))
+		}
+
+		path := recordingPath(session.id, file.name)
+		err = c.SaveFile(file.header, path)
+		if err == nil {
+			err = file.validate(path)
+		}
+		if err != nil {
+			os.RemoveAll(session.dir)
+			if errors.Is(err, errCorruptRecording) {
+				return nil, fiber.NewError(fiber.StatusUnprocessableEntity, fmt.Sprintf("%s: %v", file.header.Filename, err))
+			}
+			return nil, err
+		}
+	}
+	if err := session.update(func(*sessionMetadata) {}); err != nil {
+		os.RemoveAll(session.dir)
+		return nil, err
+	}
+	return session, nil
+}
+
+// handleBatchUpload stores several recordings sent as one multipart/form-data request. The files of
+// each recording are named video_<N> and audio_<N>, every N becomes a new session. The batch is
+// all or nothing, if one file is rejected none of the recordings are kept.
+func handleBatchUpload(cfg Config) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		form, err := c.MultipartForm()
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "expected a multipart/form-data body"})
+		}
+		recordings, err := batchUploadRecordings(form, cfg.MaxBatchUpload)
+		if err != nil {
+			return sendError(c, err)
+		}
+
+		var saved []*recordingSession
+		for _, recording := range recordings {
+			session, err := saveUploadedRecording(c, recording)
+			if err != nil {
+				for _, s := range saved {
+					os.RemoveAll(s.dir)
+				}
+				return sendError(c, err)
+			}
+			saved = append(saved, session)
+		}
+
+		ids := make([]string, 0, len(saved))
+		for _, session := range saved {
+			sessions.add(session)
+			ids = append(ids, session.id)
+		}
+		return c.Status(fiber.StatusCreated).JSON(ids)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v3"
+)
+
+// sdpReport is the answer of POST /validate/sdp
+type sdpReport struct {
+	Valid bool `json:"valid"`
+	// DetectedCodecs are the codec names of the rtpmap attributes in the order the offer lists them
+	DetectedCodecs []string `json:"detectedCodecs"`
+	// ICEServerHints name the ICE servers the candidates of the offer came from, stun for srflx and
+	// prflx candidates and turn for relay candidates
+	ICEServerHints []string `json:"iceServerHints"`
+	Warnings       []string `json:"warnings"`
+	// Errors are why the offer would be refused, set when Valid is false
+	Errors []string `json:"errors,omitempty"`
+}
+
+// validateOffer checks an offer against what a recording peer connection accepts: VP8 video and
+// Opus audio over DTLS. An offer with either codec is valid, the kind without one is not recorded.
+func validateOffer(offer webrtc.SessionDescription) sdpReport {
+	report := sdpReport{DetectedCodecs: []string{}, ICEServerHints: []string{}, Warnings: []string{}}
+	if offer.Type != webrtc.SDPTypeOffer {
+		report.Errors = append(report.Errors, fmt.Sprintf("type is %s, not offer", offer.Type))
+		return report
+	}
+	parsed := sdp.SessionDescription{}
+	if err := parsed.UnmarshalString(offer.SDP); err != nil {
+		report.Errors = append(report.Errors, "cannot parse SDP: "+err.Error())
+		return report
+	}
+
+	_, fingerprint := parsed.Attribute("fingerprint")
+	var vp8, opus bool
+	for _, media := range parsed.MediaDescriptions {
+		kind := media.MediaName.Media
+		if _, ok := media.Attribute("fingerprint"); ok {
+			fingerprint = true
+		}
+		// The client only sends media of sections that are sendrecv or sendonly
+		_, recvonly := media.Attribute("recvonly")
+		_, inactive := media.Attribute("inactive")
+		sending := !recvonly && !inactive
+		for _, attr := range media.Attributes {
+			switch attr.Key {
+			case "rtpmap":
+				// 96 VP8/90000
+				fields := strings.Fields(attr.Value)
+				if len(fields) < 2 {
+					continue
+				}
+				codec, _, _ := strings.Cut(fields[1], "/")
+				if !slices.Contains(report.DetectedCodecs, codec) {
+					report.DetectedCodecs = append(report.DetectedCodecs, codec)
+				}
+				vp8 = vp8 || sending && kind == "video" && strings.EqualFold(codec, "VP8")
+				opus = opus || sending && kind == "audio" && strings.EqualFold(codec, "opus")
+			case "candidate":
+				hint := ""
+				switch candidateType(attr.Value) {
+				case "srflx", "prflx":
+					hint = "stun"
+				case "relay":
+					hint = "turn"
+				}
+				if hint != "" && !slices.Contains(report.ICEServerHints, hint) {
+					report.ICEServerHints = append(report.ICEServerHints, hint)
+				}
+			case "recvonly", "inactive":
+				report.Warnings = append(report.Warnings, fmt.Sprintf("%s section is %s, nothing is recorded from it", kind, attr.Key))
+			}
+		}
+	}
+
+	if !fingerprint {
+		report.Errors = append(report.Errors, "no DTLS fingerprint")
+	}
+	if !vp8 && !opus {
+		report.Errors = append(report.Errors, "no VP8 video or Opus audio")
+	} else if !vp8 {
+		report.Warnings = append(report.Warnings, "no VP8 video detected, only audio is recorded")
+	} else if !opus {
+		report.Warnings = append(report.Warnings, "no Opus audio detected, only video is recorded")
+	}
+	if _, ok := parsed.Attribute("ice-ufrag"); !ok && !slices.ContainsFunc(parsed.MediaDescriptions, func(media *sdp.MediaDescription) bool {
+		_, ok := media.Attribute("ice-ufrag")
+		return ok
+	}) {
+		report.Errors = append(report.Errors, "no ICE credentials")
+	}
+	report.Valid = len(report.Errors) == 0
+	return report
+}
+
+// handleValidateSDP reports whether an offer, sent like to POST /, would be accepted, without creating a peer connection
+func handleValidateSDP(c *fiber.Ctx) error {
+	offer, ok, err := readOffer(c)
+	if !ok {
+		return err
+	}
+	return c.JSON(validateOffer(offer))
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pion/webrtc/v3/pkg/media/ivfreader"
+)
+
+const videoInfoFileName = "video_info.json"
+
+// VideoInfo describes an IVF file from its header
+type VideoInfo struct {
+	Codec     string  `json:"codec"`
+	Width     uint16  `json:"width"`
+	Height    uint16  `json:"height"`
+	FrameRate float64 `json:"frameRate"`
+}
+
+// extractIVFInfo reads the info of the IVF file at path from its header, and the size of VP8 video
+// from its first keyframe. The frame rate is the inverse of the timebase, which is what writers such
+// as pion's ivfwriter put there.
+func extractIVFInfo(path string) (VideoInfo, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return VideoInfo{}, err
+	}
+	defer file.Close()
+
+	ivf, header, err := ivfreader.NewWith(file)
+	if err != nil {
+		return VideoInfo{}, fmt.Errorf("%w: %v", errCorruptRecording, err)
+	}
+	width, height := ivfVideoSize(ivf, header)
+	info := VideoInfo{Codec: ivfCodecName(header.FourCC), Width: width, Height: height}
+	if header.TimebaseNumerator != 0 {
+		info.FrameRate = float64(header.TimebaseDenominator) / float64(header.TimebaseNumerator)
+	}
+	return info, nil
+}
+
+// writeVideoInfo writes video_info.json next to the IVF file at path
+func writeVideoInfo(path string) error {
+	info, err := extractIVFInfo(path)
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(filepath.Dir(path), videoInfoFileName), b, 0o644)
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/at-wat/ebml-go/mkvcore"
+	"github.com/at-wat/ebml-go/webm"
+	"github.com/gofiber/fiber/v2"
+	"github.com/pion/webrtc/v3/pkg/media/ivfreader"
+	"github.com/pion/webrtc/v3/pkg/media/oggreader"
+)
+
+const (
+	webmFileName = "output.webm"
+	// opusSeekPreRoll is the 80ms of audio an Opus decoder needs to converge after a seek, in nanoseconds
+	opusSeekPreRoll = 80000000
+)
+
+// webmCodecIDs maps IVF FourCCs to Matroska codec ids
+var webmCodecIDs = map[string]string{
+	fourCCVP8: "V_VP8",
+	fourCCVP9: "V_VP9",
+	fourCCAV1: "V_AV1",
+}
+
+// webmBlock is a frame waiting to be written to the WebM track with the given index
+type webmBlock struct {
+	track       int
+	keyframe    bool
+	timestampMs int64
+	data        []byte
+}
+
+// vp8FrameSize returns the dimensions stored in a VP8 keyframe header, the IVF header only holds the size pion defaults to
+func vp8FrameSize(frame []byte) (width, height uint16, ok bool) {
+	if len(frame) < 10 || frame[0]&0x01 != 0 || !bytes.Equal(frame[3:6], []byte{0x9d, 0x01, 0x2a}) {
+		return 0, 0, false
+	}
+	return binary.LittleEndian.Uint16(frame[6:]) & 0x3fff, binary.LittleEndian.Uint16(frame[8:]) & 0x3fff, true
+}
+
+// opusHead rebuilds the OpusHead identification header, which Matroska stores as the codec private data
+func opusHead(h *oggreader.OggHeader) []byte {
+	head := make([]byte, 19)
+	copy(head, "OpusHead")
+	head[8] = 1
+	head[9] = h.Channels
+	binary.LittleEndian.PutUint16(head[10:], h.PreSkip)
+	binary.LittleEndian.PutUint32(head[12:], h.SampleRate)
+	binary.LittleEndian.PutUint16(head[16:], h.OutputGain)
+	head[18] = h.ChannelMap
+	return head
+}
+
+// ExportWebM muxes an IVF video and an Ogg Opus audio recording into one WebM file written to w,
+// either path may be empty to leave out that track. w is closed once the file is complete.
+func ExportWebM(videoPath, audioPath string, w io.WriteCloser) error {
+	var (
+		tracks  []webm.TrackEntry
+		sources []func() (*webmBlock, error)
+	)
+
+	if videoPath != "" {
+		file, err := os.Open(videoPath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		ivf, header, err := ivfreader.NewWith(file)
+		if err != nil {
+			return fmt.Errorf("%w: %v", errCorruptRecording, err)
+		}
+		codecID, ok := webmCodecIDs[header.FourCC]
+		if !ok {
+			return fmt.Errorf("%w: no WebM codec for %s video", errIncompatibleRecordings, header.FourCC)
+		}
+		if header.TimebaseDenominator == 0 {
+			return fmt.Errorf("%w: zero timebase denominator", errCorruptRecording)
+		}
+
+		// Read ahead to the first frame for the real picture size
+		first, firstHeader, err := ivf.ParseNextFrame()
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		width, height := header.Width, header.Height
+		if frameWidth, frameHeight, ok := vp8FrameSize(first); ok && header.FourCC == fourCCVP8 {
+			width, height = frameWidth, frameHeight
+		}
+
+		track := len(tracks)
+		tracks = append(tracks, webm.TrackEntry{
+			Name:        "Video",
+			TrackNumber: uint64(track + 1),
+			TrackUID:    uint64(track + 1),
+			CodecID:     codecID,
+			TrackType:   1,
+			Video:       &webm.Video{PixelWidth: uint64(width), PixelHeight: uint64(height)},
+		})
+		toBlock := func(frame []byte, pts uint64) *webmBlock {
+			return &webmBlock{
+				track:       track,
+				keyframe:    isIVFKeyFrame(header.FourCC, frame),
+				timestampMs: int64(pts * 1000 * uint64(header.TimebaseNumerator) / uint64(header.TimebaseDenominator)),
+				data:        frame,
+			}
+		}
+		pending := first != nil
+		sources = append(sources, func() (*webmBlock, error) {
+			if pending {
+				pending = false
+				return toBlock(first, firstHeader.Timestamp), nil
+			}
+			frame, frameHeader, err := ivf.ParseNextFrame()
+			if err != nil {
+				return nil, err
+			}
+			return toBlock(frame, frameHeader.Timestamp), nil
+		})
+	}
+
+	if audioPath != "" {
+		file, err := os.Open(audioPath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		ogg, header, err := oggreader.NewWith(file)
+		if err != nil {
+			return fmt.Errorf("%w: %v", errCorruptRecording, err)
+		}
+
+		track := len(tracks)
+		tracks = append(tracks, webm.TrackEntry{
+			Name:         "Audio",
+			TrackNumber:  uint64(track + 1),
+			TrackUID:     uint64(track + 1),
+			CodecID:      "A_OPUS",
+			CodecPrivate: opusHead(header),
+			CodecDelay:   uint64(header.PreSkip) * 1000000000 / opusClockRate,
+			SeekPreRoll:  opusSeekPreRoll,
+			TrackType:    2,
+			Audio:        &webm.Audio{SamplingFrequency: float64(header.SampleRate), Channels: uint64(header.Channels)},
+		})
+		sources = append(sources, func() (*webmBlock, error) {
+			for {
+				payload, pageHeader, err := ogg.ParseNextPage()
+				if err != nil {
+					return nil, err
+				}
+				if bytes.HasPrefix(payload, []byte("OpusTags")) || len(payload) == 0 {
+					continue
+				}
+				// oggwriter sets each page's granule to the time the packet starts at, like TrimOGG assumes
+				return &webmBlock{
+					track:       track,
+					keyframe:    true,
+					timestampMs: int64(pageHeader.GranulePosition * 1000 / opusClockRate),
+					data:        payload,
+				}, nil
+			}
+		})
+	}
+
+	var (
+		fatalMu sync.Mutex
+		fatal   error
+	)
+	writers, err := webm.NewSimpleBlockWriter(w, tracks, mkvcore.WithOnFatalHandler(func(err error) {
+		fatalMu.Lock()
+		defer fatalMu.Unlock()
+		fatal = err
+	}))
+	if err != nil {
+		return err
+	}
+	closeWriters := func() {
+		for _, writer := range writers {
+			writer.Close()
+		}
+	}
+
+	// Blocks must reach the muxer in timestamp order across tracks, so the next block of every
+	// track is held and the earliest one written first
+	next := make([]*webmBlock, len(sources))
+	for i, source := range sources {
+		if next[i], err = source(); err != nil && !errors.Is(err, io.EOF) {
+			closeWriters()
+			return err
+		}
+	}
+	for {
+		earliest := -1
+		for i, block := range next {
+			if block != nil && (earliest < 0 || block.timestampMs < next[earliest].timestampMs) {
+				earliest = i
+			}
+		}
+		if earliest < 0 {
+			break
+		}
+
+		block := next[earliest]
+		if _, err := writers[block.track].Write(block.keyframe, block.timestampMs, block.data); err != nil {
+			closeWriters()
+			return err
+		}
+		if next[earliest], err = sources[earliest](); err != nil && !errors.Is(err, io.EOF) {
+			closeWriters()
+			return err
+		}
+	}
+	closeWriters()
+
+	fatalMu.Lock()
+	defer fatalMu.Unlock()
+	return fatal
+}
+
+// handleExportWebM muxes the recording into output.webm, which GET /files/:uuid/webm serves
+func handleExportWebM(c *fiber.Ctx) error {
+	id := c.Params("uuid")
+	if !isUUID(id) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid session id"})
+	}
+
+	videoPath, audioPath := recordingPath(id, videoFileName), recordingPath(id, audioFileName)
+	if !fileExists(videoPath) {
+		videoPath = ""
+	} else if err := validateIVFFile(videoPath); err != nil {
+		return webmExportError(c, err)
+	}
+	if !fileExists(audioPath) {
+		audioPath = ""
+	} else if err := validateOGGFile(audioPath); err != nil {
+		return webmExportError(c, err)
+	}
+	if videoPath == "" && audioPath == "" {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "recording not found"})
+	}
+
+	dst := recordingPath(id, webmFileName)
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	// ExportWebM closes out once the muxer is done, errors before that leave it open
+	if err := ExportWebM(videoPath, audioPath, out); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return webmExportError(c, err)
+	}
+
+	if session, ok := sessions.get(id); ok {
+		if err := session.update(func(meta *sessionMetadata) { meta.WebM = webmFileName }); err != nil {
+			fmt.Println("Error writing session metadata:", err)
+		}
+	}
+	return c.JSON(fiber.Map{"file": webmFileName, "path": "/files/" + id + "/webm"})
+}
+
+func webmExportError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, errCorruptRecording) || errors.Is(err, errIncompatibleRecordings) {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()})
+	}
+	return err
+}
+
+// validateWebMFile checks that the file starts with the EBML magic number
+func validateWebMFile(path string) error {
+	return validateMediaFile(path, "\x1a\x45\xdf\xa3")
+}
+
+func handleWebMFile(c *fiber.Ctx) error {
+	return serveRecordingFile(c, webmFileName, "video/webm", validateWebMFile)
+}
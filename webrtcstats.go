@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pion/webrtc/v3"
+)
+
+// webrtcStatsReport lays out the stats of a live session like an RTCStatsReport, keyed by stats id,
+// so they can be read with the tools made for browser stats. pion has no RTP stream stats of its
+// own, inbound-rtp is filled from the counters of the recorded tracks and outbound-rtp only lists
+// the tracks the server sends, which a recording session has none of.
+func webrtcStatsReport(session *recordingSession) map[string]webrtc.Stats {
+	pc := session.peerConnection
+	report := pc.GetStats()
+	stats := map[string]webrtc.Stats{}
+	codecIDs := map[webrtc.PayloadType]string{}
+	for id, s := range report {
+		switch s := s.(type) {
+		case webrtc.ICECandidatePairStats, webrtc.ICECandidateStats:
+			stats[id] = s
+		case webrtc.CodecStats:
+			stats[id] = s
+			codecIDs[s.PayloadType] = id
+		}
+	}
+
+	timestamp := webrtc.StatsTimestamp(time.Now().UnixMilli())
+	session.mu.Lock()
+	videoSSRC, audioSSRC := session.videoSSRC, session.audioSSRC
+	session.mu.Unlock()
+
+	for _, receiver := range pc.GetReceivers() {
+		track := receiver.Track()
+		if track == nil {
+			continue
+		}
+		inbound := webrtc.InboundRTPStreamStats{
+			Timestamp: timestamp,
+			Type:      webrtc.StatsTypeInboundRTP,
+			ID:        fmt.Sprintf("inbound-rtp-%d", track.SSRC()),
+			SSRC:      track.SSRC(),
+			Kind:      track.Kind().String(),
+			CodecID:   codecIDs[track.Codec().PayloadType],
+		}
+		// Only the first track of each kind is counted
+		var counters *codecCounters
+		switch uint32(track.SSRC()) {
+		case videoSSRC:
+			counters = &session.videoStats
+		case audioSSRC:
+			counters = &session.audioStats
+		}
+		if counters != nil {
+			inbound.PacketsReceived = uint32(counters.packets.Load())
+			inbound.BytesReceived = counters.bytes.Load()
+		}
+		stats[inbound.ID] = inbound
+	}
+
+	for _, sender := range pc.GetSenders() {
+		if sender.Track() == nil {
+			continue
+		}
+		params := sender.GetParameters()
+		for _, encoding := range params.Encodings {
+			outbound := webrtc.OutboundRTPStreamStats{
+				Timestamp: timestamp,
+				Type:      webrtc.StatsTypeOutboundRTP,
+				ID:        fmt.Sprintf("outbound-rtp-%d", encoding.SSRC),
+				SSRC:      encoding.SSRC,
+				Kind:      sender.Track().Kind().String(),
+			}
+			if len(params.Codecs) > 0 {
+				outbound.CodecID = codecIDs[params.Codecs[0].PayloadType]
+			}
+			stats[outbound.ID] = outbound
+		}
+	}
+	return stats
+}
+
+// handleWebRTCStats returns the stats of a live session in the RTCStatsReport format
+func handleWebRTCStats(c *fiber.Ctx) error {
+	id := c.Params("uuid")
+	if !isUUID(id) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid session id"})
+	}
+
+	session, ok := sessions.get(id)
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "session not found"})
+	}
+	if session.peerConnection == nil || session.peerConnection.ConnectionState() == webrtc.PeerConnectionStateClosed {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "session is not live"})
+	}
+	return c.JSON(webrtcStatsReport(session))
+}
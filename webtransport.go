@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/pion/webrtc/v3"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/quic-go/webtransport-go"
+)
+
+// maxWebTransportOfferSize bounds how much is read from the signaling stream
+const maxWebTransportOfferSize = 64 * 1024
+
+// serveWebTransport runs the HTTP/3 server for WebTransport signaling on QUIC_PORT.
+//
+// A client connects to https://host:QUIC_PORT/webtransport/session, opens one bidirectional
+// stream and writes the base64 encoded offer (the same format as the `param` field of POST /),
+// then closes its side of the stream. The server answers on the same stream and afterwards both
+// sides exchange ICE candidates as JSON encoded RTCIceCandidateInit datagrams, a `null` datagram
+// marks the end of the server's candidates.
+func serveWebTransport(cfg Config) error {
+	h3 := &http3.Server{
+		Addr:       fmt.Sprintf(":%d", cfg.QUICPort),
+		QUICConfig: &quic.Config{EnableDatagrams: true},
+	}
+	webtransport.ConfigureHTTP3Server(h3)
+
+	server := &webtransport.Server{
+		H3: h3,
+		CheckOrigin: func(r *http.Request) bool {
+			return r.Header.Get("Origin") == "" || r.Header.Get("Origin") == "http://localhost:5173"
+		},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/webtransport/session", func(w http.ResponseWriter, r *http.Request) {
+		session, err := server.Upgrade(w, r)
+		if err != nil {
+			fmt.Printf("WebTransport upgrade failed: %v\n", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		go handleWebTransportSession(cfg, session)
+	})
+	h3.Handler = mux
+
+	fmt.Printf("WebTransport signaling listening on UDP port %d\n", cfg.QUICPort)
+	return server.ListenAndServeTLS(cfg.QUICCert, cfg.QUICKey)
+}
+
+func handleWebTransportSession(cfg Config, wt *webtransport.Session) {
+	ctx := wt.Context()
+
+	stream, err := wt.AcceptStream(ctx)
+	if err != nil {
+		fmt.Printf("WebTransport session closed before sending an offer: %v\n", err)
+		return
+	}
+
+	param, err := io.ReadAll(io.LimitReader(stream, maxWebTransportOfferSize))
+	if err != nil {
+		fmt.Printf("Cannot read WebTransport offer: %v\n", err)
+		wt.CloseWithError(1, "cannot read offer")
+		return
+	}
+	offer := webrtc.SessionDescription{}
+	if err := decode(strings.TrimSpace(string(param)), &offer); err != nil {
+		// The close message carries "invalid base64" or "invalid JSON" like the HTTP error responses
+		msg := errInvalidJSON.Error()
+		if errors.Is(err, errInvalidBase64) {
+			msg = errInvalidBase64.Error()
+		}
+		wt.CloseWithError(1, msg)
+		return
+	}
+
+	// Candidates gathered before the answer went out are held back,
+	// the client cannot add them until it has the answer
+	var (
+		mu       sync.Mutex
+		answered bool
+		pending  [][]byte
+	)
+	sendCandidate := func(msg []byte) {
+		if err := wt.SendDatagram(msg); err != nil {
+			fmt.Printf("Cannot send ICE candidate datagram: %v\n", err)
+		}
+	}
+	onICECandidate := func(candidate *webrtc.ICECandidate) {
+		msg := []byte("null")
+		if candidate != nil {
+			var err error
+			if msg, err = json.Marshal(candidate.ToJSON()); err != nil {
+				fmt.Println(err)
+				return
+			}
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if !answered {
+			pending = append(pending, msg)
+			return
+		}
+		sendCandidate(msg)
+	}
+
+	session, peerConnection, err := startRecording(ctx, cfg, nil, offer, onICECandidate)
+	if err != nil {
+		fmt.Printf("Cannot start recording from WebTransport offer: %v\n", err)
+		wt.CloseWithError(2, "cannot start recording")
+		return
+	}
+
+	if _, err := stream.Write([]byte(encode(session.localDescription(cfg)))); err != nil {
+		fmt.Printf("Cannot send WebTransport answer for session %s: %v\n", session.id, err)
+		// Closing the connection tears the session down, which releases its lock and writers
+		session.markServerInitiated()
+		if cErr := peerConnection.Close(); cErr != nil {
+			fmt.Printf("cannot close peerConnection: %v\n", cErr)
+		}
+		wt.CloseWithError(2, "cannot send answer")
+		return
+	}
+	if err := stream.Close(); err != nil {
+		fmt.Println(err)
+	}
+
+	mu.Lock()
+	answered = true
+	for _, msg := range pending {
+		sendCandidate(msg)
+	}
+	pending = nil
+	mu.Unlock()
+
+	for {
+		msg, err := wt.ReceiveDatagram(ctx)
+		if err != nil {
+			if ctx.Err() == nil && err != context.Canceled {
+				fmt.Printf("WebTransport signaling for session %s ended: %v\n", session.id, err)
+			}
+			return
+		}
+		if string(msg) == "null" {
+			continue
+		}
+
+		var candidate webrtc.ICECandidateInit
+		if err := json.Unmarshal(msg, &candidate); err != nil {
+			fmt.Printf("Ignoring malformed ICE candidate datagram for session %s: %v\n", session.id, err)
+			continue
+		}
+		if len(filterCandidates([]webrtc.ICECandidateInit{candidate}, cfg.ICECandidateTypes)) == 0 {
+			continue
+		}
+		if err := peerConnection.AddICECandidate(candidate); err != nil {
+			fmt.Printf("Cannot add remote ICE candidate for session %s: %v\n", session.id, err)
+		}
+	}
+}
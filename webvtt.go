@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// webvttCueDuration is how long the cue of an annotation is shown, annotations mark a point in time
+const webvttCueDuration = 3 * time.Second
+
+// webvttTimestamp formats d as a WebVTT cue timestamp, hh:mm:ss.ttt
+func webvttTimestamp(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// webvttCueText escapes text for a cue payload. A blank line would end the cue, so empty lines are dropped.
+func webvttCueText(text string) string {
+	text = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "").Replace(text)
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// writeWebVTT writes the annotations as WebVTT cues in time order, each shown for webvttCueDuration
+func writeWebVTT(w io.Writer, annotations []annotation) error {
+	sorted := append([]annotation(nil), annotations...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].TimeMs < sorted[j].TimeMs })
+
+	if _, err := io.WriteString(w, "WEBVTT\n"); err != nil {
+		return err
+	}
+	for i, a := range sorted {
+		start := time.Duration(a.TimeMs) * time.Millisecond
+		if _, err := fmt.Fprintf(w, "\n%d\n%s --> %s\n%s\n", i+1, webvttTimestamp(start), webvttTimestamp(start+webvttCueDuration), webvttCueText(a.Text)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleExportWebVTT returns the annotations of a recording as a WebVTT file, for the <track>
+// element of a browser's video player. DTMF tones are not part of it: recordings do not negotiate
+// telephone-event, the server only sends tones to /video playbacks.
+func handleExportWebVTT(c *fiber.Ctx) error {
+	session, err := annotatedSession(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+	annotations, err := session.annotations()
+	if err != nil {
+		return err
+	}
+
+	var vtt strings.Builder
+	if err := writeWebVTT(&vtt, annotations); err != nil {
+		return err
+	}
+	c.Set(fiber.HeaderContentType, "text/vtt; charset=utf-8")
+	return c.SendString(vtt.String())
+}